@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds/rdsutils"
+	"github.com/jackc/pgx/v4"
+)
+
+// rdsAuthToken generates an IAM authentication token for the connection,
+// which RDS accepts in place of a password. Credentials are resolved from the
+// standard AWS environment, shared config and instance metadata.
+func rdsAuthToken(cfg *pgx.ConnConfig, region string) (string, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		return "", fmt.Errorf("no AWS region configured, set --aws-region or AWS_REGION")
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	return rdsutils.BuildAuthToken(endpoint, aws.StringValue(sess.Config.Region), cfg.User, sess.Config.Credentials)
+}
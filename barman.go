@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+)
+
+var (
+	restoreBarman            = restore.Command("barman", "Pick the Barman backup to recover from, and print the recover command")
+	restoreBarmanTable       = restoreBarman.Arg("table", "Table to use for estimates, unless given by --target").String()
+	restoreBarmanTime        = restoreBarman.Arg("time", "Target time to restore to").String()
+	restoreBarmanServer      = restoreBarman.Flag("server", "Barman server to recover").Required().String()
+	restoreBarmanDestination = restoreBarman.Flag("destination", "Directory to recover the backup into").Required().String()
+	restoreBarmanList        = restoreBarman.Flag("list", "Output of barman -f json list-backup to read instead of running barman, or - for stdin").String()
+	restoreBarmanCommand     = restoreBarman.Flag("barman", "barman executable").Default("barman").String()
+)
+
+// barmanBackup is a backup as listed by barman -f json list-backup, keyed by
+// server, with only the fields we need to pick a backup. Versions differ in
+// whether the end time is a number or a string, and failed backups have none.
+type barmanBackup struct {
+	BackupID         string          `json:"backup_id"`
+	Status           string          `json:"status"`
+	EndTimeTimestamp json.RawMessage `json:"end_time_timestamp"`
+}
+
+// barmanDone is the status of backups that completed, the only ones that can
+// be recovered.
+const barmanDone = "DONE"
+
+func runRestoreBarman(ctx context.Context) {
+	if *restoreBarmanTable == "" || *restoreBarmanTime == "" {
+		kingpin.Fatalf("required arguments 'table' and 'time' not provided, nor the table by --target")
+	}
+
+	list, err := readCatalog(ctx, *restoreBarmanList,
+		*restoreBarmanCommand, "-f", "json", "list-backup", *restoreBarmanServer)
+	if err != nil {
+		fatal(err)
+	}
+
+	backups, err := barmanBackups(list, *restoreBarmanServer)
+	if err != nil {
+		fatal(err)
+	}
+
+	result, _, err := restoreTarget(ctx, *restoreBarmanTable, *restoreBarmanTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	selected, err := latestBackupBefore(backups, result.TargetTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	xid, inclusive := recoveryTarget(result)
+	command := []string{*restoreBarmanCommand, "recover", "--target-xid", xid}
+	if !inclusive {
+		command = append(command, "--exclusive")
+	}
+	command = append(command, *restoreBarmanServer, selected.Label, *restoreBarmanDestination)
+
+	if _, err := fmt.Fprintln(os.Stdout, shellCommand(command...)); err != nil {
+		kingpin.Fatalf("failed to write command: %v", err)
+	}
+}
+
+// barmanBackups lists the completed backups of the server from barman's JSON
+// output. The minimal output has no end times, so can't be used to pick one.
+func barmanBackups(list []byte, server string) ([]backup, error) {
+	var servers map[string][]barmanBackup
+	if err := json.Unmarshal(list, &servers); err != nil {
+		return nil, fmt.Errorf("invalid barman list-backup output, which must be from -f json: %w", err)
+	}
+
+	listed, ok := servers[server]
+	if !ok {
+		return nil, fmt.Errorf("no server named %q in barman list-backup output", server)
+	}
+
+	backups := make([]backup, 0, len(listed))
+	for _, b := range listed {
+		if b.Status != barmanDone {
+			level.Debug(logger).Log("event", "skipped_backup", "label", b.BackupID, "status", b.Status)
+			continue
+		}
+
+		stop, err := strconv.ParseFloat(strings.Trim(string(b.EndTimeTimestamp), `"`), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end_time_timestamp %s of backup %s: %w", b.EndTimeTimestamp, b.BackupID, err)
+		}
+
+		backups = append(backups, backup{Label: b.BackupID, Stop: time.Unix(int64(stop), 0).UTC()})
+	}
+
+	return backups, nil
+}
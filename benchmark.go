@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"go.opentelemetry.io/otel/api/global"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	benchmark           = app.Command("benchmark", "Estimate random times from the history of a table, reporting the latency of each stage and the error where commit timestamps give the truth")
+	benchmarkTable      = benchmark.Arg("table", "Table to use for estimates, unless given by --target").String()
+	benchmarkSamples    = benchmark.Flag("samples", "Number of random times to estimate").Default("100").Int()
+	benchmarkSeed       = benchmark.Flag("seed", "Seed for choosing times, for repeatable runs, or random when zero").Int64()
+	benchmarkIDColumn   = benchmark.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	benchmarkTimeColumn = benchmark.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	benchmarkStrategy   = benchmark.Flag("strategy", "Force a strategy rather than picking the cheapest viable one").Default(xidfortime.StrategyAuto).Enum(append([]string{xidfortime.StrategyAuto}, xidfortime.StrategyNames...)...)
+	benchmarkRefine     = benchmark.Flag("refine", "Bisect the id range between histogram bounds before probing").Bool()
+	benchmarkTolerance  = benchmark.Flag("tolerance", "Keep narrowing until the rows either side of the target are within this duration").Duration()
+	benchmarkVerify     = benchmark.Flag("verify", "Check each xid committed, walking back to one that did if not").Default("true").Bool()
+	benchmarkFormat     = benchmark.Flag("format", "Format of the report written to stdout").Default("table").Enum("table", formatJSON)
+)
+
+func runBenchmark(ctx context.Context) {
+	if *benchmarkTable == "" {
+		kingpin.Fatalf("required argument 'table' not provided, nor by --target")
+	}
+	if *benchmarkSamples < 1 {
+		kingpin.Fatalf("--samples must be at least 1")
+	}
+
+	seed := *benchmarkSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *benchmarkIDColumn
+	estimator.TimeColumn = *benchmarkTimeColumn
+	estimator.Concurrency = *maxConns
+	estimator.Strategy = *benchmarkStrategy
+	estimator.Refine = *benchmarkRefine
+	estimator.Tolerance = *benchmarkTolerance
+	estimator.Verify = *benchmarkVerify
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+	estimator.Cache = xidfortime.NewCache()
+
+	first, last, err := estimator.Extent(ctx, conn, *benchmarkTable)
+	if err != nil {
+		fatal(err)
+	}
+
+	level.Info(logger).Log("event", "benchmarking", "samples", *benchmarkSamples, "seed", seed,
+		"from", first.CreatedAt, "to", last.CreatedAt)
+
+	timer := newStageTimer()
+	var (
+		latencies, gaps []time.Duration
+		xidsOff         []int64
+		timeErrors      []time.Duration
+		failures        int
+		groundTruth     = true
+	)
+	for idx := 0; idx < *benchmarkSamples && ctx.Err() == nil; idx++ {
+		t := first.CreatedAt.Add(time.Duration(rng.Int63n(int64(last.CreatedAt.Sub(first.CreatedAt)) + 1)))
+
+		timer.start()
+		began := time.Now()
+		result, err := estimator.EstimateXID(ctx, conn, *benchmarkTable, t)
+		latency := time.Since(began)
+		timer.stop()
+
+		if err != nil {
+			failures++
+			level.Warn(logger).Log("event", "benchmark_estimate_failed", "target_time", t, "error", err)
+			continue
+		}
+		latencies, gaps = append(latencies, latency), append(gaps, result.Gap())
+
+		if !groundTruth {
+			continue
+		}
+
+		accuracy, err := estimator.CompareExact(ctx, conn, *benchmarkTable, result, 0)
+		switch {
+		case errors.Is(err, xidfortime.ErrCommitTimestampsDisabled):
+			groundTruth = false
+			level.Info(logger).Log("event", "no_ground_truth", "msg", "commit timestamps aren't tracked, so only latency and gaps are reported")
+		case err != nil:
+			level.Warn(logger).Log("event", "benchmark_compare_failed", "target_time", t, "error", err)
+		default:
+			xidsOff = append(xidsOff, abs64(accuracy.XIDsOff))
+			if accuracy.TimeError != nil {
+				timeErrors = append(timeErrors, time.Duration(abs64(int64(*accuracy.TimeError))))
+			}
+		}
+	}
+
+	report := benchmarkReport{Seed: seed, Failures: failures}
+	report.addDurations("latency", latencies)
+	for _, stage := range timer.stages() {
+		report.addDurations("stage "+stage, timer.durations[stage])
+	}
+	report.addDurations("gap", gaps)
+	report.addDurations("time error", timeErrors)
+	report.add("xids off", xidsOff, func(n int64) string { return fmt.Sprint(n) })
+
+	if err := report.write(*benchmarkFormat); err != nil {
+		kingpin.Fatalf("failed to write report: %v", err)
+	}
+}
+
+// stageTimer records how long each stage of an estimate took while started,
+// from the spans the estimator creates for them.
+type stageTimer struct {
+	mu        sync.Mutex
+	active    bool
+	durations map[string][]time.Duration
+}
+
+// newStageTimer registers a timer with the trace provider, creating one that
+// samples every span if tracing isn't otherwise set up.
+func newStageTimer() *stageTimer {
+	timer := &stageTimer{durations: map[string][]time.Duration{}}
+
+	provider, ok := global.TraceProvider().(*sdktrace.Provider)
+	if !ok {
+		var err error
+		provider, err = sdktrace.NewProvider(sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}))
+		if err != nil {
+			kingpin.Fatalf("failed to set up tracing: %v", err)
+		}
+		global.SetTraceProvider(provider)
+	}
+	provider.RegisterSpanProcessor(timer)
+
+	return timer
+}
+
+func (t *stageTimer) start() { t.setActive(true) }
+func (t *stageTimer) stop()  { t.setActive(false) }
+
+func (t *stageTimer) setActive(active bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = active
+}
+
+// stages are the names of every stage timed, sorted.
+func (t *stageTimer) stages() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stages := make([]string, 0, len(t.durations))
+	for stage := range t.durations {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+
+	return stages
+}
+
+func (t *stageTimer) OnStart(*export.SpanData) {}
+
+func (t *stageTimer) OnEnd(span *export.SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.active {
+		t.durations[span.Name] = append(t.durations[span.Name], span.EndTime.Sub(span.StartTime))
+	}
+}
+
+func (t *stageTimer) Shutdown() {}
+
+// benchmarkReport summarises the distribution of each metric measured.
+type benchmarkReport struct {
+	Seed     int64             `json:"seed"`
+	Failures int               `json:"failures"`
+	Metrics  []benchmarkMetric `json:"metrics"`
+}
+
+type benchmarkMetric struct {
+	Name    string `json:"name"`
+	Samples int    `json:"samples"`
+	P50     string `json:"p50"`
+	P95     string `json:"p95"`
+	Max     string `json:"max"`
+}
+
+func (r *benchmarkReport) addDurations(name string, durations []time.Duration) {
+	values := make([]int64, len(durations))
+	for idx, d := range durations {
+		values[idx] = int64(d)
+	}
+
+	r.add(name, values, func(n int64) string { return time.Duration(n).String() })
+}
+
+// add summarises values, skipping metrics that weren't measured at all.
+func (r *benchmarkReport) add(name string, values []int64, format func(int64) string) {
+	if len(values) == 0 {
+		return
+	}
+
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	r.Metrics = append(r.Metrics, benchmarkMetric{
+		Name: name, Samples: len(sorted),
+		P50: format(percentile(sorted, 0.5)), P95: format(percentile(sorted, 0.95)), Max: format(sorted[len(sorted)-1]),
+	})
+}
+
+// percentile takes the nearest rank of p from sorted values.
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+func (r benchmarkReport) write(format string) error {
+	if format == formatJSON {
+		return json.NewEncoder(os.Stdout).Encode(r)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tSAMPLES\tP50\tP95\tMAX")
+	for _, m := range r.Metrics {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", m.Name, m.Samples, m.P50, m.P95, m.Max)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	burnRate           = app.Command("burn-rate", "Report how fast xids are being assigned, and project how long until wraparound")
+	burnRateSource     = burnRate.Flag("source", "Measure the rate from the tracking table, by sampling the xid counter, or auto to prefer the tracking table").Default(xidfortime.BurnRateSourceAuto).Enum(xidfortime.BurnRateSources...)
+	burnRateSchema     = burnRate.Flag("schema", "Schema of the tracking table, as created by init").Default(xidfortime.DefaultTrackingSchema).String()
+	burnRateWindow     = burnRate.Flag("window", "How far back the tracking table is read to measure the rate over").Default("1h").Duration()
+	burnRateSample     = burnRate.Flag("sample", "How long to wait between samples of the xid counter, when not measuring from the tracking table").Default("1m").Duration()
+	burnRateWarnWithin = burnRate.Flag("warn-within", "Exit non-zero when wraparound is projected within this long, for alerting, or never when zero").Duration()
+	burnRateFormat     = burnRate.Flag("format", "Format of the result written to stdout").Default(formatLogfmt).Enum(formatLogfmt, formatJSON)
+)
+
+func runBurnRate(ctx context.Context) {
+	if *burnRateWindow <= 0 || *burnRateSample <= 0 {
+		kingpin.Fatalf("--window and --sample must be positive")
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.TrackingSchema = *burnRateSchema
+
+	rate, err := estimator.BurnRate(ctx, conn, *burnRateSource, *burnRateWindow, *burnRateSample)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := writeBurnRate(rate); err != nil {
+		kingpin.Fatalf("failed to write result: %v", err)
+	}
+
+	until, ok := rate.UntilWraparound()
+	if *burnRateWarnWithin > 0 && ok && until < *burnRateWarnWithin {
+		level.Warn(logger).Log("event", "wraparound_approaching", "until_wraparound", until.Round(time.Second),
+			"oldest_database", rate.OldestDatabase, "frozen_xid_age", rate.FrozenXIDAge)
+		kingpin.Fatalf("wraparound projected within %s, sooner than --warn-within %s", until.Round(time.Second), *burnRateWarnWithin)
+	}
+}
+
+// projection formats a projected duration, which is never while no xids are
+// being assigned.
+func projection(until time.Duration, ok bool) string {
+	if !ok {
+		return "never"
+	}
+
+	return until.Round(time.Second).String()
+}
+
+func writeBurnRate(rate xidfortime.BurnRate) error {
+	untilWraparound := projection(rate.UntilWraparound())
+	untilFreezeMaxAge := projection(rate.UntilFreezeMaxAge())
+
+	if *burnRateFormat == formatJSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			xidfortime.BurnRate
+			PerSecond         float64 `json:"xids_per_second"`
+			PerHour           float64 `json:"xids_per_hour"`
+			UntilWraparound   string  `json:"until_wraparound"`
+			UntilFreezeMaxAge string  `json:"until_freeze_max_age"`
+		}{rate, rate.PerSecond(), rate.PerHour(), untilWraparound, untilFreezeMaxAge})
+	}
+
+	return kitlog.NewLogfmtLogger(os.Stdout).Log("source", rate.Source, "from", rate.From, "to", rate.To, "xids", rate.XIDs,
+		"xids_per_second", fmt.Sprintf("%.2f", rate.PerSecond()), "xids_per_hour", fmt.Sprintf("%.0f", rate.PerHour()),
+		"oldest_database", rate.OldestDatabase, "frozen_xid_age", rate.FrozenXIDAge, "xids_remaining", rate.Remaining,
+		"until_wraparound", untilWraparound, "until_freeze_max_age", untilFreezeMaxAge)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// cancelTimeout bounds how long we wait to deliver cancel requests on the way
+// out, so an unreachable server can't stop us exiting.
+const cancelTimeout = 5 * time.Second
+
+// busyBackends tracks the connections checked out of the pool, so that on an
+// interrupt we can ask Postgres to cancel whatever they are running. Cancelling
+// a context alone closes the connection, leaving the backend's query running
+// until it next tries to write to us.
+var busyBackends = &backends{conns: map[*pgconn.PgConn]struct{}{}}
+
+type backends struct {
+	mu    sync.Mutex
+	conns map[*pgconn.PgConn]struct{}
+}
+
+// acquired is a pgxpool BeforeAcquire hook. The pool destroys broken
+// connections without releasing them, so those stay tracked, but cancelling a
+// backend that has gone away is harmless.
+func (b *backends) acquired(ctx context.Context, conn *pgx.Conn) bool {
+	b.mu.Lock()
+	b.conns[conn.PgConn()] = struct{}{}
+	b.mu.Unlock()
+
+	return true
+}
+
+// released is a pgxpool AfterRelease hook.
+func (b *backends) released(conn *pgx.Conn) bool {
+	b.mu.Lock()
+	delete(b.conns, conn.PgConn())
+	b.mu.Unlock()
+
+	return true
+}
+
+// cancel sends a cancel request for each busy connection, waiting until each
+// has been delivered or cancelTimeout passes.
+func (b *backends) cancel() {
+	b.mu.Lock()
+	conns := make([]*pgconn.PgConn, 0, len(b.conns))
+	for conn := range b.conns {
+		conns = append(conns, conn)
+	}
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *pgconn.PgConn) {
+			defer wg.Done()
+			if err := conn.CancelRequest(ctx); err != nil {
+				level.Warn(logger).Log("event", "cancel_request_failed", "pid", conn.PID(), "error", err)
+				return
+			}
+
+			level.Info(logger).Log("event", "cancelled_backend", "pid", conn.PID())
+		}(conn)
+	}
+	wg.Wait()
+}
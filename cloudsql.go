@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/proxy"
+	"github.com/jackc/pgx/v4"
+)
+
+// dialCloudSQL routes the connection through the Cloud SQL proxy client, using
+// application default credentials. The proxy provides its own TLS tunnel to the
+// instance, so pgx must not attempt to negotiate TLS on top.
+func dialCloudSQL(ctx context.Context, cfg *pgx.ConnConfig, instance string) error {
+	if err := proxy.InitDefault(ctx); err != nil {
+		return err
+	}
+
+	cfg.TLSConfig = nil
+	cfg.Fallbacks = nil
+	cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return proxy.Dial(instance)
+	}
+
+	return nil
+}
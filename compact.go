@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// compactionFlags are how to compact the tracking table, for both compact and
+// the automatic compaction of record.
+type compactionFlags struct {
+	tiers  *[]string
+	retain *time.Duration
+}
+
+func addCompactionFlags(cmd *kingpin.CmdClause) compactionFlags {
+	return compactionFlags{
+		tiers:  cmd.Flag("thin", "Thin samples older than AFTER to one per RESOLUTION, as RESOLUTION:AFTER, repeatable").Default("1h:168h").Strings(),
+		retain: cmd.Flag("retain", "Delete samples older than this, or keep them forever when zero").Duration(),
+	}
+}
+
+func (f compactionFlags) parse() ([]xidfortime.CompactionTier, error) {
+	tiers := make([]xidfortime.CompactionTier, 0, len(*f.tiers))
+	for _, s := range *f.tiers {
+		tier, err := xidfortime.ParseCompactionTier(s)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, nil
+}
+
+var (
+	compact           = app.Command("compact", "Thin old samples of the tracking table to a coarser resolution, and delete expired ones")
+	compactSchema     = compact.Flag("schema", "Schema of the tracking table, as created by init").Default(xidfortime.DefaultTrackingSchema).String()
+	compactCompaction = addCompactionFlags(compact)
+)
+
+func runCompact(ctx context.Context) {
+	tiers, err := compactCompaction.parse()
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	compaction, err := xidfortime.CompactTracking(ctx, pool, *compactSchema, tiers, *compactCompaction.retain)
+	if err != nil {
+		fatal(err)
+	}
+
+	level.Info(logger).Log("event", "compacted_tracking_table", "thinned", compaction.Thinned, "expired", compaction.Expired)
+}
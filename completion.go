@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	completion      = app.Command("completion", "Print a shell completion script, to be sourced from your shell's startup file")
+	completionShell = completion.Arg("shell", "Shell to complete for").Required().Enum("bash", "zsh", "fish")
+)
+
+// completeTablesTimeout bounds how long we'll hold up the shell trying to list
+// tables for completion.
+const completeTablesTimeout = 2 * time.Second
+
+// fishCompletionTemplate asks us for completions of the words typed so far,
+// as kingpin's bash and zsh templates do.
+var fishCompletionTemplate = `# fish completion for {{.App.Name}}
+# Source with: {{.App.Name}} completion fish | source
+complete -c {{.App.Name}} -f -a '({{.App.Name}} --completion-bash (commandline -opc)[2..-1] (commandline -ct))'
+`
+
+// Table hints are registered here rather than with the args, as completeTables
+// reads flags declared after them, and referencing it would reorder the
+// initialisation of the args.
+func init() {
+	estimate.GetArg("table").HintAction(completeTables)
+	timeForXID.GetArg("table").HintAction(completeTables)
+	verifyAccuracy.GetArg("table").HintAction(completeTables)
+	benchmark.GetArg("table").HintAction(completeTables)
+	preflight.GetArg("table").HintAction(completeTables)
+	restorePgbackrest.GetArg("table").HintAction(completeTables)
+	restoreBarman.GetArg("table").HintAction(completeTables)
+	restoreWALG.GetArg("table").HintAction(completeTables)
+	fromWALDump.GetFlag("check-table").HintAction(completeTables)
+}
+
+func runCompletion() {
+	source := map[string]string{
+		"bash": kingpin.BashCompletionTemplate,
+		"zsh":  kingpin.ZshCompletionTemplate,
+		"fish": fishCompletionTemplate,
+	}[*completionShell]
+
+	tmpl, err := template.New(*completionShell).Parse(source)
+	if err != nil {
+		fatal(err)
+	}
+
+	data := struct{ App struct{ Name string } }{}
+	data.App.Name = app.Name
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
+		kingpin.Fatalf("failed to write completion script: %v", err)
+	}
+}
+
+// completeTables lists candidate tables for completion, but only when the
+// connection was configured explicitly, as connecting to a default local
+// database while typing a production table name helps nobody. Any failure
+// completes nothing.
+func completeTables() []string {
+	if *dsn == "" && *service == "" && *host == "" {
+		return nil
+	}
+
+	// Completion runs before main builds the logger
+	logger = kitlog.NewNopLogger()
+
+	ctx, cancel := context.WithTimeout(context.Background(), completeTablesTimeout)
+	defer cancel()
+
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	candidates, err := xidfortime.SuggestTables(ctx, conn)
+	if err != nil {
+		return nil
+	}
+
+	tables := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		tables = append(tables, fmt.Sprintf("%s.%s", c.Schema, c.Table))
+	}
+
+	return tables
+}
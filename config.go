@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = app.Flag("config", "Config file of named targets, defaulting to ~/.config/xid-for-time/config.yaml").Envar("XID_FOR_TIME_CONFIG").String()
+	targetName = app.Flag("target", "Named target from the config file providing the connection, table, columns and strategy").Envar("XID_FOR_TIME_TARGET").String()
+)
+
+// config is read from the config file, where each target bundles the settings
+// for estimating against one table, such as:
+//
+//	default_target: prod-events
+//	targets:
+//	  prod-events:
+//	    service: prod
+//	    table: events
+//	    time_column: inserted_at
+type config struct {
+	DefaultTarget string            `yaml:"default_target"`
+	Targets       map[string]target `yaml:"targets"`
+}
+
+type target struct {
+	DSN        string `yaml:"dsn"`
+	Service    string `yaml:"service"`
+	Host       string `yaml:"host"`
+	Port       uint16 `yaml:"port"`
+	Database   string `yaml:"database"`
+	User       string `yaml:"user"`
+	SSLMode    string `yaml:"sslmode"`
+	Table      string `yaml:"table"`
+	IDColumn   string `yaml:"id_column"`
+	TimeColumn string `yaml:"time_column"`
+	Strategy   string `yaml:"strategy"`
+	Where      string `yaml:"where"`
+}
+
+// defaultConfigFile follows the XDG base directory spec, on every platform.
+func defaultConfigFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "xid-for-time", "config.yaml"), nil
+}
+
+// applyTarget fills in whatever flags were left unset, or at their defaults,
+// from the chosen target. When the target names a table, every argument of
+// the command is taken as a target time or xid instead.
+func applyTarget(command string) error {
+	path, explicit := *configFile, *configFile != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigFile(); err != nil {
+			return nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit && *targetName == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	name := *targetName
+	if name == "" {
+		name = cfg.DefaultTarget
+	}
+	if name == "" {
+		return nil
+	}
+
+	t, ok := cfg.Targets[name]
+	if !ok {
+		return fmt.Errorf("no target named %q in %s", name, path)
+	}
+
+	applyDefault(dsn, t.DSN)
+	applyDefault(service, t.Service)
+	applyDefault(host, t.Host)
+	applyDefault(database, t.Database)
+	applyDefault(user, t.User)
+	applyDefault(sslMode, t.SSLMode)
+	if *port == 0 {
+		*port = t.Port
+	}
+
+	switch command {
+	case estimate.FullCommand():
+		applyTargetTable(t, table, targetTimes)
+		applyTargetSetting(idColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+		applyTargetSetting(timeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+		applyTargetSetting(strategy, xidfortime.StrategyAuto, t.Strategy)
+		applyTargetSetting(where, "", t.Where)
+	case timeForXID.FullCommand():
+		if t.Table != "" && *timeForXIDTable != "" {
+			*timeForXIDXID = *timeForXIDTable
+		}
+		applyTargetSetting(timeForXIDTable, "", t.Table)
+		applyTargetSetting(timeForXIDIDColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+		applyTargetSetting(timeForXIDTimeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+		applyTargetSetting(timeForXIDStrategy, xidfortime.StrategyAuto, t.Strategy)
+	case benchmark.FullCommand():
+		applyTargetSetting(benchmarkTable, "", t.Table)
+		applyTargetSetting(benchmarkIDColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+		applyTargetSetting(benchmarkTimeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+		applyTargetSetting(benchmarkStrategy, xidfortime.StrategyAuto, t.Strategy)
+	case verifyAccuracy.FullCommand():
+		applyTargetTable(t, verifyAccuracyTable, verifyAccuracyTimes)
+		applyTargetSetting(verifyAccuracyIDColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+		applyTargetSetting(verifyAccuracyTimeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+		applyTargetSetting(verifyAccuracyStrategy, xidfortime.StrategyAuto, t.Strategy)
+	case preflight.FullCommand():
+		applyTargetSetting(preflightTable, "", t.Table)
+		applyTargetSetting(preflightIDColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+		applyTargetSetting(preflightTimeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+	case restorePgbackrest.FullCommand():
+		applyRestoreTarget(t, restorePgbackrestTable, restorePgbackrestTime)
+	case restoreBarman.FullCommand():
+		applyRestoreTarget(t, restoreBarmanTable, restoreBarmanTime)
+	case restoreWALG.FullCommand():
+		applyRestoreTarget(t, restoreWALGTable, restoreWALGTime)
+	}
+
+	return nil
+}
+
+// applyTargetTable takes the table from the target, shifting what kingpin
+// parsed as the table onto the target times.
+func applyTargetTable(t target, table *string, times *[]string) {
+	if t.Table == "" {
+		return
+	}
+
+	if *table != "" {
+		*times = append([]string{*table}, *times...)
+	}
+	*table = t.Table
+}
+
+// applyRestoreTarget takes the table and settings from the target for a restore
+// subcommand, shifting what kingpin parsed as the table onto the target time.
+func applyRestoreTarget(t target, table, targetTime *string) {
+	if t.Table != "" && *table != "" {
+		*targetTime = *table
+	}
+	applyTargetSetting(table, "", t.Table)
+	applyTargetSetting(restoreIDColumn, xidfortime.DefaultIDColumn, t.IDColumn)
+	applyTargetSetting(restoreTimeColumn, xidfortime.DefaultTimeColumn, t.TimeColumn)
+	applyTargetSetting(restoreStrategy, xidfortime.StrategyAuto, t.Strategy)
+}
+
+// applyTargetSetting uses the target's value for a flag left at its default.
+func applyTargetSetting(value *string, fallback, configured string) {
+	if configured != "" && *value == fallback {
+		*value = configured
+	}
+}
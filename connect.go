@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/api/global"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Defaults for the connection flags, which apply only when not connecting to a
+// service: the service file should otherwise provide them.
+const (
+	defaultHost     = "127.0.0.1"
+	defaultPort     = 5432
+	defaultDatabase = "postgres"
+	defaultUser     = "postgres"
+)
+
+// applicationName identifies our sessions in pg_stat_activity, unless
+// --application-name or the connection string names another.
+const applicationName = "xid-for-time/" + version
+
+// connect opens a connection pool using the connection flags, or --dsn when
+// given. Anything not set by either, such as PGPASSWORD or a password in
+// ~/.pgpass, is resolved by pgx in the same way as libpq.
+func connect(ctx context.Context) (*pgxpool.Pool, error) {
+	return dial(ctx, nil)
+}
+
+// connectNode connects to another node of the cluster, such as a Citus worker,
+// with the same settings as connect but for the host and port.
+func connectNode(ctx context.Context, host string, port int) (*pgxpool.Pool, error) {
+	return dial(ctx, func(cfg *pgxpool.Config) {
+		cfg.ConnConfig.Host, cfg.ConnConfig.Port, cfg.ConnConfig.Fallbacks = host, uint16(port), nil
+	})
+}
+
+// connectDSN connects to another endpoint given by a connection string, such
+// as a replica to cross-check against, with the same settings as connect.
+func connectDSN(ctx context.Context, connStr string) (*pgxpool.Pool, error) {
+	other, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return dial(ctx, func(cfg *pgxpool.Config) {
+		cfg.ConnConfig = other.ConnConfig
+	})
+}
+
+// connectWritableDSN connects as connectDSN does, but for recording results to
+// a database of their own, without making the session read only.
+func connectWritableDSN(ctx context.Context, connStr string) (*pgxpool.Pool, error) {
+	other, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return dial(ctx, func(cfg *pgxpool.Config) {
+		cfg.ConnConfig = other.ConnConfig
+		cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "off"
+	})
+}
+
+func dial(ctx context.Context, configure func(*pgxpool.Config)) (*pgxpool.Pool, error) {
+	poolCfg, err := poolConfig(ctx, configure)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := poolCfg.ConnConfig
+	level.Info(logger).Log("event", "connect", "dbname", cfg.Database, "host", cfg.Host, "port", cfg.Port, "user", cfg.User)
+
+	ctx, span := global.Tracer(tracerName).Start(ctx, "connect")
+	defer span.End()
+
+	var pool *pgxpool.Pool
+	err = retryPolicy().Do(ctx, logger, "connect", func() (err error) {
+		pool, err = pgxpool.ConnectConfig(ctx, poolCfg)
+		return err
+	})
+
+	if err != nil {
+		return nil, connectionError{err}
+	}
+
+	return pool, nil
+}
+
+// connectWritable connects as connect does, but for commands that manage or
+// record to the tracking table, without making the session read only.
+func connectWritable(ctx context.Context) (*pgxpool.Pool, error) {
+	return dial(ctx, func(cfg *pgxpool.Config) {
+		cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "off"
+	})
+}
+
+// connectReplication opens a physical replication connection, with the same
+// settings as connect.
+func connectReplication(ctx context.Context) (*pgconn.PgConn, error) {
+	poolCfg, err := poolConfig(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	level.Info(logger).Log("event", "connect", "host", poolCfg.ConnConfig.Host, "port", poolCfg.ConnConfig.Port,
+		"user", poolCfg.ConnConfig.User, "replication", true)
+
+	var conn *pgconn.PgConn
+	err = retryPolicy().Do(ctx, logger, "connect_replication", func() (err error) {
+		connCfg := poolCfg.ConnConfig.Copy()
+		if poolCfg.BeforeConnect != nil {
+			if err := poolCfg.BeforeConnect(ctx, connCfg); err != nil {
+				return err
+			}
+		}
+
+		cfg := connCfg.Config.Copy()
+		cfg.RuntimeParams["replication"] = "true"
+		conn, err = pgconn.ConnectConfig(ctx, cfg)
+		return err
+	})
+
+	if err != nil {
+		return nil, connectionError{err}
+	}
+
+	return conn, nil
+}
+
+// poolConfig builds the configuration for connecting with the connection
+// flags, or --dsn when given.
+func poolConfig(ctx context.Context, configure func(*pgxpool.Config)) (*pgxpool.Config, error) {
+	connStr := *dsn
+	if connStr == "" {
+		if *service == "" {
+			applyDefault(host, defaultHost)
+			applyDefault(database, defaultDatabase)
+			applyDefault(user, defaultUser)
+			if *port == 0 {
+				*port = defaultPort
+			}
+		}
+
+		var portString string
+		if *port != 0 {
+			portString = fmt.Sprintf("%d", *port)
+		}
+
+		var settings [][2]string
+		for _, setting := range [][2]string{
+			{"service", *service},
+			{"host", *host},
+			{"port", portString},
+			{"database", *database},
+			{"user", *user},
+			{"passfile", *passfile},
+			{"sslmode", *sslMode},
+			{"sslrootcert", *sslRootCert},
+			{"sslcert", *sslCert},
+			{"sslkey", *sslKey},
+		} {
+			if setting[1] != "" {
+				settings = append(settings, setting)
+			}
+		}
+
+		connStr = connString(settings)
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(*patroniURLs) > 0 {
+		if err := dialPatroni(ctx, poolCfg.ConnConfig, *patroniURLs, *patroniRole); err != nil {
+			return nil, err
+		}
+	}
+	if configure != nil {
+		configure(poolCfg)
+	}
+
+	poolCfg.MaxConns = int32(*maxConns)
+	poolCfg.BeforeAcquire = busyBackends.acquired
+	poolCfg.AfterRelease = busyBackends.released
+	cfg := poolCfg.ConnConfig
+
+	switch {
+	case *awsIAMAuth:
+		// Tokens expire after 15 minutes, so each connection needs its own
+		poolCfg.BeforeConnect = func(ctx context.Context, cfg *pgx.ConnConfig) (err error) {
+			if cfg.Password, err = rdsAuthToken(cfg, *awsRegion); err != nil {
+				return fmt.Errorf("failed to generate RDS IAM auth token: %w", err)
+			}
+
+			return nil
+		}
+	case *passwordPrompt:
+		if cfg.Password, err = promptPassword(); err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	// Estimates only ever read, and making the session read only lets DBAs check
+	// we can't do anything else. PgBouncer rejects startup parameters it doesn't
+	// know, so behind it the transactions estimates run in are read only instead,
+	// and sessions are read-write by default, so need no parameter to be.
+	_, readOnlySet := cfg.RuntimeParams["default_transaction_read_only"]
+	switch {
+	case *simpleProtocol && cfg.RuntimeParams["default_transaction_read_only"] == "off":
+		delete(cfg.RuntimeParams, "default_transaction_read_only")
+	case !*simpleProtocol && !readOnlySet:
+		cfg.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+	if *searchPath != "" {
+		cfg.RuntimeParams["search_path"] = *searchPath
+	}
+	switch {
+	case *appName != "":
+		cfg.RuntimeParams["application_name"] = *appName
+	case cfg.RuntimeParams["application_name"] == "":
+		cfg.RuntimeParams["application_name"] = applicationName
+	}
+
+	// Operators log in as themselves, then act as a role granted no more than
+	// estimates need
+	if *role != "" {
+		setRole := "set role " + pgx.Identifier{*role}.Sanitize()
+		poolCfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			if _, err := conn.Exec(ctx, setRole); err != nil {
+				return fmt.Errorf("failed to set role %s: %w", *role, err)
+			}
+
+			return nil
+		}
+	}
+
+	// PgBouncer in transaction pooling mode can't route prepared statements back
+	// to the backend that prepared them, so avoid creating any.
+	if *simpleProtocol {
+		cfg.PreferSimpleProtocol = true
+		cfg.BuildStatementCache = nil
+	}
+
+	if *verbose {
+		cfg.Logger = sqlLogger{logger}
+		cfg.LogLevel = pgx.LogLevelInfo
+	}
+	if activeReport != nil {
+		cfg.Logger = reportQueryLogger{report: activeReport, next: cfg.Logger}
+		cfg.LogLevel = pgx.LogLevelInfo
+	}
+
+	if *sshHost != "" {
+		if err := dialSSH(cfg, *sshHost, *sshUser, *sshKey, *sshKnownHosts); err != nil {
+			return nil, err
+		}
+	}
+
+	if *cloudSQLInstance != "" {
+		if err := dialCloudSQL(ctx, cfg, *cloudSQLInstance); err != nil {
+			return nil, fmt.Errorf("failed to initialise Cloud SQL dialer: %w", err)
+		}
+		cfg.Host = *cloudSQLInstance
+	}
+
+	return poolCfg, nil
+}
+
+func applyDefault(value *string, fallback string) {
+	if *value == "" {
+		*value = fallback
+	}
+}
+
+// connString renders settings as a libpq keyword/value connection string,
+// quoting each value so it may contain spaces or quotes.
+func connString(settings [][2]string) string {
+	pairs := make([]string, 0, len(settings))
+	for _, setting := range settings {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(setting[1])
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", setting[0], value))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// confirm asks a yes or no question on the terminal, answering no when stdin
+// isn't one. The prompt goes to stderr, as promptPassword's does.
+func confirm(question string) bool {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// prompted caches the password entered at the prompt, as every connection
+// needs it.
+var prompted struct {
+	once     sync.Once
+	password string
+	err      error
+}
+
+// promptPassword reads a password from the terminal without echoing it, only
+// prompting the first time. The prompt goes to stderr so it doesn't pollute
+// the result on stdout.
+func promptPassword() (string, error) {
+	prompted.once.Do(func() {
+		// Typing the password into stdin would mix it with whatever else is
+		// read from there, such as target times
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			prompted.err = fmt.Errorf("--password-prompt needs stdin to be a terminal, so can't be used with target times read from stdin, use PGPASSWORD or --passfile instead")
+			return
+		}
+
+		fmt.Fprint(os.Stderr, "Password: ")
+		defer fmt.Fprintln(os.Stderr)
+
+		password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		prompted.password, prompted.err = string(password), err
+	})
+
+	return prompted.password, prompted.err
+}
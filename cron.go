@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	cron          = app.Command("cron", "Schedule recording samples to the tracking table with pg_cron, so no daemon is needed")
+	cronJob       = cron.Flag("job-name", "Name of the pg_cron job").Default(xidfortime.DefaultCronJob).String()
+	cronInstall   = cron.Command("install", "Schedule the job, updating it if it already exists")
+	cronSchema    = cronInstall.Flag("schema", "Schema of the tracking table, as created by init").Default(xidfortime.DefaultTrackingSchema).String()
+	cronSchedule  = cronInstall.Flag("schedule", "pg_cron schedule to record on, in cron syntax or as '30 seconds'").Default("* * * * *").String()
+	cronUninstall = cron.Command("uninstall", "Remove the job, if it exists")
+)
+
+func runCronInstall(ctx context.Context) {
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	id, err := xidfortime.ScheduleRecording(ctx, pool, *cronSchema, *cronJob, *cronSchedule)
+	if err != nil {
+		fatal(err)
+	}
+
+	level.Info(logger).Log("event", "scheduled_recording", "job", *cronJob, "job_id", id, "schedule", *cronSchedule)
+}
+
+func runCronUninstall(ctx context.Context) {
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	removed, err := xidfortime.UnscheduleRecording(ctx, pool, *cronJob)
+	if err != nil {
+		fatal(err)
+	}
+
+	level.Info(logger).Log("event", "unscheduled_recording", "job", *cronJob, "removed", removed)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// crossChecker runs each estimate again against the --also-check endpoint,
+// such as a replica, warning wherever the two disagree. A replica that has
+// diverged from its primary, or whose statistics differ enough to pick other
+// rows, would otherwise give a different answer without anyone noticing.
+type crossChecker struct {
+	pool      *pgxpool.Pool
+	estimator *xidfortime.Estimator
+}
+
+// newCrossChecker connects to connStr, estimating there with the settings of
+// estimator but its own cache, as the endpoints have their own statistics.
+func newCrossChecker(ctx context.Context, connStr string, estimator *xidfortime.Estimator) (*crossChecker, error) {
+	pool, err := connectDSN(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	other := *estimator
+	other.Logger = kitlog.With(logger, "endpoint", "also-check")
+	other.Cache = xidfortime.NewCache()
+
+	return &crossChecker{pool: pool, estimator: &other}, nil
+}
+
+func (c *crossChecker) Close() {
+	c.pool.Close()
+}
+
+// check estimates for the same target as result, logging any divergence. It
+// only ever logs, leaving the estimate from the main endpoint to stand.
+func (c *crossChecker) check(ctx context.Context, table string, result xidfortime.Result) {
+	other, err := c.estimator.EstimateXID(ctx, c.pool, table, result.TargetTime.Add(c.estimator.Slack))
+	if err != nil {
+		level.Warn(logger).Log("event", "cross_check_failed", "target_time", result.TargetTime, "error", err)
+		return
+	}
+
+	diverged := divergence(result, other)
+	if len(diverged) == 0 {
+		level.Info(logger).Log("event", "cross_checked", "target_time", result.TargetTime, "xid", result.XID())
+		return
+	}
+
+	keyvals := append([]interface{}{"event", "estimates_diverged", "target_time", result.TargetTime}, diverged...)
+	keyvals = append(keyvals, "strategy", result.Strategy, "also_check_strategy", other.Strategy)
+	level.Warn(logger).Log(keyvals...)
+}
+
+// divergence lists where two estimates for the same target differ, as pairs of
+// keys and the values from each endpoint.
+func divergence(result, other xidfortime.Result) []interface{} {
+	var diverged []interface{}
+	for _, field := range []struct {
+		key         string
+		value, also string
+	}{
+		{"xid", result.XID(), other.XID()},
+		{"before_id", result.Before.ID, other.Before.ID},
+		{"before_xmin", result.Before.XMin, other.Before.XMin},
+		{"exceeded_id", result.Exceeded.ID, other.Exceeded.ID},
+		{"exceeded_xmin", result.Exceeded.XMin, other.Exceeded.XMin},
+	} {
+		if field.value != field.also {
+			diverged = append(diverged, field.key, fmt.Sprintf("%s != %s", field.value, field.also))
+		}
+	}
+
+	return diverged
+}
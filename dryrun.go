@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// runDryRun prints the queries an estimate could run, having connected only to
+// check the table, columns and any target times are valid.
+func runDryRun(ctx context.Context, conn xidfortime.Querier, estimator *xidfortime.Estimator) {
+	if err := estimator.ValidateRelation(ctx, conn, *table); err != nil {
+		fatal(err)
+	}
+
+	for _, input := range append(*targetTimes, *from, *to) {
+		if input == "" {
+			continue
+		}
+		if _, err := parseTargetTime(ctx, conn, input); err != nil {
+			fatal(err)
+		}
+	}
+
+	queries, err := estimator.Queries(*table)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *format == formatJSON {
+		err = json.NewEncoder(os.Stdout).Encode(queries)
+	} else {
+		for _, query := range queries {
+			if _, err = fmt.Printf("-- %s\n%s\n\n", query.Name, strings.TrimSpace(query.SQL)); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		kingpin.Fatalf("failed to write queries: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// Snippets that --emit can print in place of the result
+const (
+	emitRecoveryConf = "recovery-conf"
+	emitRecoveryLSN  = "recovery-lsn"
+)
+
+var emits = []string{emitRecoveryConf, emitRecoveryLSN}
+
+// recoverySettingsVersion is the first server_version_num to read recovery
+// settings from postgresql.conf, with recovery.signal requesting recovery,
+// rather than from recovery.conf.
+const recoverySettingsVersion = 120000
+
+// recoveryTarget is the xid a point-in-time restore to the estimate should
+// stop at. Recovery stops just before the first transaction known to follow
+// the target commits, so everything committed before the target is kept.
+// Exact estimates, and those beyond the head of the table, have no such
+// transaction, and instead stop once the estimated xid commits.
+func recoveryTarget(result xidfortime.Result) (xid string, inclusive bool) {
+	xid, inclusive = result.UpperXID(), false
+	if result.CommittedXID != "" || result.BeyondHead || xid == "" {
+		xid, inclusive = result.XID(), true
+	}
+
+	return xid, inclusive
+}
+
+// writeRecoveryConf prints the recovery target settings for a point-in-time
+// restore to the estimate, for the file the server version reads them from.
+func writeRecoveryConf(out io.Writer, server xidfortime.Server, result xidfortime.Result) error {
+	xid, inclusive := recoveryTarget(result)
+	return writeRecoverySettings(out, server, result, "recovery_target_xid", xid, inclusive)
+}
+
+// writeRecoveryLSN prints the same settings as writeRecoveryConf, but targeting
+// the LSN of the commit record for managed services and restore tools that
+// only accept LSNs. Recovery stops before or after the record starting there.
+func writeRecoveryLSN(out io.Writer, server xidfortime.Server, result xidfortime.Result, lsn string) error {
+	_, inclusive := recoveryTarget(result)
+	return writeRecoverySettings(out, server, result, "recovery_target_lsn", lsn, inclusive)
+}
+
+func writeRecoverySettings(out io.Writer, server xidfortime.Server, result xidfortime.Result, setting, target string, inclusive bool) error {
+	file := "recovery.conf"
+	if server.Version >= recoverySettingsVersion {
+		file = "postgresql.auto.conf, and create recovery.signal in the data directory"
+	}
+
+	_, err := fmt.Fprintf(out, `# Recover to %s, in %s
+%s = '%s'
+recovery_target_inclusive = %t
+`, result.TargetTime.Format(time.RFC3339Nano), file, setting, target, inclusive)
+	return err
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	estimate = app.Command("estimate", "Estimate the last xid that committed before time").Default()
+
+	table             = estimate.Arg("table", "Table to use for estimates, unless given by --target").String()
+	targetTimes       = estimate.Arg("time", "Target times to compute xids for, read one per line from stdin if none are given").Strings()
+	idColumn          = estimate.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	timeColumn        = estimate.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	schema            = estimate.Flag("schema", "Schema of the table when not qualified, rather than the first on the search_path holding one by that name").String()
+	where             = estimate.Flag("where", "SQL condition rows must match to be probed, excluding those whose times don't reflect when they were inserted").String()
+	strategy          = estimate.Flag("strategy", "Force a strategy rather than picking the cheapest viable one").Default(xidfortime.StrategyAuto).Enum(append([]string{xidfortime.StrategyAuto}, xidfortime.StrategyNames...)...)
+	trackingSchema    = estimate.Flag("tracking-schema", "Schema of the tracking table, whose samples are preferred for the times they cover").Default(xidfortime.DefaultTrackingSchema).String()
+	exact             = estimate.Flag("exact", "Require an exact answer from commit timestamps (track_commit_timestamp=on)").Bool()
+	refine            = estimate.Flag("refine", "Bisect the id range between histogram bounds before probing").Bool()
+	tolerance         = estimate.Flag("tolerance", "Keep narrowing until the rows either side of the target are within this duration").Duration()
+	verify            = estimate.Flag("verify", "Check the xid committed, walking back to one that did if not").Default("true").Bool()
+	updatePolicy      = estimate.Flag("update-policy", "Whether to warn, refuse or sample nearby rows when the table is heavily updated").Default(xidfortime.UpdatePolicyWarn).Enum(xidfortime.UpdatePolicies...)
+	updateRatio       = estimate.Flag("update-ratio", "Ratio of updates to inserts above which a table is heavily updated").Default("0.1").Float64()
+	replicaLagPolicy  = estimate.Flag("replica-lag-policy", "Whether to warn, refuse or wait when a standby hasn't replayed past the target time").Default(xidfortime.ReplicaLagPolicyWarn).Enum(xidfortime.ReplicaLagPolicies...)
+	replicaWait       = estimate.Flag("replica-wait", "How long --replica-lag-policy=wait waits for the standby to replay past the target time").Default(xidfortime.DefaultReplicaWait.String()).Duration()
+	correlationPolicy = estimate.Flag("correlation-policy", "Whether to warn or refuse when id order is poorly correlated with insertion time").Default(xidfortime.CorrelationPolicyWarn).Enum(xidfortime.CorrelationPolicies...)
+	minCorrelation    = estimate.Flag("min-correlation", "Correlation of id order with insertion time below which the histogram strategy isn't trusted").Default("0.9").Float64()
+	sampleCorrelation = estimate.Flag("sample-correlation", "Also rank a sample of rows by id and time to check their correlation").Bool()
+	slack             = estimate.Flag("slack", "Move each target time earlier by this much before estimating, for a conservative recovery point").Duration()
+	skewWindow        = estimate.Flag("skew-window", "Scan this many rows either side of the threshold for the newest xmin before the target, tolerating skewed clocks").Default("0").Int()
+	maxAnalyzeAge     = estimate.Flag("max-analyze-age", "Warn when the table was last analyzed this long before the target time").Default(xidfortime.DefaultMaxAnalyzeAge.String()).Duration()
+	analyze           = estimate.Flag("analyze", "ANALYZE the id and time columns of the table before estimating, after confirming").Bool()
+	setStatistics     = estimate.Flag("set-statistics", "ANALYZE as --analyze with the statistics target of the id column raised to this for a finer histogram, restoring the previous target after, between 1 and 10000, or 0 not to").Int()
+	yes               = estimate.Flag("yes", "Don't ask for confirmation before --analyze or --set-statistics").Short('y').Bool()
+	samplePercent     = estimate.Flag("sample-percent", "Percentage of the table sampled when the id column has no histogram").Default("1").Float64()
+	format            = estimate.Flag("format", "Format of the result written to stdout").Default(formatLogfmt).Enum(formats...)
+	xidWidth          = estimate.Flag("xid-width", "Print the 32-bit xid or the epoch-qualified xid8 with --format=xid").Default(xidWidth32).Enum(xidWidth32, xidWidth64)
+	emit              = estimate.Flag("emit", "Print a configuration snippet for the estimate instead of the result, such as recovery-conf for a point-in-time restore").Enum(emits...)
+	formatTemplate    = estimate.Flag("format-template", "Go template used to render the result to stdout, overriding --format").String()
+	from              = estimate.Flag("from", "Start of a window to find the xid range of, instead of target times").String()
+	to                = estimate.Flag("to", "End of the window started by --from").String()
+	txidSnapshot      = estimate.Flag("txid-snapshot", "Also approximate the txid_snapshot (xmin:xmax:xip_list) a transaction would have seen at the target time, from commit timestamps").Bool()
+	explain           = estimate.Flag("explain", "Run EXPLAIN for each query before running it, including the plans in the output").Bool()
+	maxCost           = estimate.Flag("max-cost", "Refuse to run any query the planner expects to cost more than this, such as 10000000, or 0 to disable").Default("0").Float64()
+	maxRows           = estimate.Flag("max-rows", "Refuse to run any query the planner expects to return more rows than this, or 0 to disable").Default("0").Float64()
+	force             = estimate.Flag("force", "Warn rather than refuse when a query exceeds --max-cost or --max-rows").Bool()
+	statementTimeout  = estimate.Flag("statement-timeout", "SET LOCAL statement_timeout around each query, bounding how long any one can run").Duration()
+	lockTimeout       = estimate.Flag("lock-timeout", "SET LOCAL lock_timeout around each query").Duration()
+	alsoCheck         = estimate.Flag("also-check", "Connection string of a second endpoint, such as a replica, to run each estimate against too, warning wherever the two diverge").String()
+	recordTo          = estimate.Flag("record-to", "Connection string of a database to insert every result into, for an auditable history of the recovery points computed").String()
+	recordToSchema    = estimate.Flag("record-to-schema", "Schema of the results table in the --record-to database, created there if missing").Default(xidfortime.DefaultTrackingSchema).String()
+	reportPath        = estimate.Flag("report", "Write a JSON report of everything the run did to this file, from the inputs and every query to the warnings and results").String()
+	shardDSNs         = estimate.Flag("shard", "Shard holding the same table, as host[:port] or a connection string, repeated for each to estimate on every shard for the same target times").Strings()
+	dryRun            = estimate.Flag("dry-run", "Validate the table and target times, then print every query an estimate could run without running them").Bool()
+	quiet             = estimate.Flag("quiet", "Suppress logs, printing only the xid to stdout").Short('q').Bool()
+)
+
+func runEstimate(ctx context.Context) {
+	if *quiet {
+		logger = kitlog.NewNopLogger()
+		*format = formatXID
+	}
+
+	// The report sees every log, whatever --quiet and --log-level leave out
+	if *reportPath != "" {
+		activeReport = newRunReport(*reportPath)
+		logger = activeReport.tee(logger)
+	}
+
+	if *table == "" {
+		kingpin.Fatalf("required argument 'table' not provided, nor by --target")
+	}
+	if *slack < 0 {
+		kingpin.Fatalf("--slack must not be negative")
+	}
+	if *setStatistics < 0 || *setStatistics > 10000 {
+		kingpin.Fatalf("--set-statistics must be between 1 and 10000, or 0 not to raise the statistics target")
+	}
+
+	var outputTemplate *template.Template
+	if *formatTemplate != "" {
+		var err error
+		if outputTemplate, err = template.New("format-template").Parse(*formatTemplate); err != nil {
+			kingpin.Fatalf("invalid --format-template: %v", err)
+		}
+	}
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *idColumn
+	estimator.TimeColumn = *timeColumn
+	estimator.Schema = *schema
+	estimator.Filter = *where
+	estimator.Concurrency = *maxConns
+	estimator.Strategy = *strategy
+	estimator.Exact = *exact
+	estimator.TrackingSchema = *trackingSchema
+	estimator.Refine = *refine
+	estimator.SamplePercent = *samplePercent
+	estimator.Tolerance = *tolerance
+	estimator.Verify = *verify
+	estimator.UpdatePolicy = *updatePolicy
+	estimator.UpdateRatio = *updateRatio
+	estimator.ReplicaLagPolicy = *replicaLagPolicy
+	estimator.ReplicaWait = *replicaWait
+	estimator.CorrelationPolicy = *correlationPolicy
+	estimator.MinCorrelation = *minCorrelation
+	estimator.SampleCorrelation = *sampleCorrelation
+	estimator.MaxAnalyzeAge = *maxAnalyzeAge
+	estimator.SkewWindow = *skewWindow
+	estimator.Slack = *slack
+	estimator.TxidSnapshot = *txidSnapshot
+	estimator.Explain = *explain
+	estimator.MaxCost = *maxCost
+	estimator.MaxRows = *maxRows
+	estimator.Force = *force
+	estimator.StatementTimeout = *statementTimeout
+	estimator.LockTimeout = *lockTimeout
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	if activeReport != nil {
+		activeReport.Inputs = reportInputs{
+			Table:       *table,
+			TargetTimes: *targetTimes,
+			From:        *from,
+			To:          *to,
+			IDColumn:    *idColumn,
+			TimeColumn:  *timeColumn,
+			Schema:      *schema,
+			Where:       *where,
+			Strategy:    *strategy,
+		}
+		if *slack > 0 {
+			activeReport.Inputs.Slack = slack.String()
+		}
+	}
+
+	if len(*shardDSNs) > 0 {
+		runEstimateShards(ctx, estimator, outputTemplate)
+		return
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	if *dryRun {
+		runDryRun(ctx, conn, estimator)
+		return
+	}
+
+	switch {
+	case *setStatistics > 0:
+		if !*yes && !confirm(fmt.Sprintf("ANALYZE %s with statistics target %d before estimating?", *table, *setStatistics)) {
+			kingpin.Fatalf("not analyzing %s without confirmation, pass --yes to skip it", *table)
+		}
+		analyzeWithStatistics(ctx, estimator)
+	case *analyze:
+		if !*yes && !confirm(fmt.Sprintf("ANALYZE %s before estimating?", *table)) {
+			kingpin.Fatalf("not analyzing %s without confirmation, pass --yes to skip it", *table)
+		}
+		if err := estimator.Analyze(ctx, conn, *table); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *from != "" || *to != "" {
+		runEstimateRange(ctx, conn, estimator, outputTemplate)
+		return
+	}
+
+	inputs := *targetTimes
+	if len(inputs) == 0 {
+		if inputs, err = readLines(os.Stdin); err != nil {
+			kingpin.Fatalf("failed to read target times from stdin: %v", err)
+		}
+	}
+	if len(inputs) == 0 {
+		kingpin.Fatalf("no target times given")
+	}
+	if activeReport != nil {
+		activeReport.Inputs.TargetTimes = inputs
+	}
+	if len(inputs) > 1 && *emit != "" {
+		kingpin.Fatalf("--emit needs a single target time")
+	}
+
+	// Batches share bounds and inspections across target times, which are the
+	// expensive part of most estimates
+	if len(inputs) > 1 {
+		estimator.Cache = xidfortime.NewCache()
+	}
+
+	var checker *crossChecker
+	if *alsoCheck != "" {
+		if checker, err = newCrossChecker(ctx, *alsoCheck, estimator); err != nil {
+			fatal(fmt.Errorf("failed to connect to --also-check: %w", err))
+		}
+		defer checker.Close()
+	}
+
+	var recorder *resultRecorder
+	if *recordTo != "" {
+		if recorder, err = newResultRecorder(ctx, *recordTo, *recordToSchema, poolSource(conn)); err != nil {
+			fatal(fmt.Errorf("failed to connect to --record-to: %w", err))
+		}
+		defer recorder.Close()
+	}
+
+	// Batches exit with the status for the last failure
+	var failed int
+	for _, input := range inputs {
+		if err := estimateOne(ctx, conn, estimator, checker, recorder, input, len(inputs) > 1, outputTemplate); err != nil {
+			if len(inputs) == 1 {
+				fatal(err)
+			}
+
+			level.Error(logger).Log("event", "estimate_failed", "target_time", input, "error", err)
+			failure = err
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		kingpin.Fatalf("failed to estimate %d of %d target times", failed, len(inputs))
+	}
+}
+
+// estimateOne estimates and writes the xid for a single target time. Batches
+// always write a line per result, so logfmt results go to stdout rather than
+// relying on the logs.
+func estimateOne(ctx context.Context, conn *pgxpool.Pool, estimator *xidfortime.Estimator, checker *crossChecker, recorder *resultRecorder, input string, batch bool, outputTemplate *template.Template) error {
+	targetTime, err := parseTargetTime(ctx, conn, input)
+	if err != nil {
+		return err
+	}
+
+	// Citus distributed tables have no meaningful xid of their own, only one for
+	// each node holding their shards
+	shards, err := xidfortime.DistributedShards(ctx, conn, *table)
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		return estimateNodes(ctx, estimator, recorder, shards, targetTime, outputTemplate)
+	}
+
+	started := time.Now()
+	result, err := estimator.EstimateXID(ctx, conn, *table, targetTime)
+	if err == nil {
+		err = writeEstimate(ctx, conn, estimator, checker, recorder, result, started, batch, outputTemplate)
+	}
+	notifyWebhook(poolSource(conn), *table, targetTime, result, err)
+
+	return err
+}
+
+// writeEstimate checks, records and writes a single result.
+func writeEstimate(ctx context.Context, conn *pgxpool.Pool, estimator *xidfortime.Estimator, checker *crossChecker, recorder *resultRecorder, result xidfortime.Result, started time.Time, batch bool, outputTemplate *template.Template) error {
+	var err error
+	if checker != nil {
+		checker.check(ctx, *table, result)
+	}
+
+	activeReport.addResult("", result, time.Since(started))
+
+	// Results are recorded before they're written, so none are acted on
+	// without being in the history
+	if recorder != nil {
+		if err := recorder.record(ctx, *table, result, time.Since(started)); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case *emit == emitRecoveryConf:
+		var server xidfortime.Server
+		if server, err = xidfortime.DetectServer(ctx, conn); err != nil {
+			return err
+		}
+		err = writeRecoveryConf(os.Stdout, server, result)
+	case *emit == emitRecoveryLSN:
+		var server xidfortime.Server
+		if server, err = xidfortime.DetectServer(ctx, conn); err != nil {
+			return err
+		}
+
+		xid, _ := recoveryTarget(result)
+		var lsn string
+		if lsn, err = estimator.CommitLSN(ctx, conn, xid); err != nil {
+			return fmt.Errorf("failed to find commit lsn: %w", err)
+		}
+		err = writeRecoveryLSN(os.Stdout, server, result, lsn)
+	case outputTemplate != nil:
+		err = writeTemplate(os.Stdout, outputTemplate, result)
+	case batch && *format == formatLogfmt:
+		err = writeLogfmt(os.Stdout, result)
+	default:
+		err = writeResult(os.Stdout, *format, *xidWidth, result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
+
+// estimateNodes estimates the xid for a Citus distributed table on each node
+// holding its shards, connecting to each with the same settings as the
+// coordinator.
+func estimateNodes(ctx context.Context, estimator *xidfortime.Estimator, recorder *resultRecorder, shards []xidfortime.Shard, targetTime time.Time, outputTemplate *template.Template) error {
+	if outputTemplate != nil || *emit != "" {
+		return fmt.Errorf("--format-template and --emit are not supported for distributed tables")
+	}
+
+	connectNodeQuerier := func(ctx context.Context, host string, port int) (xidfortime.Querier, func(), error) {
+		pool, err := connectNode(ctx, host, port)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return pool, pool.Close, nil
+	}
+
+	started := time.Now()
+	results, err := estimator.EstimateDistributed(ctx, connectNodeQuerier, shards, targetTime)
+	if err != nil {
+		notifyWebhook("", *table, targetTime, xidfortime.Result{}, err)
+		return err
+	}
+	for node, result := range results {
+		activeReport.addResult(node, result, time.Since(started))
+	}
+
+	err = writeNodeResults(ctx, recorder, results, started)
+	for node, result := range results {
+		notifyWebhook(node, *table, targetTime, result, err)
+	}
+
+	return err
+}
+
+// writeNodeResults records and writes the result from each node.
+func writeNodeResults(ctx context.Context, recorder *resultRecorder, results map[string]xidfortime.Result, started time.Time) error {
+	if recorder != nil {
+		for node, result := range results {
+			if err := recorder.withSource(node).record(ctx, *table, result, time.Since(started)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeNodes(os.Stdout, *format, *xidWidth, results); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
+
+// runEstimateRange estimates the xids bracketing the window between --from and
+// --to.
+func runEstimateRange(ctx context.Context, conn xidfortime.Querier, estimator *xidfortime.Estimator, outputTemplate *template.Template) {
+	if *from == "" || *to == "" {
+		kingpin.Fatalf("--from and --to must be given together")
+	}
+	if len(*targetTimes) > 0 {
+		kingpin.Fatalf("target times cannot be combined with --from and --to")
+	}
+	if outputTemplate != nil || *emit != "" {
+		kingpin.Fatalf("--format-template and --emit are not supported with --from and --to")
+	}
+	if *recordTo != "" {
+		kingpin.Fatalf("--record-to is not supported with --from and --to")
+	}
+
+	fromTime, err := parseTargetTime(ctx, conn, *from)
+	if err != nil {
+		fatal(err)
+	}
+	toTime, err := parseTargetTime(ctx, conn, *to)
+	if err != nil {
+		fatal(err)
+	}
+
+	started := time.Now()
+	result, err := estimator.EstimateRange(ctx, conn, *table, fromTime, toTime)
+	if err != nil {
+		fatal(err)
+	}
+	activeReport.addResult("from", result.From, time.Since(started))
+	activeReport.addResult("to", result.To, time.Since(started))
+
+	if err := writeRange(os.Stdout, *format, *xidWidth, result); err != nil {
+		kingpin.Fatalf("failed to write result: %v", err)
+	}
+}
+
+// readLines reads newline-delimited values, ignoring blank lines.
+func readLines(in io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// analyzeWithStatistics runs --set-statistics over a connection of its own, as
+// changing the statistics target isn't allowed in a read only transaction.
+func analyzeWithStatistics(ctx context.Context, estimator *xidfortime.Estimator) {
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	if err := estimator.AnalyzeWithStatistics(ctx, pool, *table, *setStatistics); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/lawrencejones/xid-for-time/pkg/wal"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// Exit statuses, so automation can tell why we failed. Usage errors and
+// anything unclassified exit with exitFailure.
+const (
+	exitFailure      = 1
+	exitConnection   = 3   // couldn't reach the database, or lost it
+	exitNotFound     = 4   // the table or a column doesn't exist
+	exitNoStatistics = 5   // the table has no statistics to estimate from
+	exitOutOfRange   = 6   // the target is outside the rows of the table
+	exitTolerance    = 7   // no estimate was within --tolerance
+	exitTimeout      = 124 // --timeout was exceeded, matching timeout(1)
+	exitCancelled    = 130 // interrupted, matching shells for SIGINT
+)
+
+// failure is the error we're exiting for, from which exitStatus picks the
+// status.
+var failure error
+
+// fatal exits with the status for err, via kingpin so tracing is flushed.
+func fatal(err error) {
+	failure = err
+	kingpin.Fatalf("%s", err)
+}
+
+// connectionError marks failures to connect to the database.
+type connectionError struct{ error }
+
+func (e connectionError) Unwrap() error { return e.error }
+
+// exitStatus classifies the failure we're exiting for. The context takes
+// precedence, as cancellation fails whatever was running in arbitrary ways.
+func exitStatus(ctx context.Context, err error) int {
+	var (
+		connErr      connectionError
+		pgErr        *pgconn.PgError
+		toleranceErr *xidfortime.ToleranceError
+	)
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(ctx.Err(), context.Canceled), errors.Is(err, context.Canceled):
+		return exitCancelled
+	case err == nil:
+		return exitFailure
+	case errors.As(err, &connErr), xidfortime.IsTransient(err):
+		return exitConnection
+	case errors.Is(err, xidfortime.ErrRelationNotFound):
+		return exitNotFound
+	case errors.As(err, &pgErr) && (pgErr.Code == "42P01" || pgErr.Code == "42703"): // undefined_table, undefined_column
+		return exitNotFound
+	case errors.Is(err, xidfortime.ErrNoHistogram):
+		return exitNoStatistics
+	case errors.Is(err, xidfortime.ErrOutOfRange), errors.Is(err, xidfortime.ErrNullTimes), errors.Is(err, pgx.ErrNoRows),
+		errors.Is(err, wal.ErrNoCommitBefore):
+		return exitOutOfRange
+	case errors.As(err, &toleranceErr):
+		return exitTolerance
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	fleet          = app.Command("fleet", "Estimate the xid for one target time on every cluster of an inventory, such as each shard for a coordinated restore")
+	fleetTime      = fleet.Arg("time", "Target time, shared by every cluster").Required().String()
+	fleetInventory = fleet.Flag("inventory", "YAML inventory of clusters, each with the connection and table settings of a target").Required().ExistingFile()
+	fleetParallel  = fleet.Flag("parallel", "Number of clusters to estimate at once").Default("8").Int()
+	fleetFormat    = fleet.Flag("format", "Format of the report written to stdout").Default("table").Enum("table", formatLogfmt, formatJSON)
+)
+
+// inventory lists the clusters of a fleet, each given as a target would be in
+// the config file:
+//
+//	clusters:
+//	  shard-01:
+//	    dsn: postgres://shard-01.internal/app
+//	    table: events
+//	  shard-02:
+//	    service: shard-02
+//	    table: events
+type inventory struct {
+	Clusters map[string]target `yaml:"clusters"`
+}
+
+// fleetResult is the estimate for one cluster, or why there isn't one.
+type fleetResult struct {
+	result xidfortime.Result
+	err    error
+}
+
+func runFleet(ctx context.Context) {
+	if *fleetParallel < 1 {
+		kingpin.Fatalf("--parallel must be at least 1")
+	}
+
+	data, err := ioutil.ReadFile(*fleetInventory)
+	if err != nil {
+		kingpin.Fatalf("failed to read inventory: %v", err)
+	}
+
+	var inv inventory
+	if err := yaml.UnmarshalStrict(data, &inv); err != nil {
+		kingpin.Fatalf("invalid inventory %s: %v", *fleetInventory, err)
+	}
+	if len(inv.Clusters) == 0 {
+		kingpin.Fatalf("inventory %s lists no clusters", *fleetInventory)
+	}
+	for name, cluster := range inv.Clusters {
+		if cluster.Table == "" {
+			kingpin.Fatalf("cluster %s in %s has no table", name, *fleetInventory)
+		}
+	}
+
+	// Every cluster has to share one target, so relative times are taken from
+	// our clock rather than each server's
+	*relativeTo = clockClient
+	targetTime, err := parseTargetTime(ctx, nil, *fleetTime)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+
+	names := make([]string, 0, len(inv.Clusters))
+	for name := range inv.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = map[string]fleetResult{}
+		queue   = make(chan string)
+	)
+	for worker := 0; worker < *fleetParallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				result, err := estimateCluster(ctx, name, inv.Clusters[name], targetTime)
+				if err != nil {
+					level.Error(logger).Log("event", "estimate_failed", "cluster", name, "error", err)
+				}
+
+				mu.Lock()
+				results[name] = fleetResult{result: result, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := writeFleet(names, results); err != nil {
+		kingpin.Fatalf("failed to write report: %v", err)
+	}
+
+	// A coordinated restore needs every cluster, so any failure fails the run
+	var failed int
+	for _, name := range names {
+		if err := results[name].err; err != nil {
+			failure = err
+			failed++
+		}
+	}
+	if failed > 0 {
+		kingpin.Fatalf("failed to estimate %d of %d clusters", failed, len(names))
+	}
+}
+
+// estimateCluster connects to a cluster of the inventory and estimates with its
+// table settings, and the estimate flags' defaults otherwise.
+func estimateCluster(ctx context.Context, name string, cluster target, targetTime time.Time) (xidfortime.Result, error) {
+	pool, err := connectDSN(ctx, targetConnString(cluster))
+	if err != nil {
+		return xidfortime.Result{TargetTime: targetTime}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	estimator := xidfortime.NewEstimator(kitlog.With(logger, "cluster", name))
+	estimator.IDColumn = cluster.IDColumn
+	estimator.TimeColumn = cluster.TimeColumn
+	estimator.Strategy = cluster.Strategy
+	estimator.Filter = cluster.Where
+	estimator.Concurrency = *maxConns
+	estimator.Verify = true
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	return estimator.EstimateXID(ctx, pool, cluster.Table, targetTime)
+}
+
+// targetConnString is the connection string for a target, being its dsn when
+// it has one. Anything it leaves out is resolved from the environment.
+func targetConnString(t target) string {
+	if t.DSN != "" {
+		return t.DSN
+	}
+
+	var port string
+	if t.Port != 0 {
+		port = fmt.Sprintf("%d", t.Port)
+	}
+
+	var settings [][2]string
+	for _, setting := range [][2]string{
+		{"service", t.Service},
+		{"host", t.Host},
+		{"port", port},
+		{"database", t.Database},
+		{"user", t.User},
+		{"sslmode", t.SSLMode},
+	} {
+		if setting[1] != "" {
+			settings = append(settings, setting)
+		}
+	}
+
+	return connString(settings)
+}
+
+func writeFleet(names []string, results map[string]fleetResult) error {
+	switch *fleetFormat {
+	case formatLogfmt:
+		for _, name := range names {
+			keyvals := []interface{}{"cluster", name}
+			if err := results[name].err; err != nil {
+				keyvals = append(keyvals, "error", err)
+			} else {
+				keyvals = append(keyvals, logfmtKeyvals(results[name].result)...)
+			}
+
+			if err := kitlog.NewLogfmtLogger(os.Stdout).Log(keyvals...); err != nil {
+				return err
+			}
+		}
+	case formatJSON:
+		type clusterJSON struct {
+			*jsonResult
+			Error string `json:"error,omitempty"`
+		}
+
+		byCluster := map[string]clusterJSON{}
+		for name, r := range results {
+			if r.err != nil {
+				byCluster[name] = clusterJSON{Error: r.err.Error()}
+				continue
+			}
+
+			result := newJSONResult(r.result)
+			byCluster[name] = clusterJSON{jsonResult: &result}
+		}
+
+		return json.NewEncoder(os.Stdout).Encode(byCluster)
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CLUSTER\tXID\tXID8\tSTRATEGY\tBEFORE CREATED AT\tERROR")
+		for _, name := range names {
+			r := results[name]
+			if r.err != nil {
+				fmt.Fprintf(w, "%s\t\t\t\t\t%v\n", name, r.err)
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", name, r.result.XID(), r.result.XID8, r.result.Strategy,
+				r.result.Before.CreatedAt.Format(time.RFC3339Nano))
+		}
+
+		return w.Flush()
+	}
+
+	return nil
+}
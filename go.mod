@@ -3,9 +3,21 @@ module github.com/lawrencejones/xid-for-time
 go 1.14
 
 require (
+	github.com/GoogleCloudPlatform/cloudsql-proxy v1.17.0
 	github.com/alecthomas/kingpin v2.2.6+incompatible
-	github.com/davecgh/go-spew v1.1.1
+	github.com/aws/aws-sdk-go v1.34.0
 	github.com/go-kit/kit v0.10.0
-	github.com/jackc/pgx v3.6.2+incompatible
-	github.com/jackc/pgx/v4 v4.8.0
+	github.com/golang/protobuf v1.4.2
+	github.com/jackc/pgconn v1.8.1
+	github.com/jackc/pgproto3/v2 v2.0.6
+	github.com/jackc/pgx/v4 v4.11.0
+	github.com/prometheus/client_golang v1.3.0
+	go.opentelemetry.io/otel v0.11.0
+	go.opentelemetry.io/otel/exporters/otlp v0.11.0
+	go.opentelemetry.io/otel/sdk v0.11.0
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/grpc v1.31.0
+	google.golang.org/protobuf v1.23.0
+	gopkg.in/yaml.v2 v2.2.2
 )
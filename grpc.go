@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/api"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the XidForTime service over the same pool as the HTTP
+// API.
+type grpcServer struct {
+	conn *pgxpool.Pool
+}
+
+var _ api.XidForTimeServer = grpcServer{}
+
+func (s grpcServer) EstimateXid(ctx context.Context, req *api.EstimateXidRequest) (*api.EstimateXidResponse, error) {
+	if req.GetTable() == "" || req.GetTime() == nil {
+		return nil, status.Error(codes.InvalidArgument, "table and time are required")
+	}
+
+	targetTime, err := ptypes.Timestamp(req.GetTime())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	estimator := s.estimator(req.GetIdColumn(), req.GetTimeColumn(), req.GetStrategy())
+	estimator.Verify = *serveVerify
+
+	start := time.Now()
+	result, err := estimator.EstimateXID(ctx, s.conn, req.GetTable(), targetTime)
+	observeEstimate(kindXID, result.Strategy, start, result.Gap(), err)
+	go notifyWebhook(poolSource(s.conn), req.GetTable(), targetTime, result, err)
+	if err != nil {
+		return nil, estimateError(err)
+	}
+
+	return &api.EstimateXidResponse{
+		Xid:        result.XID(),
+		Xid8:       result.XID8,
+		Strategy:   result.Strategy,
+		TargetTime: timestampProto(result.TargetTime),
+		Before:     rowProto(result.Before),
+		Exceeded:   rowProto(result.Exceeded),
+		LowerXid:   result.LowerXID(),
+		UpperXid:   result.UpperXID(),
+		Gap:        ptypes.DurationProto(result.Gap()),
+	}, nil
+}
+
+func (s grpcServer) TimeForXid(ctx context.Context, req *api.TimeForXidRequest) (*api.TimeForXidResponse, error) {
+	if req.GetTable() == "" || req.GetXid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "table and xid are required")
+	}
+
+	estimator := s.estimator(req.GetIdColumn(), req.GetTimeColumn(), req.GetStrategy())
+	start := time.Now()
+	result, err := estimator.EstimateTime(ctx, s.conn, req.GetTable(), req.GetXid())
+	observeEstimate(kindTime, result.Strategy, start, result.Gap(), err)
+	if err != nil {
+		return nil, estimateError(err)
+	}
+
+	resp := &api.TimeForXidResponse{
+		Xid:         result.XID,
+		Strategy:    result.Strategy,
+		CommittedAt: timestampProto(result.CommittedAt),
+		Gap:         ptypes.DurationProto(result.Gap()),
+	}
+	if result.Strategy != xidfortime.StrategyCommitTimestamp {
+		resp.Before, resp.After = rowProto(result.Before), rowProto(result.After)
+	}
+
+	return resp, nil
+}
+
+func (s grpcServer) Health(ctx context.Context, req *api.HealthRequest) (*api.HealthResponse, error) {
+	var ok bool
+	if err := s.conn.QueryRow(ctx, "select true;").Scan(&ok); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &api.HealthResponse{Serving: ok}, nil
+}
+
+func (s grpcServer) estimator(idColumn, timeColumn, strategy string) *xidfortime.Estimator {
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = idColumn
+	estimator.TimeColumn = timeColumn
+	estimator.Strategy = strategy
+	estimator.Concurrency = *maxConns
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	return estimator
+}
+
+// estimateError maps estimator errors onto gRPC status codes, so clients can
+// tell cancellations from estimates that failed.
+func estimateError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func rowProto(row xidfortime.Row) *api.Row {
+	return &api.Row{Id: row.ID, CreatedAt: timestampProto(row.CreatedAt), Xmin: row.XMin}
+}
+
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	ts, _ := ptypes.TimestampProto(t)
+	return ts
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	initTracking          = app.Command("init", "Create the tracking table of samples of the time, xid and LSN, for exact lookups")
+	initTrackingSchema    = initTracking.Flag("schema", "Schema to create the tracking table in, creating it if need be").Default(xidfortime.DefaultTrackingSchema).String()
+	initTrackingReaders   = initTracking.Flag("reader", "Role to grant looking up samples, repeatable").Strings()
+	initTrackingRecorders = initTracking.Flag("recorder", "Role to grant recording samples, repeatable").Strings()
+)
+
+func runInitTracking(ctx context.Context) {
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := xidfortime.InstallTracking(ctx, tx, *initTrackingSchema, *initTrackingReaders, *initTrackingRecorders); err != nil {
+		fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		fatal(fmt.Errorf("failed to install tracking table: %w", err))
+	}
+
+	level.Info(logger).Log("event", "installed_tracking_table", "table", pgx.Identifier{*initTrackingSchema, xidfortime.TrackingTable}.Sanitize(),
+		"readers", len(*initTrackingReaders), "recorders", len(*initTrackingRecorders))
+}
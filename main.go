@@ -1,184 +1,210 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
-	"text/template"
-	"time"
 
 	"github.com/alecthomas/kingpin"
 	kitlog "github.com/go-kit/kit/log"
-	"github.com/jackc/pgx/v4"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
 )
 
 var logger kitlog.Logger
 
-var (
-	app = kingpin.New("xid-for-time", "Find the last xid that committed before time").Version("1.0.0")
+const version = "1.0.0"
 
-	table            = app.Arg("table", "Table to use for estimates").Required().String()
-	targetTimeString = app.Arg("time", "Target time to compute xid for").Required().String()
+var (
+	app = kingpin.New("xid-for-time", "Find the last xid that committed before time").Version(version)
 
 	// Database connection paramters
-	host     = app.Flag("host", "Postgres host").Envar("PGHOST").Default("127.0.0.1").String()
-	port     = app.Flag("port", "Postgres port").Envar("PGPORT").Default("5432").Uint16()
-	database = app.Flag("database", "Postgres database name").Envar("PGDATABASE").Default("postgres").String()
-	user     = app.Flag("user", "Postgres user").Envar("PGUSER").Default("postgres").String()
+	dsn      = app.Flag("dsn", "Postgres connection string or URI, overriding the individual connection flags").Envar("DATABASE_URL").String()
+	service  = app.Flag("service", "Service in pg_service.conf providing connection parameters").Envar("PGSERVICE").String()
+	host     = app.Flag("host", "Postgres host (default 127.0.0.1)").Envar("PGHOST").String()
+	port     = app.Flag("port", "Postgres port (default 5432)").Envar("PGPORT").Uint16()
+	database = app.Flag("database", "Postgres database name (default postgres)").Envar("PGDATABASE").String()
+	user     = app.Flag("user", "Postgres user (default postgres)").Envar("PGUSER").String()
+
+	// Passwords are read from PGPASSWORD or the passfile unless prompted for
+	passfile       = app.Flag("passfile", "Password file, defaulting to ~/.pgpass").Envar("PGPASSFILE").String()
+	passwordPrompt = app.Flag("password-prompt", "Prompt for the Postgres password").Bool()
+	awsIAMAuth     = app.Flag("aws-iam-auth", "Authenticate to RDS with an IAM auth token instead of a password").Bool()
+	awsRegion      = app.Flag("aws-region", "AWS region of the RDS instance").Envar("AWS_REGION").String()
+
+	// TLS configuration, following libpq semantics
+	sslMode     = app.Flag("sslmode", "SSL mode (disable, allow, prefer, require, verify-ca, verify-full)").Envar("PGSSLMODE").Enum("disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	sslRootCert = app.Flag("sslrootcert", "Certificate authority used to verify the server").Envar("PGSSLROOTCERT").String()
+	sslCert     = app.Flag("sslcert", "Client certificate").Envar("PGSSLCERT").String()
+	sslKey      = app.Flag("sslkey", "Client certificate key").Envar("PGSSLKEY").String()
+
+	// Alternative ways of reaching the database
+	cloudSQLInstance = app.Flag("cloudsql-instance", "Cloud SQL instance (project:region:instance) to dial through the Cloud SQL proxy client").String()
+	sshHost          = app.Flag("ssh-host", "Jump host (host[:port]) to tunnel the connection through").String()
+	sshUser          = app.Flag("ssh-user", "User for the jump host, defaulting to the current user").String()
+	sshKey           = app.Flag("ssh-key", "Private key for the jump host, defaulting to ssh-agent").String()
+	sshKnownHosts    = app.Flag("ssh-known-hosts", "Known hosts file used to verify the jump host, defaulting to ~/.ssh/known_hosts").String()
+	patroniURLs      = app.Flag("patroni-url", "Patroni REST API to discover the member to connect to from, overriding --host and --port, which may be repeated").Strings()
+	patroniRole      = app.Flag("patroni-member", "Member of the Patroni cluster to connect to").Default(patroniPrimary).Enum(patroniMembers...)
+	appName          = app.Flag("application-name", "application_name of our sessions, as shown in pg_stat_activity (default xid-for-time/<version>)").Envar("PGAPPNAME").String()
+	simpleProtocol   = app.Flag("simple-protocol", "Use the simple query protocol, for PgBouncer in transaction pooling mode").Bool()
+	role             = app.Flag("role", "Role to SET ROLE to after connecting, so a personal login can act with the privileges granted to it").String()
+	searchPath       = app.Flag("search-path", "search_path of our sessions, deciding which schema unqualified table names resolve to").String()
+	maxConns         = app.Flag("max-conns", "Maximum number of connections, and so probe queries, to run at once").Default("4").Int()
+
+	timeout      = app.Flag("timeout", "Deadline for the whole run, after which queries are cancelled and we exit with status 124").Duration()
+	retries      = app.Flag("retries", "Times to retry connecting and each query after transient failures, such as a failover").Default("3").Int()
+	retryBackoff = app.Flag("retry-backoff", "Delay before the first retry, doubling with jitter after each").Default("100ms").Duration()
+	snapshot     = app.Flag("snapshot", "Run every query of an estimate in one repeatable read snapshot, disable with --no-snapshot").Default("true").Bool()
+
+	logFormat = app.Flag("log-format", "Format of logs written to stderr").Default("logfmt").Enum("logfmt", "json")
+	logLevel  = app.Flag("log-level", "Minimum level of logs written to stderr").Default("info").Enum("debug", "info", "warn", "error")
 )
 
-const (
-	selectThresholds = `
-select * from (
-    select id as min_id
-         , created_at as min_created_at
-         , lag(id, 1) over(order by created_at desc) as max_id
-         , lag(created_at, 1) over(order by created_at desc) as max_created_at
-      from (
-          select id
-               , created_at
-            from {{ .Table }}
-           where id in (
-                 select unnest(histogram_bounds::text::text[])
-                   from pg_stats
-                  where tablename='{{ .Table }}'
-                    and attname='id'
-                 )
-           order by created_at desc
-           ) t1
-  ) t2
-  where min_created_at < $1
-  order by min_created_at desc
-  limit 1;
-`
-	selectPastThreshold = `
-select id
-     , created_at
-  from {{ .Table }}
- where id > $1
-   and id < $2
-   and created_at > $3
- order by id asc
- limit 1;
-`
-	selectBeforeThreshold = `
-select id
-     , created_at
-		 , xmin::text
-  from {{ .Table }}
- where id < $1
- order by id desc
- limit 1;
- `
-)
+// retryPolicy is how we retry transient failures, from --retries and
+// --retry-backoff.
+func retryPolicy() xidfortime.RetryPolicy {
+	return xidfortime.RetryPolicy{Retries: *retries, Backoff: *retryBackoff}
+}
 
-func main() {
-	logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stderr))
+// newLogger builds the stderr logger, dropping logs below the given level.
+func newLogger(format, minLevel string) kitlog.Logger {
+	var logger kitlog.Logger
+	if format == "json" {
+		logger = kitlog.NewJSONLogger(kitlog.NewSyncWriter(os.Stderr))
+	} else {
+		logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stderr))
+	}
 	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC)
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	allow := map[string]level.Option{
+		"debug": level.AllowDebug(),
+		"info":  level.AllowInfo(),
+		"warn":  level.AllowWarn(),
+		"error": level.AllowError(),
+	}[minLevel]
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	return level.NewFilter(logger, allow)
+}
 
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, syscall.SIGTERM)
-	go func() {
-		<-sigs
-		logger.Log("msg", "received signal, shutting down")
-		cancel()
-	}()
+func main() {
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
-	logger.Log("event", "connect", "dbname", *database, "host", *host, "port", *port, "user", *user)
-	conn, err := pgx.Connect(ctx, fmt.Sprintf("host=%s port=%d database=%s user=%s", *host, *port, *database, *user))
-	if err != nil {
-		kingpin.Fatalf("failed to connect to database: %v", err)
-	}
+	logger = newLogger(*logFormat, *logLevel)
 
-	var targetTime time.Time
-	if err := conn.QueryRow(ctx, fmt.Sprintf("select '%s'::timestamp;", *targetTimeString)).Scan(&targetTime); err != nil {
-		kingpin.Fatalf("invalid timestamp for target time: %s", err.Error())
+	// Completion scripts need neither a database nor tracing
+	if command == completion.FullCommand() {
+		runCompletion()
+		return
 	}
 
-	thresholds := struct {
-		MinID, MaxID               string
-		MinCreatedAt, MaxCreatedAt time.Time
-	}{}
+	if err := applyTarget(command); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
 
-	{
-		sql, err := renderSQL("selectThresholds", selectThresholds, struct{ Table string }{*table})
-		if err != nil {
-			kingpin.Fatalf(err.Error())
-		}
+	if *maxConns < 1 {
+		kingpin.Fatalf("--max-conns must be at least 1")
+	}
 
-		err = conn.QueryRow(ctx, sql, *targetTimeString).Scan(
-			&thresholds.MinID, &thresholds.MinCreatedAt,
-			&thresholds.MaxID, &thresholds.MaxCreatedAt,
-		)
-		if err != nil {
-			kingpin.Fatalf(err.Error())
-		}
+	// PgBouncer rejects startup parameters it doesn't know
+	if *simpleProtocol && *searchPath != "" {
+		kingpin.Fatalf("--search-path can't be used with --simple-protocol, qualify the table or give --schema instead")
 	}
 
-	logger.Log("event", "found_thresholds",
-		"min_id", thresholds.MinID, "min_created_at", thresholds.MinCreatedAt,
-		"max_id", thresholds.MaxID, "max_created_at", thresholds.MaxCreatedAt)
+	// SET ROLE lasts the session, which transaction pooling would share with
+	// other clients while running our next transaction on another
+	if *simpleProtocol && *role != "" {
+		kingpin.Fatalf("--role can't be used with --simple-protocol, connect as the role instead")
+	}
 
-	var (
-		exceededID        string
-		exceededCreatedAt time.Time
-	)
+	shutdownTracing, err := setupTracing()
+	if err != nil {
+		kingpin.Fatalf("failed to set up tracing: %v", err)
+	}
 
-	{
-		sql, err := renderSQL("selectPastThreshold", selectPastThreshold, struct{ Table string }{*table})
-		if err != nil {
-			kingpin.Fatalf(err.Error())
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		if err = conn.QueryRow(ctx, sql, thresholds.MinID, thresholds.MaxID, *targetTimeString).
-			Scan(&exceededID, &exceededCreatedAt); err != nil {
-			kingpin.Fatalf(err.Error())
-		}
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
 
-	logger.Log("event", "first_past_threshold",
-		"exceeded_id", exceededID,
-		"exceeded_created_at", exceededCreatedAt,
-		"exceeded_by", exceededCreatedAt.Sub(targetTime))
-
-	var (
-		beforeID        string
-		beforeXMin      string
-		beforeCreatedAt time.Time
-	)
-
-	{
-		sql, err := renderSQL("selectBeforeThreshold", selectBeforeThreshold, struct{ Table string }{*table})
-		if err != nil {
-			kingpin.Fatalf(err.Error())
+	// Commands exit through kingpin.Fatalf on failure, where spans are most
+	// useful, so flush them on the way out
+	ctx, span := global.Tracer(tracerName).Start(ctx, command, trace.WithAttributes(label.String("command", command)))
+	kingpin.CommandLine.Terminate(func(status int) {
+		if status != 0 {
+			status = exitStatus(ctx, failure)
 		}
-
-		if err = conn.QueryRow(ctx, sql, exceededID).Scan(&beforeID, &beforeCreatedAt, &beforeXMin); err != nil {
-			kingpin.Fatalf(err.Error())
+		activeReport.finish(status)
+
+		span.End()
+		shutdownTracing()
+		os.Exit(status)
+	})
+	defer shutdownTracing()
+	defer span.End()
+
+	// Interrupted commands cancel their queries server-side before the context,
+	// whereas serve drains in-flight requests and leaves their queries be
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		level.Info(logger).Log("msg", "received signal, shutting down", "signal", sig)
+		if command != serve.FullCommand() {
+			busyBackends.cancel()
 		}
-	}
-
-	logger.Log("event", "first_before_threshold",
-		"before_id", beforeID,
-		"before_created_at", beforeCreatedAt,
-		"before_xmin", beforeXMin,
-		"before_by", targetTime.Sub(beforeCreatedAt))
-}
+		cancel()
+	}()
 
-func renderSQL(name, templateSource string, data interface{}) (string, error) {
-	var buffer bytes.Buffer
-	t := template.Must(template.New(name).Parse(templateSource))
-	if err := t.Execute(&buffer, data); err != nil {
-		return "", err
+	switch command {
+	case estimate.FullCommand():
+		runEstimate(ctx)
+	case timeForXID.FullCommand():
+		runTimeForXID(ctx)
+	case suggestTables.FullCommand():
+		runSuggestTables(ctx)
+	case serve.FullCommand():
+		runServe(ctx)
+	case restorePgbackrest.FullCommand():
+		runRestorePgbackrest(ctx)
+	case restoreBarman.FullCommand():
+		runRestoreBarman(ctx)
+	case restoreWALG.FullCommand():
+		runRestoreWALG(ctx)
+	case scanWAL.FullCommand():
+		runScanWAL(ctx)
+	case fromWALDump.FullCommand():
+		runFromWALDump(ctx)
+	case track.FullCommand():
+		runTrack(ctx)
+	case initTracking.FullCommand():
+		runInitTracking(ctx)
+	case record.FullCommand():
+		runRecord(ctx)
+	case benchmark.FullCommand():
+		runBenchmark(ctx)
+	case verifyAccuracy.FullCommand():
+		runVerifyAccuracy(ctx)
+	case compact.FullCommand():
+		runCompact(ctx)
+	case cronInstall.FullCommand():
+		runCronInstall(ctx)
+	case cronUninstall.FullCommand():
+		runCronUninstall(ctx)
+	case preflight.FullCommand():
+		runPreflight(ctx)
+	case fleet.FullCommand():
+		runFleet(ctx)
+	case burnRate.FullCommand():
+		runBurnRate(ctx)
 	}
 
-	return string(buffer.Bytes()), nil
+	activeReport.finish(0)
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	estimatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "xid_for_time_estimates_total",
+		Help: "Estimates performed, by kind, strategy and outcome",
+	}, []string{"kind", "strategy", "outcome"})
+
+	estimateDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "xid_for_time_estimate_duration_seconds",
+		Help:    "Time taken to produce an estimate, by kind and strategy",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"kind", "strategy"})
+
+	estimateGapSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "xid_for_time_estimate_gap_seconds",
+		Help:    "Time between the rows either side of each estimate, bounding its error",
+		Buckets: prometheus.ExponentialBuckets(0.001, 10, 10),
+	}, []string{"kind", "strategy"})
+
+	databaseErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "xid_for_time_database_errors_total",
+		Help: "Estimates that failed because of the database, by kind",
+	}, []string{"kind"})
+)
+
+// Kinds of estimate recorded in metrics
+const (
+	kindXID  = "xid"
+	kindTime = "time"
+)
+
+// observeEstimate records the outcome of an estimate that began at start.
+func observeEstimate(kind, strategy string, start time.Time, gap time.Duration, err error) {
+	if strategy == "" {
+		strategy = "unknown"
+	}
+
+	outcome := "success"
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		outcome = "cancelled"
+	case err != nil:
+		outcome = "error"
+		if isDatabaseError(err) {
+			databaseErrorsTotal.WithLabelValues(kind).Inc()
+		}
+	}
+
+	estimatesTotal.WithLabelValues(kind, strategy, outcome).Inc()
+	estimateDurationSeconds.WithLabelValues(kind, strategy).Observe(time.Since(start).Seconds())
+	if err == nil {
+		estimateGapSeconds.WithLabelValues(kind, strategy).Observe(gap.Seconds())
+	}
+}
+
+// isDatabaseError distinguishes errors raised by Postgres or the connection to
+// it from those in our own handling, such as tables without usable bounds.
+func isDatabaseError(err error) bool {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	return errors.As(err, &pgErr) || errors.As(err, &netErr) || pgconn.Timeout(err)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+const (
+	formatLogfmt = "logfmt"
+	formatJSON   = "json"
+	formatXID    = "xid"
+)
+
+var formats = []string{formatLogfmt, formatJSON, formatXID}
+
+// Widths of xid that can be printed by the xid format
+const (
+	xidWidth32 = "xid"
+	xidWidth64 = "xid8"
+)
+
+// writeResult prints the result to out in the requested format. The logfmt
+// format relies on the estimator's logs, and writes nothing.
+func writeResult(out io.Writer, format, xidWidth string, result xidfortime.Result) error {
+	switch format {
+	case formatXID:
+		xid := result.XID()
+		if xidWidth == xidWidth64 {
+			xid = result.XID8
+		}
+
+		_, err := fmt.Fprintln(out, xid)
+		return err
+	case formatJSON:
+		return json.NewEncoder(out).Encode(newJSONResult(result))
+	}
+
+	return nil
+}
+
+// writeRange prints the xids bracketing a window. The xid format prints the
+// lower and upper xid separated by a space.
+func writeRange(out io.Writer, format, xidWidth string, result xidfortime.RangeResult) error {
+	switch format {
+	case formatXID:
+		lower, upper := result.LowerXID(), result.UpperXID()
+		if xidWidth == xidWidth64 {
+			lower, upper = result.From.XID8, result.To.XID8
+		}
+
+		_, err := fmt.Fprintln(out, lower, upper)
+		return err
+	case formatJSON:
+		return json.NewEncoder(out).Encode(struct {
+			xidfortime.RangeResult
+			LowerXID        string  `json:"lower_xid"`
+			UpperXID        string  `json:"upper_xid"`
+			Duration        string  `json:"duration"`
+			Transactions    uint64  `json:"transactions"`
+			TransactionRate float64 `json:"transactions_per_second"`
+		}{result, result.LowerXID(), result.UpperXID(), result.Duration().String(), result.Transactions(), result.TransactionRate()})
+	}
+
+	return nil
+}
+
+// writeLogfmt prints the result as a single logfmt line.
+func writeLogfmt(out io.Writer, result xidfortime.Result) error {
+	return kitlog.NewLogfmtLogger(out).Log(logfmtKeyvals(result)...)
+}
+
+// writeNodes prints the result for each node of a distributed table, sorted by
+// node. The logfmt format prints a line per node, and the xid format each node
+// followed by its xid.
+func writeNodes(out io.Writer, format, xidWidth string, results map[string]xidfortime.Result) error {
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	switch format {
+	case formatLogfmt:
+		for _, node := range nodes {
+			keyvals := append([]interface{}{"node", node}, logfmtKeyvals(results[node])...)
+			if err := kitlog.NewLogfmtLogger(out).Log(keyvals...); err != nil {
+				return err
+			}
+		}
+	case formatXID:
+		for _, node := range nodes {
+			xid := results[node].XID()
+			if xidWidth == xidWidth64 {
+				xid = results[node].XID8
+			}
+
+			if _, err := fmt.Fprintln(out, node, xid); err != nil {
+				return err
+			}
+		}
+	case formatJSON:
+		byNode := map[string]jsonResult{}
+		for node, result := range results {
+			byNode[node] = newJSONResult(result)
+		}
+
+		return json.NewEncoder(out).Encode(byNode)
+	}
+
+	return nil
+}
+
+// writeShards writes the result of each shard for one target time, and the
+// error of any that failed in its place.
+func writeShards(out io.Writer, format, xidWidth string, targetTime time.Time, results map[string]fleetResult) error {
+	shards := make([]string, 0, len(results))
+	for shard := range results {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	switch format {
+	case formatLogfmt:
+		for _, shard := range shards {
+			keyvals := []interface{}{"shard", shard}
+			if err := results[shard].err; err != nil {
+				keyvals = append(keyvals, "target_time", targetTime, "error", err)
+			} else {
+				keyvals = append(keyvals, logfmtKeyvals(results[shard].result)...)
+			}
+
+			if err := kitlog.NewLogfmtLogger(out).Log(keyvals...); err != nil {
+				return err
+			}
+		}
+	case formatXID:
+		// Failures are only logged, as there's no xid to print for them
+		for _, shard := range shards {
+			r := results[shard]
+			if r.err != nil {
+				continue
+			}
+
+			xid := r.result.XID()
+			if xidWidth == xidWidth64 {
+				xid = r.result.XID8
+			}
+
+			if _, err := fmt.Fprintln(out, shard, xid); err != nil {
+				return err
+			}
+		}
+	case formatJSON:
+		type failedJSON struct {
+			TargetTime time.Time `json:"target_time"`
+			Error      string    `json:"error"`
+		}
+
+		byShard := map[string]interface{}{}
+		for shard, r := range results {
+			if r.err != nil {
+				byShard[shard] = failedJSON{TargetTime: targetTime, Error: r.err.Error()}
+				continue
+			}
+
+			byShard[shard] = newJSONResult(r.result)
+		}
+
+		return json.NewEncoder(out).Encode(byShard)
+	}
+
+	return nil
+}
+
+func logfmtKeyvals(result xidfortime.Result) []interface{} {
+	keyvals := []interface{}{"target_time", result.TargetTime, "xid", result.XID(), "xid8", result.XID8,
+		"strategy", result.Strategy, "lower_xid", result.LowerXID(), "upper_xid", result.UpperXID(), "gap", result.Gap()}
+	if result.BeyondHead {
+		keyvals = append(keyvals, "beyond_head", true)
+	}
+	if result.Slack > 0 {
+		keyvals = append(keyvals, "slack", result.Slack)
+	}
+	if result.NullSkipped > 0 {
+		keyvals = append(keyvals, "null_skipped", result.NullSkipped)
+	}
+	if result.ObservedSkew > 0 {
+		keyvals = append(keyvals, "observed_skew", result.ObservedSkew)
+	}
+	if result.TxidSnapshot != "" {
+		keyvals = append(keyvals, "txid_snapshot", result.TxidSnapshot)
+	}
+
+	return keyvals
+}
+
+// writeTemplate renders the result using a user supplied template, followed by
+// a newline.
+func writeTemplate(out io.Writer, tmpl *template.Template, result xidfortime.Result) error {
+	if err := tmpl.Execute(out, newTemplateResult(result)); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// templateResult flattens the result so templates can refer to fields such as
+// {{ .Xid }} and {{ .BeforeCreatedAt }} directly.
+type templateResult struct {
+	Xid               string
+	Xid8              string
+	LowerXid          string
+	UpperXid          string
+	Strategy          string
+	TargetTime        time.Time
+	MinID             string
+	MinCreatedAt      time.Time
+	MaxID             string
+	MaxCreatedAt      time.Time
+	ExceededID        string
+	ExceededCreatedAt time.Time
+	ExceededBy        time.Duration
+	BeforeID          string
+	BeforeCreatedAt   time.Time
+	BeforeXMin        string
+	BeforeBy          time.Duration
+	Gap               time.Duration
+	BeyondHead        bool
+	NullSkipped       int
+	TxidSnapshot      string
+}
+
+func newTemplateResult(result xidfortime.Result) templateResult {
+	return templateResult{
+		Xid:               result.XID(),
+		Xid8:              result.XID8,
+		LowerXid:          result.LowerXID(),
+		UpperXid:          result.UpperXID(),
+		Strategy:          result.Strategy,
+		TargetTime:        result.TargetTime,
+		MinID:             result.Thresholds.MinID,
+		MinCreatedAt:      result.Thresholds.MinCreatedAt,
+		MaxID:             result.Thresholds.MaxID,
+		MaxCreatedAt:      result.Thresholds.MaxCreatedAt,
+		ExceededID:        result.Exceeded.ID,
+		ExceededCreatedAt: result.Exceeded.CreatedAt,
+		ExceededBy:        result.ExceededBy(),
+		BeforeID:          result.Before.ID,
+		BeforeCreatedAt:   result.Before.CreatedAt,
+		BeforeXMin:        result.Before.XMin,
+		BeforeBy:          result.BeforeBy(),
+		Gap:               result.Gap(),
+		BeyondHead:        result.BeyondHead,
+		NullSkipped:       result.NullSkipped,
+		TxidSnapshot:      result.TxidSnapshot,
+	}
+}
+
+type jsonResult struct {
+	xidfortime.Result
+	XID        string `json:"xid"`
+	LowerXID   string `json:"lower_xid"`
+	UpperXID   string `json:"upper_xid"`
+	ExceededBy string `json:"exceeded_by"`
+	BeforeBy   string `json:"before_by"`
+	Gap        string `json:"gap"`
+}
+
+func newJSONResult(result xidfortime.Result) jsonResult {
+	return jsonResult{
+		Result:     result,
+		XID:        result.XID(),
+		LowerXID:   result.LowerXID(),
+		UpperXID:   result.UpperXID(),
+		ExceededBy: result.ExceededBy().String(),
+		BeforeBy:   result.BeforeBy().String(),
+		Gap:        result.Gap().String(),
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// Members of a Patroni cluster that --patroni-member can pick
+const (
+	patroniPrimary     = "primary"
+	patroniSyncReplica = "sync-replica"
+	patroniReplica     = "replica"
+)
+
+var patroniMembers = []string{patroniPrimary, patroniSyncReplica, patroniReplica}
+
+// patroniTimeout bounds each request to the Patroni REST API.
+const patroniTimeout = 5 * time.Second
+
+// patroniMember is a member of the cluster, as listed by GET /cluster.
+type patroniMember struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	State string `json:"state"`
+	Host  string `json:"host"`
+	Port  uint16 `json:"port"`
+	// Lag is how many bytes of WAL a replica is behind, or "unknown"
+	Lag  interface{}            `json:"lag"`
+	Tags map[string]interface{} `json:"tags"`
+}
+
+func (m patroniMember) leader() bool {
+	return m.Role == "leader" || m.Role == "standby_leader"
+}
+
+// loadBalanced is whether the member may serve reads, which members tagged
+// noloadbalance aren't meant to.
+func (m patroniMember) loadBalanced() bool {
+	return m.Tags["noloadbalance"] != true
+}
+
+// lag is how far behind the member is, putting members of unknown lag last.
+func (m patroniMember) lag() float64 {
+	if lag, ok := m.Lag.(float64); ok {
+		return lag
+	}
+	if m.leader() {
+		return 0
+	}
+
+	return -1
+}
+
+// dialPatroni points the connection at the member of the Patroni cluster asked
+// for, found from the first of urls to answer. The member is discovered every
+// time we connect, so runs after a failover follow it without any change of
+// flags.
+func dialPatroni(ctx context.Context, cfg *pgx.ConnConfig, urls []string, want string) error {
+	member, err := discoverPatroni(ctx, urls, want)
+	if err != nil {
+		return err
+	}
+
+	level.Info(logger).Log("event", "discovered_patroni_member", "member", member.Name, "role", member.Role,
+		"host", member.Host, "port", member.Port)
+
+	cfg.Host, cfg.Port, cfg.Fallbacks = member.Host, member.Port, nil
+	return nil
+}
+
+func discoverPatroni(ctx context.Context, urls []string, want string) (patroniMember, error) {
+	var lastErr error
+	for _, url := range urls {
+		members, err := patroniCluster(ctx, url)
+		if err != nil {
+			level.Warn(logger).Log("event", "patroni_unavailable", "url", url, "error", err)
+			lastErr = err
+			continue
+		}
+
+		return pickPatroniMember(members, want)
+	}
+
+	return patroniMember{}, fmt.Errorf("no Patroni API answered: %w", lastErr)
+}
+
+func patroniCluster(ctx context.Context, url string) ([]patroniMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, patroniTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/cluster", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from Patroni: %s", resp.Status)
+	}
+
+	var cluster struct {
+		Members []patroniMember `json:"members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cluster); err != nil {
+		return nil, fmt.Errorf("invalid cluster from Patroni: %w", err)
+	}
+
+	return cluster.Members, nil
+}
+
+// pickPatroniMember picks the running member in the role asked for, preferring
+// the replicas least behind. Replicas tagged noloadbalance are never picked.
+func pickPatroniMember(members []patroniMember, want string) (patroniMember, error) {
+	var candidates []patroniMember
+	for _, member := range members {
+		if member.State != "running" && member.State != "streaming" {
+			continue
+		}
+
+		switch want {
+		case patroniPrimary:
+			if !member.leader() {
+				continue
+			}
+		case patroniSyncReplica:
+			if member.Role != "sync_standby" || !member.loadBalanced() {
+				continue
+			}
+		default:
+			if member.leader() || !member.loadBalanced() {
+				continue
+			}
+		}
+
+		candidates = append(candidates, member)
+	}
+
+	if len(candidates) == 0 {
+		return patroniMember{}, fmt.Errorf("no running %s in the Patroni cluster", want)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		li, lj := candidates[i].lag(), candidates[j].lag()
+		return li >= 0 && (lj < 0 || li < lj)
+	})
+
+	return candidates[0], nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	restorePgbackrest        = restore.Command("pgbackrest", "Pick the pgBackRest backup set to restore from, and print the restore command")
+	restorePgbackrestTable   = restorePgbackrest.Arg("table", "Table to use for estimates, unless given by --target").String()
+	restorePgbackrestTime    = restorePgbackrest.Arg("time", "Target time to restore to").String()
+	restorePgbackrestStanza  = restorePgbackrest.Flag("stanza", "Stanza to restore").Required().String()
+	restorePgbackrestInfo    = restorePgbackrest.Flag("info", "Output of pgbackrest info --output=json to read instead of running pgbackrest, or - for stdin").String()
+	restorePgbackrestCommand = restorePgbackrest.Flag("pgbackrest", "pgbackrest executable").Default("pgbackrest").String()
+)
+
+// pgbackrestStanza is a stanza as described by pgbackrest info --output=json,
+// with only the fields we need to pick a backup.
+type pgbackrestStanza struct {
+	Name   string `json:"name"`
+	Backup []struct {
+		Label     string `json:"label"`
+		Timestamp struct {
+			Stop int64 `json:"stop"`
+		} `json:"timestamp"`
+	} `json:"backup"`
+}
+
+func runRestorePgbackrest(ctx context.Context) {
+	if *restorePgbackrestTable == "" || *restorePgbackrestTime == "" {
+		kingpin.Fatalf("required arguments 'table' and 'time' not provided, nor the table by --target")
+	}
+
+	info, err := readCatalog(ctx, *restorePgbackrestInfo,
+		*restorePgbackrestCommand, "--stanza="+*restorePgbackrestStanza, "--output=json", "info")
+	if err != nil {
+		fatal(err)
+	}
+
+	backups, err := pgbackrestBackups(info, *restorePgbackrestStanza)
+	if err != nil {
+		fatal(err)
+	}
+
+	result, _, err := restoreTarget(ctx, *restorePgbackrestTable, *restorePgbackrestTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	set, err := latestBackupBefore(backups, result.TargetTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	xid, inclusive := recoveryTarget(result)
+	command := []string{*restorePgbackrestCommand, "--stanza=" + *restorePgbackrestStanza, "--set=" + set.Label,
+		"--type=xid", "--target=" + xid}
+	if !inclusive {
+		command = append(command, "--target-exclusive")
+	}
+	command = append(command, "restore")
+
+	if _, err := fmt.Fprintln(os.Stdout, shellCommand(command...)); err != nil {
+		kingpin.Fatalf("failed to write command: %v", err)
+	}
+}
+
+// pgbackrestBackups lists the backups of the stanza from pgbackrest info.
+func pgbackrestBackups(info []byte, name string) ([]backup, error) {
+	var stanzas []pgbackrestStanza
+	if err := json.Unmarshal(info, &stanzas); err != nil {
+		return nil, fmt.Errorf("invalid pgbackrest info: %w", err)
+	}
+
+	for _, stanza := range stanzas {
+		if stanza.Name != name {
+			continue
+		}
+
+		backups := make([]backup, 0, len(stanza.Backup))
+		for _, b := range stanza.Backup {
+			backups = append(backups, backup{Label: b.Label, Stop: time.Unix(b.Timestamp.Stop, 0).UTC()})
+		}
+
+		return backups, nil
+	}
+
+	return nil, fmt.Errorf("no stanza named %q in pgbackrest info", name)
+}
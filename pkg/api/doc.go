@@ -0,0 +1,5 @@
+// Package api is the gRPC interface to the estimator, generated from
+// xidfortime.proto.
+package api
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. xidfortime.proto
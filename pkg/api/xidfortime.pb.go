@@ -0,0 +1,960 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.21.0
+// 	protoc        (unknown)
+// source: xidfortime.proto
+
+package api
+
+import (
+	context "context"
+	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// Row is a single row of the estimation table.
+type Row struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id        string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt *timestamp.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Xmin      string               `protobuf:"bytes,3,opt,name=xmin,proto3" json:"xmin,omitempty"`
+}
+
+func (x *Row) Reset() {
+	*x = Row{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Row) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Row) ProtoMessage() {}
+
+func (x *Row) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Row.ProtoReflect.Descriptor instead.
+func (*Row) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Row) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Row) GetCreatedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Row) GetXmin() string {
+	if x != nil {
+		return x.Xmin
+	}
+	return ""
+}
+
+type EstimateXidRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Table to use for estimates, optionally schema-qualified.
+	Table string               `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Time  *timestamp.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Columns and strategy default as they do on the command line.
+	IdColumn   string `protobuf:"bytes,3,opt,name=id_column,json=idColumn,proto3" json:"id_column,omitempty"`
+	TimeColumn string `protobuf:"bytes,4,opt,name=time_column,json=timeColumn,proto3" json:"time_column,omitempty"`
+	Strategy   string `protobuf:"bytes,5,opt,name=strategy,proto3" json:"strategy,omitempty"`
+}
+
+func (x *EstimateXidRequest) Reset() {
+	*x = EstimateXidRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EstimateXidRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateXidRequest) ProtoMessage() {}
+
+func (x *EstimateXidRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateXidRequest.ProtoReflect.Descriptor instead.
+func (*EstimateXidRequest) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EstimateXidRequest) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *EstimateXidRequest) GetTime() *timestamp.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *EstimateXidRequest) GetIdColumn() string {
+	if x != nil {
+		return x.IdColumn
+	}
+	return ""
+}
+
+func (x *EstimateXidRequest) GetTimeColumn() string {
+	if x != nil {
+		return x.TimeColumn
+	}
+	return ""
+}
+
+func (x *EstimateXidRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+type EstimateXidResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Xid string `protobuf:"bytes,1,opt,name=xid,proto3" json:"xid,omitempty"`
+	// Epoch-qualified xid, comparable with pg_current_xact_id().
+	Xid8       string               `protobuf:"bytes,2,opt,name=xid8,proto3" json:"xid8,omitempty"`
+	Strategy   string               `protobuf:"bytes,3,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	TargetTime *timestamp.Timestamp `protobuf:"bytes,4,opt,name=target_time,json=targetTime,proto3" json:"target_time,omitempty"`
+	// Rows inserted either side of the target time, whose xmins bracket it.
+	Before   *Row               `protobuf:"bytes,5,opt,name=before,proto3" json:"before,omitempty"`
+	Exceeded *Row               `protobuf:"bytes,6,opt,name=exceeded,proto3" json:"exceeded,omitempty"`
+	LowerXid string             `protobuf:"bytes,7,opt,name=lower_xid,json=lowerXid,proto3" json:"lower_xid,omitempty"`
+	UpperXid string             `protobuf:"bytes,8,opt,name=upper_xid,json=upperXid,proto3" json:"upper_xid,omitempty"`
+	Gap      *duration.Duration `protobuf:"bytes,9,opt,name=gap,proto3" json:"gap,omitempty"`
+}
+
+func (x *EstimateXidResponse) Reset() {
+	*x = EstimateXidResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EstimateXidResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateXidResponse) ProtoMessage() {}
+
+func (x *EstimateXidResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateXidResponse.ProtoReflect.Descriptor instead.
+func (*EstimateXidResponse) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EstimateXidResponse) GetXid() string {
+	if x != nil {
+		return x.Xid
+	}
+	return ""
+}
+
+func (x *EstimateXidResponse) GetXid8() string {
+	if x != nil {
+		return x.Xid8
+	}
+	return ""
+}
+
+func (x *EstimateXidResponse) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *EstimateXidResponse) GetTargetTime() *timestamp.Timestamp {
+	if x != nil {
+		return x.TargetTime
+	}
+	return nil
+}
+
+func (x *EstimateXidResponse) GetBefore() *Row {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *EstimateXidResponse) GetExceeded() *Row {
+	if x != nil {
+		return x.Exceeded
+	}
+	return nil
+}
+
+func (x *EstimateXidResponse) GetLowerXid() string {
+	if x != nil {
+		return x.LowerXid
+	}
+	return ""
+}
+
+func (x *EstimateXidResponse) GetUpperXid() string {
+	if x != nil {
+		return x.UpperXid
+	}
+	return ""
+}
+
+func (x *EstimateXidResponse) GetGap() *duration.Duration {
+	if x != nil {
+		return x.Gap
+	}
+	return nil
+}
+
+type TimeForXidRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Table      string `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Xid        string `protobuf:"bytes,2,opt,name=xid,proto3" json:"xid,omitempty"`
+	IdColumn   string `protobuf:"bytes,3,opt,name=id_column,json=idColumn,proto3" json:"id_column,omitempty"`
+	TimeColumn string `protobuf:"bytes,4,opt,name=time_column,json=timeColumn,proto3" json:"time_column,omitempty"`
+	Strategy   string `protobuf:"bytes,5,opt,name=strategy,proto3" json:"strategy,omitempty"`
+}
+
+func (x *TimeForXidRequest) Reset() {
+	*x = TimeForXidRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TimeForXidRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimeForXidRequest) ProtoMessage() {}
+
+func (x *TimeForXidRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimeForXidRequest.ProtoReflect.Descriptor instead.
+func (*TimeForXidRequest) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TimeForXidRequest) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *TimeForXidRequest) GetXid() string {
+	if x != nil {
+		return x.Xid
+	}
+	return ""
+}
+
+func (x *TimeForXidRequest) GetIdColumn() string {
+	if x != nil {
+		return x.IdColumn
+	}
+	return ""
+}
+
+func (x *TimeForXidRequest) GetTimeColumn() string {
+	if x != nil {
+		return x.TimeColumn
+	}
+	return ""
+}
+
+func (x *TimeForXidRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+type TimeForXidResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Xid         string               `protobuf:"bytes,1,opt,name=xid,proto3" json:"xid,omitempty"`
+	Strategy    string               `protobuf:"bytes,2,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	CommittedAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=committed_at,json=committedAt,proto3" json:"committed_at,omitempty"`
+	// Rows whose xmins bracket the xid, unset for exact results.
+	Before *Row               `protobuf:"bytes,4,opt,name=before,proto3" json:"before,omitempty"`
+	After  *Row               `protobuf:"bytes,5,opt,name=after,proto3" json:"after,omitempty"`
+	Gap    *duration.Duration `protobuf:"bytes,6,opt,name=gap,proto3" json:"gap,omitempty"`
+}
+
+func (x *TimeForXidResponse) Reset() {
+	*x = TimeForXidResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TimeForXidResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimeForXidResponse) ProtoMessage() {}
+
+func (x *TimeForXidResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimeForXidResponse.ProtoReflect.Descriptor instead.
+func (*TimeForXidResponse) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TimeForXidResponse) GetXid() string {
+	if x != nil {
+		return x.Xid
+	}
+	return ""
+}
+
+func (x *TimeForXidResponse) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *TimeForXidResponse) GetCommittedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.CommittedAt
+	}
+	return nil
+}
+
+func (x *TimeForXidResponse) GetBefore() *Row {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *TimeForXidResponse) GetAfter() *Row {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+func (x *TimeForXidResponse) GetGap() *duration.Duration {
+	if x != nil {
+		return x.Gap
+	}
+	return nil
+}
+
+type HealthRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{5}
+}
+
+type HealthResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Serving bool `protobuf:"varint,1,opt,name=serving,proto3" json:"serving,omitempty"`
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_xidfortime_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_xidfortime_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_xidfortime_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HealthResponse) GetServing() bool {
+	if x != nil {
+		return x.Serving
+	}
+	return false
+}
+
+var File_xidfortime_proto protoreflect.FileDescriptor
+
+var file_xidfortime_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x0d, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d, 0x65, 0x2e, 0x76,
+	0x31, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0x64, 0x0a, 0x03, 0x52, 0x6f, 0x77, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x39, 0x0a, 0x0a, 0x63, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74,
+	0x65, 0x64, 0x41, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x78, 0x6d, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x78, 0x6d, 0x69, 0x6e, 0x22, 0xb4, 0x01, 0x0a, 0x12, 0x45, 0x73, 0x74,
+	0x69, 0x6d, 0x61, 0x74, 0x65, 0x58, 0x69, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x14, 0x0a, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x74, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x64, 0x5f, 0x63, 0x6f, 0x6c, 0x75,
+	0x6d, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x69, 0x64, 0x43, 0x6f, 0x6c, 0x75,
+	0x6d, 0x6e, 0x12, 0x1f, 0x0a, 0x0b, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x63, 0x6f, 0x6c, 0x75, 0x6d,
+	0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x74, 0x69, 0x6d, 0x65, 0x43, 0x6f, 0x6c,
+	0x75, 0x6d, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x22,
+	0xd7, 0x02, 0x0a, 0x13, 0x45, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x58, 0x69, 0x64, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x78, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x78, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x78, 0x69, 0x64,
+	0x38, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x78, 0x69, 0x64, 0x38, 0x12, 0x1a, 0x0a,
+	0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x12, 0x3b, 0x0a, 0x0b, 0x74, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0a, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2a, 0x0a, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74,
+	0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x6f, 0x77, 0x52, 0x06, 0x62, 0x65, 0x66, 0x6f,
+	0x72, 0x65, 0x12, 0x2e, 0x0a, 0x08, 0x65, 0x78, 0x63, 0x65, 0x65, 0x64, 0x65, 0x64, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d,
+	0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x6f, 0x77, 0x52, 0x08, 0x65, 0x78, 0x63, 0x65, 0x65, 0x64,
+	0x65, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x6f, 0x77, 0x65, 0x72, 0x5f, 0x78, 0x69, 0x64, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x6f, 0x77, 0x65, 0x72, 0x58, 0x69, 0x64, 0x12,
+	0x1b, 0x0a, 0x09, 0x75, 0x70, 0x70, 0x65, 0x72, 0x5f, 0x78, 0x69, 0x64, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x75, 0x70, 0x70, 0x65, 0x72, 0x58, 0x69, 0x64, 0x12, 0x2b, 0x0a, 0x03,
+	0x67, 0x61, 0x70, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x52, 0x03, 0x67, 0x61, 0x70, 0x22, 0x95, 0x01, 0x0a, 0x11, 0x54, 0x69,
+	0x6d, 0x65, 0x46, 0x6f, 0x72, 0x58, 0x69, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x14, 0x0a, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x74, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x78, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x78, 0x69, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x64, 0x5f, 0x63, 0x6f,
+	0x6c, 0x75, 0x6d, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x69, 0x64, 0x43, 0x6f,
+	0x6c, 0x75, 0x6d, 0x6e, 0x12, 0x1f, 0x0a, 0x0b, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x63, 0x6f, 0x6c,
+	0x75, 0x6d, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x74, 0x69, 0x6d, 0x65, 0x43,
+	0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67,
+	0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67,
+	0x79, 0x22, 0x84, 0x02, 0x0a, 0x12, 0x54, 0x69, 0x6d, 0x65, 0x46, 0x6f, 0x72, 0x58, 0x69, 0x64,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x78, 0x69, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x78, 0x69, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x74,
+	0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74,
+	0x72, 0x61, 0x74, 0x65, 0x67, 0x79, 0x12, 0x3d, 0x0a, 0x0c, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74,
+	0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74,
+	0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x2a, 0x0a, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69,
+	0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x6f, 0x77, 0x52, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72,
+	0x65, 0x12, 0x28, 0x0a, 0x05, 0x61, 0x66, 0x74, 0x65, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x12, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x52, 0x6f, 0x77, 0x52, 0x05, 0x61, 0x66, 0x74, 0x65, 0x72, 0x12, 0x2b, 0x0a, 0x03, 0x67,
+	0x61, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x03, 0x67, 0x61, 0x70, 0x22, 0x0f, 0x0a, 0x0d, 0x48, 0x65, 0x61, 0x6c,
+	0x74, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x2a, 0x0a, 0x0e, 0x48, 0x65, 0x61,
+	0x6c, 0x74, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73,
+	0x65, 0x72, 0x76, 0x69, 0x6e, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x65,
+	0x72, 0x76, 0x69, 0x6e, 0x67, 0x32, 0xfc, 0x01, 0x0a, 0x0a, 0x58, 0x69, 0x64, 0x46, 0x6f, 0x72,
+	0x54, 0x69, 0x6d, 0x65, 0x12, 0x54, 0x0a, 0x0b, 0x45, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65,
+	0x58, 0x69, 0x64, 0x12, 0x21, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x45, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x58, 0x69, 0x64, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74,
+	0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x58,
+	0x69, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x51, 0x0a, 0x0a, 0x54, 0x69,
+	0x6d, 0x65, 0x46, 0x6f, 0x72, 0x58, 0x69, 0x64, 0x12, 0x20, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f,
+	0x72, 0x74, 0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x46, 0x6f, 0x72,
+	0x58, 0x69, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x78, 0x69, 0x64,
+	0x66, 0x6f, 0x72, 0x74, 0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x46,
+	0x6f, 0x72, 0x58, 0x69, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x45, 0x0a,
+	0x06, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x12, 0x1c, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72,
+	0x74, 0x69, 0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x78, 0x69, 0x64, 0x66, 0x6f, 0x72, 0x74, 0x69,
+	0x6d, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x6c, 0x61, 0x77, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x6a, 0x6f, 0x6e, 0x65, 0x73,
+	0x2f, 0x78, 0x69, 0x64, 0x2d, 0x66, 0x6f, 0x72, 0x2d, 0x74, 0x69, 0x6d, 0x65, 0x2f, 0x70, 0x6b,
+	0x67, 0x2f, 0x61, 0x70, 0x69, 0x3b, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_xidfortime_proto_rawDescOnce sync.Once
+	file_xidfortime_proto_rawDescData = file_xidfortime_proto_rawDesc
+)
+
+func file_xidfortime_proto_rawDescGZIP() []byte {
+	file_xidfortime_proto_rawDescOnce.Do(func() {
+		file_xidfortime_proto_rawDescData = protoimpl.X.CompressGZIP(file_xidfortime_proto_rawDescData)
+	})
+	return file_xidfortime_proto_rawDescData
+}
+
+var file_xidfortime_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_xidfortime_proto_goTypes = []interface{}{
+	(*Row)(nil),                 // 0: xidfortime.v1.Row
+	(*EstimateXidRequest)(nil),  // 1: xidfortime.v1.EstimateXidRequest
+	(*EstimateXidResponse)(nil), // 2: xidfortime.v1.EstimateXidResponse
+	(*TimeForXidRequest)(nil),   // 3: xidfortime.v1.TimeForXidRequest
+	(*TimeForXidResponse)(nil),  // 4: xidfortime.v1.TimeForXidResponse
+	(*HealthRequest)(nil),       // 5: xidfortime.v1.HealthRequest
+	(*HealthResponse)(nil),      // 6: xidfortime.v1.HealthResponse
+	(*timestamp.Timestamp)(nil), // 7: google.protobuf.Timestamp
+	(*duration.Duration)(nil),   // 8: google.protobuf.Duration
+}
+var file_xidfortime_proto_depIdxs = []int32{
+	7,  // 0: xidfortime.v1.Row.created_at:type_name -> google.protobuf.Timestamp
+	7,  // 1: xidfortime.v1.EstimateXidRequest.time:type_name -> google.protobuf.Timestamp
+	7,  // 2: xidfortime.v1.EstimateXidResponse.target_time:type_name -> google.protobuf.Timestamp
+	0,  // 3: xidfortime.v1.EstimateXidResponse.before:type_name -> xidfortime.v1.Row
+	0,  // 4: xidfortime.v1.EstimateXidResponse.exceeded:type_name -> xidfortime.v1.Row
+	8,  // 5: xidfortime.v1.EstimateXidResponse.gap:type_name -> google.protobuf.Duration
+	7,  // 6: xidfortime.v1.TimeForXidResponse.committed_at:type_name -> google.protobuf.Timestamp
+	0,  // 7: xidfortime.v1.TimeForXidResponse.before:type_name -> xidfortime.v1.Row
+	0,  // 8: xidfortime.v1.TimeForXidResponse.after:type_name -> xidfortime.v1.Row
+	8,  // 9: xidfortime.v1.TimeForXidResponse.gap:type_name -> google.protobuf.Duration
+	1,  // 10: xidfortime.v1.XidForTime.EstimateXid:input_type -> xidfortime.v1.EstimateXidRequest
+	3,  // 11: xidfortime.v1.XidForTime.TimeForXid:input_type -> xidfortime.v1.TimeForXidRequest
+	5,  // 12: xidfortime.v1.XidForTime.Health:input_type -> xidfortime.v1.HealthRequest
+	2,  // 13: xidfortime.v1.XidForTime.EstimateXid:output_type -> xidfortime.v1.EstimateXidResponse
+	4,  // 14: xidfortime.v1.XidForTime.TimeForXid:output_type -> xidfortime.v1.TimeForXidResponse
+	6,  // 15: xidfortime.v1.XidForTime.Health:output_type -> xidfortime.v1.HealthResponse
+	13, // [13:16] is the sub-list for method output_type
+	10, // [10:13] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_xidfortime_proto_init() }
+func file_xidfortime_proto_init() {
+	if File_xidfortime_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_xidfortime_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Row); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EstimateXidRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EstimateXidResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TimeForXidRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TimeForXidResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HealthRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_xidfortime_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HealthResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_xidfortime_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_xidfortime_proto_goTypes,
+		DependencyIndexes: file_xidfortime_proto_depIdxs,
+		MessageInfos:      file_xidfortime_proto_msgTypes,
+	}.Build()
+	File_xidfortime_proto = out.File
+	file_xidfortime_proto_rawDesc = nil
+	file_xidfortime_proto_goTypes = nil
+	file_xidfortime_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// XidForTimeClient is the client API for XidForTime service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type XidForTimeClient interface {
+	// EstimateXid finds the last xid that committed before a time.
+	EstimateXid(ctx context.Context, in *EstimateXidRequest, opts ...grpc.CallOption) (*EstimateXidResponse, error)
+	// TimeForXid estimates when an xid committed.
+	TimeForXid(ctx context.Context, in *TimeForXidRequest, opts ...grpc.CallOption) (*TimeForXidResponse, error)
+	// Health reports whether the database is reachable.
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type xidForTimeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewXidForTimeClient(cc grpc.ClientConnInterface) XidForTimeClient {
+	return &xidForTimeClient{cc}
+}
+
+func (c *xidForTimeClient) EstimateXid(ctx context.Context, in *EstimateXidRequest, opts ...grpc.CallOption) (*EstimateXidResponse, error) {
+	out := new(EstimateXidResponse)
+	err := c.cc.Invoke(ctx, "/xidfortime.v1.XidForTime/EstimateXid", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *xidForTimeClient) TimeForXid(ctx context.Context, in *TimeForXidRequest, opts ...grpc.CallOption) (*TimeForXidResponse, error) {
+	out := new(TimeForXidResponse)
+	err := c.cc.Invoke(ctx, "/xidfortime.v1.XidForTime/TimeForXid", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *xidForTimeClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, "/xidfortime.v1.XidForTime/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// XidForTimeServer is the server API for XidForTime service.
+type XidForTimeServer interface {
+	// EstimateXid finds the last xid that committed before a time.
+	EstimateXid(context.Context, *EstimateXidRequest) (*EstimateXidResponse, error)
+	// TimeForXid estimates when an xid committed.
+	TimeForXid(context.Context, *TimeForXidRequest) (*TimeForXidResponse, error)
+	// Health reports whether the database is reachable.
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+}
+
+// UnimplementedXidForTimeServer can be embedded to have forward compatible implementations.
+type UnimplementedXidForTimeServer struct {
+}
+
+func (*UnimplementedXidForTimeServer) EstimateXid(context.Context, *EstimateXidRequest) (*EstimateXidResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EstimateXid not implemented")
+}
+func (*UnimplementedXidForTimeServer) TimeForXid(context.Context, *TimeForXidRequest) (*TimeForXidResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TimeForXid not implemented")
+}
+func (*UnimplementedXidForTimeServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+
+func RegisterXidForTimeServer(s *grpc.Server, srv XidForTimeServer) {
+	s.RegisterService(&_XidForTime_serviceDesc, srv)
+}
+
+func _XidForTime_EstimateXid_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EstimateXidRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(XidForTimeServer).EstimateXid(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/xidfortime.v1.XidForTime/EstimateXid",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(XidForTimeServer).EstimateXid(ctx, req.(*EstimateXidRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _XidForTime_TimeForXid_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TimeForXidRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(XidForTimeServer).TimeForXid(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/xidfortime.v1.XidForTime/TimeForXid",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(XidForTimeServer).TimeForXid(ctx, req.(*TimeForXidRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _XidForTime_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(XidForTimeServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/xidfortime.v1.XidForTime/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(XidForTimeServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _XidForTime_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "xidfortime.v1.XidForTime",
+	HandlerType: (*XidForTimeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EstimateXid",
+			Handler:    _XidForTime_EstimateXid_Handler,
+		},
+		{
+			MethodName: "TimeForXid",
+			Handler:    _XidForTime_TimeForXid_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _XidForTime_Health_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "xidfortime.proto",
+}
@@ -0,0 +1,312 @@
+package wal
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+var (
+	// ErrNoSegments is returned when an archive has no WAL segments to read.
+	ErrNoSegments = errors.New("no WAL segments in archive")
+	// ErrNoCommitBefore is returned when the archive starts after the target.
+	ErrNoCommitBefore = errors.New("no commit before target in archive")
+)
+
+// Archive is somewhere WAL segments were archived to, such as a directory or
+// a bucket.
+type Archive interface {
+	// List returns the name of every file in the archive
+	List(ctx context.Context) ([]string, error)
+	// Open reads a file listed by List
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// LSN is a location in WAL, printed as Postgres does.
+type LSN uint64
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint64(l)>>32, uint64(l)&0xFFFFFFFF)
+}
+
+// ParseLSN parses the textual form of a pg_lsn, such as 16/B374D848.
+func ParseLSN(lsn string) (LSN, error) {
+	parts := strings.Split(lsn, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid lsn %q", lsn)
+	}
+
+	hi, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q: %w", lsn, err)
+	}
+	lo, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q: %w", lsn, err)
+	}
+
+	return LSN(hi<<32 | lo), nil
+}
+
+// MarshalText prints the LSN in JSON as Postgres does.
+func (l LSN) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Segment is a WAL segment file in an archive.
+type Segment struct {
+	Name     string
+	Timeline uint32
+	Log, Seg uint32
+}
+
+// segmentPattern matches the names of archived segments, allowing for the
+// checksum pgBackRest appends and gzip compression, as most tools support.
+var segmentPattern = regexp.MustCompile(`^([0-9A-F]{8})([0-9A-F]{8})([0-9A-F]{8})(?:-[0-9a-f]{40})?(\.gz)?$`)
+
+// ParseSegment parses the name of an archived segment, reporting false for
+// any other file, such as history files and partial segments.
+func ParseSegment(name string) (Segment, bool) {
+	match := segmentPattern.FindStringSubmatch(path.Base(filepath.ToSlash(name)))
+	if match == nil {
+		return Segment{}, false
+	}
+
+	parse := func(hex string) uint32 {
+		value, _ := strconv.ParseUint(hex, 16, 32)
+		return uint32(value)
+	}
+
+	return Segment{Name: name, Timeline: parse(match[1]), Log: parse(match[2]), Seg: parse(match[3])}, true
+}
+
+// selectSegments picks the segments to read in WAL order, each from the newest
+// timeline up to the given one that has it, or the newest in the archive when
+// zero. This follows the history of a cluster promoted one timeline after
+// another, though not one with branches that were abandoned.
+func selectSegments(names []string, timeline uint32) ([]Segment, uint32) {
+	var parsed []Segment
+	for _, name := range names {
+		if seg, ok := ParseSegment(name); ok {
+			parsed = append(parsed, seg)
+			if seg.Timeline > timeline && timeline == 0 {
+				timeline = seg.Timeline
+			}
+		}
+	}
+
+	type position struct{ log, seg uint32 }
+	newest := map[position]Segment{}
+	for _, seg := range parsed {
+		pos := position{seg.Log, seg.Seg}
+		if existing, ok := newest[pos]; seg.Timeline <= timeline && (!ok || seg.Timeline > existing.Timeline) {
+			newest[pos] = seg
+		}
+	}
+
+	segments := make([]Segment, 0, len(newest))
+	for _, seg := range newest {
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Log != segments[j].Log {
+			return segments[i].Log < segments[j].Log
+		}
+		return segments[i].Seg < segments[j].Seg
+	})
+
+	return segments, timeline
+}
+
+// Result is the last commit before a target time, as recovery to that time
+// would replay.
+type Result struct {
+	TargetTime   time.Time `json:"target_time"`
+	Timeline     uint32    `json:"timeline,omitempty"`
+	Before       Commit    `json:"before"`
+	After        *Commit   `json:"after,omitempty"`
+	SegmentsRead int       `json:"segments_read,omitempty"`
+	Skipped      int       `json:"skipped_commits,omitempty"`
+}
+
+// Searcher searches an archive for commits around a target time.
+type Searcher struct {
+	Archive  Archive
+	Timeline uint32 // timeline to follow, or zero for the newest
+
+	Logger kitlog.Logger
+}
+
+// NewSearcher searches the archive, following the newest timeline.
+func NewSearcher(logger kitlog.Logger, archive Archive) *Searcher {
+	return &Searcher{Archive: archive, Logger: logger}
+}
+
+func (s *Searcher) logger() kitlog.Logger {
+	if s.Logger == nil {
+		return kitlog.NewNopLogger()
+	}
+
+	return s.Logger
+}
+
+// Search finds the last commit before t in the archive. Recovery to t stops at
+// the first commit after it, so everything before that in WAL order is kept,
+// even if a commit timestamp runs slightly out of order.
+//
+// Segments are binary searched by the time of their first commit, so only a
+// handful need reading before scanning forward from the one holding t.
+func (s *Searcher) Search(ctx context.Context, t time.Time) (Result, error) {
+	names, err := s.Archive.List(ctx)
+	if err != nil {
+		return Result{TargetTime: t}, fmt.Errorf("failed to list archive: %w", err)
+	}
+
+	segments, timeline := selectSegments(names, s.Timeline)
+	result := Result{TargetTime: t, Timeline: timeline}
+	if len(segments) == 0 {
+		return result, ErrNoSegments
+	}
+
+	level.Debug(s.logger()).Log("event", "listed_segments", "segments", len(segments), "timeline", timeline,
+		"first", segments[0].Name, "last", segments[len(segments)-1].Name)
+
+	// Segments without any commit take the first commit of those after them,
+	// keeping the search monotonic
+	var (
+		firsts   = map[int]*Commit{}
+		probed   = map[int]bool{}
+		probeErr error
+	)
+	firstCommit := func(idx int) (*Commit, error) {
+		for ; idx < len(segments); idx++ {
+			if !probed[idx] {
+				commit, err := s.firstCommit(ctx, segments[idx])
+				if err != nil {
+					return nil, err
+				}
+
+				result.SegmentsRead++
+				firsts[idx], probed[idx] = commit, true
+			}
+			if firsts[idx] != nil {
+				return firsts[idx], nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	idx := sort.Search(len(segments), func(idx int) bool {
+		commit, err := firstCommit(idx)
+		if err != nil {
+			probeErr = err
+			return true
+		}
+
+		return commit == nil || commit.CommittedAt.After(t)
+	})
+	if probeErr != nil {
+		return result, probeErr
+	}
+	if idx == 0 {
+		first, _ := firstCommit(0)
+		if first == nil {
+			return result, fmt.Errorf("%w: no commit records found", ErrNoCommitBefore)
+		}
+
+		return result, fmt.Errorf("%w: first commit in archive was at %s", ErrNoCommitBefore, first.CommittedAt.Format(time.RFC3339Nano))
+	}
+
+	var before *Commit
+	d := &decoder{onCommit: func(commit Commit) error {
+		if commit.CommittedAt.After(t) {
+			result.After = &commit
+			return errStop
+		}
+
+		before = &commit
+		return nil
+	}}
+
+	for _, seg := range segments[idx-1:] {
+		err := s.read(ctx, seg, d)
+		result.SegmentsRead++
+		if errors.Is(err, errStop) {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if before == nil {
+		return result, fmt.Errorf("%w: commits are out of order around the target", ErrNoCommitBefore)
+	}
+
+	result.Before, result.Skipped = *before, d.skipped
+	if result.After == nil {
+		level.Warn(s.logger()).Log("event", "archive_ends_before_target",
+			"msg", "no commit after the target has been archived yet, so later commits before it may be missing")
+	}
+
+	level.Info(s.logger()).Log("event", "found_commit", "xid", result.Before.XID, "lsn", result.Before.LSN,
+		"committed_at", result.Before.CommittedAt, "segments_read", result.SegmentsRead, "skipped_commits", result.Skipped)
+	return result, nil
+}
+
+// firstCommit reads the first commit record of a segment, or nil if it has
+// none.
+func (s *Searcher) firstCommit(ctx context.Context, seg Segment) (*Commit, error) {
+	var first *Commit
+	d := &decoder{onCommit: func(commit Commit) error {
+		first = &commit
+		return errStop
+	}}
+
+	if err := s.read(ctx, seg, d); err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+
+	level.Debug(s.logger()).Log("event", "probed_segment", "segment", seg.Name, "found", first != nil)
+	return first, nil
+}
+
+// read decodes a segment from the archive, decompressing it if need be.
+func (s *Searcher) read(ctx context.Context, seg Segment, d *decoder) error {
+	file, err := s.Archive.Open(ctx, seg.Name)
+	if err != nil {
+		return fmt.Errorf("failed to open segment %s: %w", seg.Name, err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if path.Ext(seg.Name) == ".gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to decompress segment %s: %w", seg.Name, err)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	err = d.segment(r, seg.Log, seg.Seg)
+	if err != nil && !errors.Is(err, errStop) {
+		return fmt.Errorf("failed to read segment %s: %w", seg.Name, err)
+	}
+
+	return err
+}
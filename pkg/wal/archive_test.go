@@ -0,0 +1,37 @@
+package wal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLSN(t *testing.T) {
+	for _, tc := range []struct {
+		lsn   string
+		want  LSN
+		valid bool
+	}{
+		{lsn: "0/0", want: 0, valid: true},
+		{lsn: "16/B374D848", want: 0x16B374D848, valid: true},
+		{lsn: "16/b374d848", want: 0x16B374D848, valid: true},
+		{lsn: "FFFFFFFF/FFFFFFFF", want: 1<<64 - 1, valid: true},
+		{lsn: ""},
+		{lsn: "16"},
+		{lsn: "16/B374D848/0"},
+		{lsn: "16/B374D848x"},
+		{lsn: "100000000/0"},
+		{lsn: "-1/0"},
+	} {
+		got, err := ParseLSN(tc.lsn)
+		switch {
+		case tc.valid && err != nil:
+			t.Errorf("ParseLSN(%q) returned error: %v", tc.lsn, err)
+		case tc.valid && got != tc.want:
+			t.Errorf("ParseLSN(%q) = %s, want %s", tc.lsn, got, tc.want)
+		case tc.valid && got.String() != strings.ToUpper(tc.lsn):
+			t.Errorf("ParseLSN(%q) printed as %s", tc.lsn, got)
+		case !tc.valid && err == nil:
+			t.Errorf("ParseLSN(%q) = %s, want error", tc.lsn, got)
+		}
+	}
+}
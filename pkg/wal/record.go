@@ -0,0 +1,199 @@
+// Package wal reads commit records from archived Postgres WAL, to find the
+// exact last transaction that committed before a time without table
+// statistics or a connection to the database.
+//
+// Only what's needed to find commits is parsed: page headers, record headers
+// and the main data of transaction records. Records are checked against their
+// CRC, and WAL is assumed to have been written by a little-endian server, as
+// every platform Postgres is commonly run on is.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"time"
+)
+
+// Layout of WAL pages and records, from access/xlog_internal.h and
+// access/xlogrecord.h
+const (
+	shortPageHeaderSize = 24
+	longPageHeaderSize  = 40
+	recordHeaderSize    = 24
+	defaultPageSize     = 8192
+
+	pageFirstIsContRecord = 0x0001
+	pageLongHeader        = 0x0002
+
+	blockIDDataShort   = 255
+	blockIDDataLong    = 254
+	blockIDOrigin      = 253
+	blockIDTopLevelXID = 252
+)
+
+// Transaction records, from access/xact.h
+const (
+	rmXact = 1
+
+	xactOpMask        = 0x70
+	xactCommit        = 0x00
+	xactCommitPrepped = 0x30
+	xactHasInfo       = 0x80
+
+	xinfoHasDBInfo       = 1 << 0
+	xinfoHasSubxacts     = 1 << 1
+	xinfoHasRelFileNodes = 1 << 2
+	xinfoHasInvals       = 1 << 3
+	xinfoHasTwoPhase     = 1 << 4
+	xinfoHasDroppedStats = 1 << 8
+)
+
+// postgresEpoch is where TimestampTz counts microseconds from.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errUnsupportedRecord marks commit records we can't take the xid from, such
+// as prepared transactions whose commit records include stats that differ in
+// layout between versions.
+var errUnsupportedRecord = errors.New("unsupported commit record")
+
+// Commit is a commit record read from WAL.
+type Commit struct {
+	XID         uint32    `json:"xid"`
+	LSN         LSN       `json:"lsn"`
+	CommittedAt time.Time `json:"committed_at"`
+	Prepared    bool      `json:"prepared,omitempty"`
+}
+
+// validRecord checks the record's length and CRC, which covers the record
+// data followed by the header up to the CRC itself.
+func validRecord(rec []byte) bool {
+	if len(rec) < recordHeaderSize || binary.LittleEndian.Uint32(rec) != uint32(len(rec)) {
+		return false
+	}
+
+	crc := crc32.Update(0, castagnoli, rec[recordHeaderSize:])
+	crc = crc32.Update(crc, castagnoli, rec[:20])
+
+	return crc == binary.LittleEndian.Uint32(rec[20:])
+}
+
+// decodeCommit decodes a commit record, reporting false for any other record.
+func decodeCommit(lsn uint64, rec []byte) (Commit, bool, error) {
+	info, rmid := rec[16], rec[17]
+	if rmid != rmXact {
+		return Commit{}, false, nil
+	}
+
+	op := info & xactOpMask
+	if op != xactCommit && op != xactCommitPrepped {
+		return Commit{}, false, nil
+	}
+
+	main, err := mainData(rec)
+	if err != nil {
+		return Commit{}, true, err
+	}
+	if len(main) < 8 {
+		return Commit{}, true, errUnsupportedRecord
+	}
+
+	commit := Commit{
+		XID: binary.LittleEndian.Uint32(rec[4:]),
+		LSN: LSN(lsn),
+		CommittedAt: postgresEpoch.Add(
+			time.Duration(int64(binary.LittleEndian.Uint64(main))) * time.Microsecond),
+	}
+
+	// Prepared transactions are committed by whichever session runs COMMIT
+	// PREPARED, so their xid is in the record's main data
+	if op == xactCommitPrepped {
+		if info&xactHasInfo == 0 {
+			return commit, true, errUnsupportedRecord
+		}
+
+		xid, err := twoPhaseXID(main[8:])
+		if err != nil {
+			return commit, true, err
+		}
+
+		commit.XID, commit.Prepared = xid, true
+	}
+
+	return commit, true, nil
+}
+
+// mainData finds the main data of the record, which follows any block data at
+// the end of the record. Transaction records never reference blocks, so any
+// that do aren't parsed.
+func mainData(rec []byte) ([]byte, error) {
+	for pos := recordHeaderSize; pos < len(rec); {
+		switch rec[pos] {
+		case blockIDDataShort:
+			if pos+2 > len(rec) {
+				return nil, errUnsupportedRecord
+			}
+			return tail(rec, int(rec[pos+1]))
+		case blockIDDataLong:
+			if pos+5 > len(rec) {
+				return nil, errUnsupportedRecord
+			}
+			return tail(rec, int(binary.LittleEndian.Uint32(rec[pos+1:])))
+		case blockIDOrigin:
+			pos += 3
+		case blockIDTopLevelXID:
+			pos += 5
+		default:
+			return nil, errUnsupportedRecord
+		}
+	}
+
+	return nil, nil
+}
+
+func tail(rec []byte, length int) ([]byte, error) {
+	if length > len(rec)-recordHeaderSize {
+		return nil, errUnsupportedRecord
+	}
+
+	return rec[len(rec)-length:], nil
+}
+
+// twoPhaseXID walks the xinfo of a commit record to the xid of the prepared
+// transaction, skipping the arrays that precede it.
+func twoPhaseXID(data []byte) (uint32, error) {
+	if len(data) < 4 {
+		return 0, errUnsupportedRecord
+	}
+
+	xinfo, pos := binary.LittleEndian.Uint32(data), 4
+	if xinfo&xinfoHasTwoPhase == 0 || xinfo&xinfoHasDroppedStats != 0 {
+		return 0, errUnsupportedRecord
+	}
+
+	skip := func(flag uint32, itemSize int) bool {
+		if xinfo&flag == 0 {
+			return true
+		}
+		if pos+4 > len(data) {
+			return false
+		}
+
+		pos += 4 + int(binary.LittleEndian.Uint32(data[pos:]))*itemSize
+		return pos <= len(data)
+	}
+
+	if xinfo&xinfoHasDBInfo != 0 {
+		pos += 8
+	}
+	if !skip(xinfoHasSubxacts, 4) || !skip(xinfoHasRelFileNodes, 12) || !skip(xinfoHasInvals, 16) {
+		return 0, errUnsupportedRecord
+	}
+	if pos+4 > len(data) {
+		return 0, errUnsupportedRecord
+	}
+
+	return binary.LittleEndian.Uint32(data[pos:]), nil
+}
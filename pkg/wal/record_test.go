@@ -0,0 +1,159 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// xactAbort is the op of an abort record, which isn't a commit.
+const xactAbort = 0x20
+
+// walRecord builds a record as Postgres writes it, with main data following
+// any of the given block headers and a valid CRC.
+func walRecord(xid uint32, rmid, info byte, blocks, main []byte) []byte {
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+len(blocks)+5+len(main))
+	rec = append(rec, blocks...)
+	if len(main) <= 255 {
+		rec = append(rec, blockIDDataShort, byte(len(main)))
+	} else {
+		rec = append(rec, blockIDDataLong, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(rec[len(rec)-4:], uint32(len(main)))
+	}
+	rec = append(rec, main...)
+
+	binary.LittleEndian.PutUint32(rec, uint32(len(rec)))
+	binary.LittleEndian.PutUint32(rec[4:], xid)
+	rec[16], rec[17] = info, rmid
+
+	crc := crc32.Update(0, castagnoli, rec[recordHeaderSize:])
+	binary.LittleEndian.PutUint32(rec[20:], crc32.Update(crc, castagnoli, rec[:20]))
+
+	return rec
+}
+
+// commitRecord builds a commit record for xid at the given time, with padding
+// after the timestamp to make it as large as a record needs to be.
+func commitRecord(xid uint32, at time.Time, padding int) []byte {
+	return walRecord(xid, rmXact, xactCommit, nil, xactTime(at, padding))
+}
+
+// commitPreparedRecord builds the record of COMMIT PREPARED, which carries the
+// xid of the prepared transaction after the given xinfo arrays.
+func commitPreparedRecord(at time.Time, xinfo uint32, arrays []byte, xid uint32) []byte {
+	main := xactTime(at, 0)
+	main = appendUint32(main, xinfo|xinfoHasTwoPhase)
+	main = append(main, arrays...)
+	main = appendUint32(main, xid)
+
+	return walRecord(0, rmXact, xactCommitPrepped|xactHasInfo, nil, main)
+}
+
+func xactTime(at time.Time, padding int) []byte {
+	main := make([]byte, 8+padding)
+	binary.LittleEndian.PutUint64(main, uint64(at.Sub(postgresEpoch)/time.Microsecond))
+
+	return main
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func TestDecodeCommit(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 123456000, time.UTC)
+
+	// Two subtransactions and one relfilenode precede the prepared xid
+	arrays := appendUint32(nil, 2)
+	arrays = append(arrays, make([]byte, 2*4)...)
+	arrays = appendUint32(arrays, 1)
+	arrays = append(arrays, make([]byte, 12)...)
+
+	for _, tc := range []struct {
+		name   string
+		rec    []byte
+		want   Commit
+		commit bool
+		err    error
+	}{
+		{
+			name:   "commit",
+			rec:    commitRecord(1234, at, 0),
+			want:   Commit{XID: 1234, LSN: 0x1000, CommittedAt: at},
+			commit: true,
+		},
+		{
+			name:   "commit with origin",
+			rec:    walRecord(1234, rmXact, xactCommit, []byte{blockIDOrigin, 1, 0}, xactTime(at, 0)),
+			want:   Commit{XID: 1234, LSN: 0x1000, CommittedAt: at},
+			commit: true,
+		},
+		{
+			name:   "commit with long main data",
+			rec:    commitRecord(1234, at, 300),
+			want:   Commit{XID: 1234, LSN: 0x1000, CommittedAt: at},
+			commit: true,
+		},
+		{
+			name:   "commit prepared",
+			rec:    commitPreparedRecord(at, 0, nil, 987),
+			want:   Commit{XID: 987, LSN: 0x1000, CommittedAt: at, Prepared: true},
+			commit: true,
+		},
+		{
+			name:   "commit prepared after subtransactions and relfilenodes",
+			rec:    commitPreparedRecord(at, xinfoHasSubxacts|xinfoHasRelFileNodes, arrays, 987),
+			want:   Commit{XID: 987, LSN: 0x1000, CommittedAt: at, Prepared: true},
+			commit: true,
+		},
+		{
+			name:   "commit prepared with dropped stats",
+			rec:    commitPreparedRecord(at, xinfoHasDroppedStats, nil, 987),
+			commit: true,
+			err:    errUnsupportedRecord,
+		},
+		{
+			name: "abort",
+			rec:  walRecord(1234, rmXact, xactAbort, nil, xactTime(at, 0)),
+		},
+		{
+			name: "heap insert",
+			rec:  walRecord(1234, 10, 0, nil, make([]byte, 8)),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if !validRecord(tc.rec) {
+				t.Fatalf("fixture record is invalid")
+			}
+
+			commit, ok, err := decodeCommit(0x1000, tc.rec)
+			switch {
+			case !errors.Is(err, tc.err):
+				t.Fatalf("decodeCommit returned error %v, want %v", err, tc.err)
+			case ok != tc.commit:
+				t.Fatalf("decodeCommit reported commit %v, want %v", ok, tc.commit)
+			case tc.err == nil && commit != tc.want:
+				t.Fatalf("decodeCommit = %+v, want %+v", commit, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidRecord(t *testing.T) {
+	rec := commitRecord(1234, time.Now(), 0)
+	if !validRecord(rec) {
+		t.Fatalf("validRecord rejected a valid record")
+	}
+
+	torn := append([]byte(nil), rec...)
+	torn[len(torn)-1] ^= 0xff
+	if validRecord(torn) {
+		t.Errorf("validRecord accepted a record failing its CRC")
+	}
+
+	if validRecord(rec[:len(rec)-1]) {
+		t.Errorf("validRecord accepted a truncated record")
+	}
+}
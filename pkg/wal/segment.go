@@ -0,0 +1,171 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errStop is returned by callbacks to stop decoding early.
+var errStop = errors.New("stop decoding")
+
+// decoder reassembles records from the pages of consecutive segments, calling
+// back with each commit record. Records can span pages and segments, so a
+// record in progress is carried over to the next segment if it follows on
+// directly.
+type decoder struct {
+	onCommit func(Commit) error
+
+	next       uint64 // LSN the next segment must start at to continue
+	pending    []byte // record in progress, split across pages
+	need       int    // total length of the pending record
+	pendingLSN uint64
+	skipped    int // commit records we couldn't take an xid from
+}
+
+// reset drops any record in progress, as when the WAL doesn't continue.
+func (d *decoder) reset() {
+	d.pending, d.need = nil, 0
+}
+
+// segment decodes each page of the segment named by log and seg, as read from
+// r. It stops without error at the end of valid WAL, as in a partial segment.
+func (d *decoder) segment(r io.Reader, log, seg uint32) error {
+	header := make([]byte, longPageHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read segment header: %w", err)
+	}
+	if binary.LittleEndian.Uint16(header[2:])&pageLongHeader == 0 {
+		return fmt.Errorf("segment does not start with a long page header")
+	}
+
+	segmentSize := binary.LittleEndian.Uint32(header[32:])
+	pageSize := int(binary.LittleEndian.Uint32(header[36:]))
+	if segmentSize == 0 || pageSize < longPageHeaderSize || pageSize%8 != 0 {
+		return fmt.Errorf("invalid segment header, with segment size %d and page size %d", segmentSize, pageSize)
+	}
+
+	start := uint64(log)<<32 + uint64(seg)*uint64(segmentSize)
+	if start != d.next {
+		d.reset()
+	}
+	d.next = start + uint64(segmentSize)
+
+	page := make([]byte, pageSize)
+	copy(page, header)
+	if _, err := io.ReadFull(r, page[len(header):]); err != nil {
+		return fmt.Errorf("failed to read segment: %w", err)
+	}
+
+	for addr := start; addr < d.next; addr += uint64(pageSize) {
+		if addr != start {
+			if _, err := io.ReadFull(r, page); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				d.reset()
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to read segment: %w", err)
+			}
+		}
+
+		ok, err := d.page(page, addr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			d.reset()
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// page decodes the records on a page, reporting false if the page isn't
+// valid WAL for its address, which marks the end of WAL. The page may be
+// partial, as when streamed, in which case the record it ends within is left
+// pending.
+func (d *decoder) page(page []byte, addr uint64) (bool, error) {
+	info := binary.LittleEndian.Uint16(page[2:])
+	if binary.LittleEndian.Uint16(page) == 0 || binary.LittleEndian.Uint64(page[8:]) != addr {
+		return false, nil
+	}
+
+	pos := shortPageHeaderSize
+	if info&pageLongHeader != 0 {
+		pos = longPageHeaderSize
+	}
+
+	if info&pageFirstIsContRecord != 0 {
+		remaining := int(binary.LittleEndian.Uint32(page[16:]))
+		available := len(page) - pos
+		if remaining > available {
+			if d.pending != nil {
+				d.pending = append(d.pending, page[pos:]...)
+			}
+			return true, nil
+		}
+
+		if d.pending != nil {
+			d.pending = append(d.pending, page[pos:pos+remaining]...)
+			if err := d.record(d.pendingLSN, d.pending); err != nil {
+				return false, err
+			}
+			d.reset()
+		}
+
+		pos += maxAlign(remaining)
+	} else {
+		d.reset()
+	}
+
+	for pos+4 <= len(page) {
+		length := int(binary.LittleEndian.Uint32(page[pos:]))
+		if length == 0 {
+			// The rest of the page is unused, as after a WAL switch
+			return true, nil
+		}
+		if length < recordHeaderSize {
+			return false, nil
+		}
+
+		if pos+length > len(page) {
+			d.pending = append(make([]byte, 0, length), page[pos:]...)
+			d.need, d.pendingLSN = length, addr+uint64(pos)
+			return true, nil
+		}
+
+		if err := d.record(addr+uint64(pos), page[pos:pos+length]); err != nil {
+			return false, err
+		}
+		pos += maxAlign(length)
+	}
+
+	return true, nil
+}
+
+// record decodes a complete record, ignoring anything but commits. Records
+// failing their CRC can only be torn writes at the end of WAL, so are skipped.
+func (d *decoder) record(lsn uint64, rec []byte) error {
+	if d.need > 0 && len(rec) != d.need {
+		return nil
+	}
+	if !validRecord(rec) {
+		return nil
+	}
+
+	commit, ok, err := decodeCommit(lsn, rec)
+	if errors.Is(err, errUnsupportedRecord) {
+		d.skipped++
+		return nil
+	}
+	if err != nil || !ok {
+		return err
+	}
+
+	return d.onCommit(commit)
+}
+
+func maxAlign(length int) int {
+	return (length + 7) &^ 7
+}
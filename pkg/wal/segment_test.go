@@ -0,0 +1,218 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// Fixtures use small pages and segments, so records span them without
+// needing megabytes of WAL.
+const (
+	fixturePageSize     = 512
+	fixtureSegmentPages = 2
+	fixtureSegmentSize  = fixturePageSize * fixtureSegmentPages
+	fixtureMagic        = 0xd10d
+)
+
+// walSegments lays records out in pages and segments as Postgres writes them,
+// starting at segment seg of log 0, splitting records across pages wherever
+// they fall and zero-filling the rest of the last segment. It returns the LSN
+// each record starts at.
+func walSegments(seg uint32, records ...[]byte) ([][]byte, []uint64) {
+	start := uint64(seg) * fixtureSegmentSize
+
+	var (
+		out  []byte
+		lsns []uint64
+	)
+	pageHeader := func(remaining int) {
+		addr := start + uint64(len(out))
+		size, info := shortPageHeaderSize, uint16(0)
+		if addr%fixtureSegmentSize == 0 {
+			size, info = longPageHeaderSize, pageLongHeader
+		}
+		if remaining > 0 {
+			info |= pageFirstIsContRecord
+		}
+
+		header := make([]byte, size)
+		binary.LittleEndian.PutUint16(header, fixtureMagic)
+		binary.LittleEndian.PutUint16(header[2:], info)
+		binary.LittleEndian.PutUint32(header[4:], 1)
+		binary.LittleEndian.PutUint64(header[8:], addr)
+		binary.LittleEndian.PutUint32(header[16:], uint32(remaining))
+		if size == longPageHeaderSize {
+			binary.LittleEndian.PutUint32(header[32:], fixtureSegmentSize)
+			binary.LittleEndian.PutUint32(header[36:], fixturePageSize)
+		}
+		out = append(out, header...)
+	}
+
+	for _, rec := range records {
+		if len(out)%fixturePageSize == 0 {
+			pageHeader(0)
+		}
+		lsns = append(lsns, start+uint64(len(out)))
+
+		for remaining := rec; ; {
+			n := fixturePageSize - len(out)%fixturePageSize
+			if n > len(remaining) {
+				n = len(remaining)
+			}
+			out, remaining = append(out, remaining[:n]...), remaining[n:]
+			if len(remaining) == 0 {
+				break
+			}
+			pageHeader(len(remaining))
+		}
+		out = append(out, make([]byte, maxAlign(len(out))-len(out))...)
+	}
+	for len(out)%fixtureSegmentSize != 0 {
+		out = append(out, 0)
+	}
+
+	var segments [][]byte
+	for len(out) > 0 {
+		segments, out = append(segments, out[:fixtureSegmentSize]), out[fixtureSegmentSize:]
+	}
+
+	return segments, lsns
+}
+
+// decodeSegments decodes consecutive segments starting at seg, returning the
+// commits found.
+func decodeSegments(t *testing.T, seg uint32, segments [][]byte) ([]Commit, *decoder) {
+	t.Helper()
+
+	var commits []Commit
+	d := &decoder{onCommit: func(commit Commit) error {
+		commits = append(commits, commit)
+		return nil
+	}}
+	for idx, segment := range segments {
+		if err := d.segment(bytes.NewReader(segment), 0, seg+uint32(idx)); err != nil {
+			t.Fatalf("failed to decode segment %d: %v", idx, err)
+		}
+	}
+
+	return commits, d
+}
+
+func TestDecodeSegment(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	filler := walRecord(0, 10, 0, nil, make([]byte, 200))
+
+	for _, tc := range []struct {
+		name    string
+		records [][]byte
+		// tamper breaks the laid out segments, as a crash or recycled
+		// segment would
+		tamper  func(segments [][]byte)
+		commits []int // indexes of the records expected as commits
+		skipped int
+	}{
+		{
+			name:    "commits within a page",
+			records: [][]byte{commitRecord(100, at, 0), filler, commitRecord(101, at.Add(time.Second), 0)},
+			commits: []int{0, 2},
+		},
+		{
+			name:    "record spanning pages",
+			records: [][]byte{filler, commitRecord(100, at, 300), commitRecord(101, at.Add(time.Second), 0)},
+			commits: []int{1, 2},
+		},
+		{
+			name:    "record spanning segments",
+			records: [][]byte{filler, filler, filler, commitRecord(100, at, 400), commitRecord(101, at.Add(time.Second), 0)},
+			commits: []int{3, 4},
+		},
+		{
+			name:    "record spanning every page of a segment",
+			records: [][]byte{filler, commitRecord(100, at, 1200), commitRecord(101, at.Add(time.Second), 0)},
+			commits: []int{1, 2},
+		},
+		{
+			name:    "commit prepared",
+			records: [][]byte{commitPreparedRecord(at, 0, nil, 90), commitRecord(100, at.Add(time.Second), 0)},
+			commits: []int{0, 1},
+		},
+		{
+			name:    "unsupported commit prepared",
+			records: [][]byte{commitPreparedRecord(at, xinfoHasDroppedStats, nil, 90), commitRecord(100, at.Add(time.Second), 0)},
+			commits: []int{1},
+			skipped: 1,
+		},
+		{
+			name:    "torn tail",
+			records: [][]byte{commitRecord(100, at, 0), commitRecord(101, at.Add(time.Second), 0)},
+			tamper: func(segments [][]byte) {
+				// The second record was only partly written
+				segments[0][longPageHeaderSize+maxAlign(recordHeaderSize+10)+30] ^= 0xff
+			},
+			commits: []int{0},
+		},
+		{
+			name:    "torn tail spanning pages",
+			records: [][]byte{filler, commitRecord(100, at, 400)},
+			tamper: func(segments [][]byte) {
+				// The page holding the end of the record is from an
+				// earlier use of the recycled segment
+				binary.LittleEndian.PutUint64(segments[0][fixturePageSize+8:], 0)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			segments, lsns := walSegments(1, tc.records...)
+			if tc.tamper != nil {
+				tc.tamper(segments)
+			}
+
+			commits, d := decodeSegments(t, 1, segments)
+			if len(commits) != len(tc.commits) {
+				t.Fatalf("decoded %d commits, want %d: %+v", len(commits), len(tc.commits), commits)
+			}
+			for idx, commit := range commits {
+				want, _, _ := decodeCommit(lsns[tc.commits[idx]], tc.records[tc.commits[idx]])
+				if commit != want {
+					t.Errorf("commit %d = %+v, want %+v", idx, commit, want)
+				}
+			}
+			if d.skipped != tc.skipped {
+				t.Errorf("skipped %d commits, want %d", d.skipped, tc.skipped)
+			}
+		})
+	}
+}
+
+// A record continued from a segment we didn't read can't be reassembled, so
+// is dropped rather than decoded from its tail.
+func TestDecodeSegmentWithoutPrevious(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	filler := walRecord(0, 10, 0, nil, make([]byte, 200))
+
+	records := [][]byte{filler, filler, filler, commitRecord(100, at, 400), commitRecord(101, at.Add(time.Second), 0)}
+	segments, lsns := walSegments(1, records...)
+
+	commits, _ := decodeSegments(t, 2, segments[1:])
+	if len(commits) != 1 {
+		t.Fatalf("decoded %d commits, want 1: %+v", len(commits), commits)
+	}
+	if commits[0].XID != 101 || uint64(commits[0].LSN) != lsns[4] {
+		t.Errorf("decoded %+v, want xid 101 at %s", commits[0], LSN(lsns[4]))
+	}
+}
+
+func TestDecodeSegmentTruncated(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	segments, _ := walSegments(1, commitRecord(100, at, 0), commitRecord(101, at, 600))
+	commits, d := decodeSegments(t, 1, [][]byte{segments[0][:fixturePageSize]})
+	if len(commits) != 1 || commits[0].XID != 100 {
+		t.Fatalf("decoded %+v, want only xid 100", commits)
+	}
+	if d.pending != nil {
+		t.Errorf("left a record pending at the end of a partial segment")
+	}
+}
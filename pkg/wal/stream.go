@@ -0,0 +1,80 @@
+package wal
+
+import (
+	"fmt"
+)
+
+// Stream decodes commits from WAL as streamed by a replication connection,
+// which arrives in chunks ending anywhere rather than whole segments. Commits
+// are decoded as soon as they arrive, by decoding the latest page again from
+// its start each time more of it is received.
+type Stream struct {
+	decoder
+	pageSize int
+
+	addr  uint64 // LSN of the page being received
+	page  []byte
+	saved decoder // state of the decoder at the start of the page
+	last  uint64  // LSN of the last commit reported, so none are repeated
+}
+
+// NewStream decodes WAL starting from start, which must be at the start of a
+// page.
+func NewStream(start LSN, pageSize int, onCommit func(Commit) error) (*Stream, error) {
+	if pageSize < longPageHeaderSize || uint64(start)%uint64(pageSize) != 0 {
+		return nil, fmt.Errorf("stream must start at a page boundary, not %s with page size %d", start, pageSize)
+	}
+
+	s := &Stream{pageSize: pageSize, addr: uint64(start), page: make([]byte, 0, pageSize)}
+	s.onCommit = func(commit Commit) error {
+		if uint64(commit.LSN) <= s.last {
+			return nil
+		}
+
+		s.last = uint64(commit.LSN)
+		return onCommit(commit)
+	}
+	s.saved = s.decoder
+
+	return s, nil
+}
+
+// Position is the LSN up to which WAL has been received.
+func (s *Stream) Position() LSN {
+	return LSN(s.addr + uint64(len(s.page)))
+}
+
+// Write decodes WAL received starting at lsn, which must follow on from what
+// was received before.
+func (s *Stream) Write(lsn LSN, data []byte) error {
+	if lsn != s.Position() {
+		return fmt.Errorf("received WAL at %s, expected %s", lsn, s.Position())
+	}
+
+	for len(data) > 0 {
+		n := s.pageSize - len(s.page)
+		if n > len(data) {
+			n = len(data)
+		}
+		s.page, data = append(s.page, data[:n]...), data[n:]
+
+		if len(s.page) < shortPageHeaderSize {
+			continue
+		}
+
+		s.decoder = s.saved
+		ok, err := s.decoder.page(s.page, s.addr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			s.reset()
+		}
+
+		if len(s.page) == s.pageSize {
+			s.saved, s.addr, s.page = s.decoder, s.addr+uint64(s.pageSize), s.page[:0]
+		}
+	}
+
+	return nil
+}
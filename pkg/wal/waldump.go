@@ -0,0 +1,88 @@
+package wal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// waldumpCommit matches commit records as printed by pg_waldump, such as:
+//
+//	rmgr: Transaction len (rec/tot):     34/    34, tx:        735, lsn: 0/01580C48, prev 0/01580C10, desc: COMMIT 2024-01-01 00:00:00.123456 UTC
+//
+// Prepared transactions are committed by COMMIT_PREPARED, followed by their
+// xid, as the record's own xid is that of the session committing them.
+var waldumpCommit = regexp.MustCompile(`^rmgr: Transaction .*\btx:\s*([0-9]+), lsn: ([0-9A-F]+)/([0-9A-F]+),.* desc: (?:COMMIT|COMMIT_PREPARED ([0-9]+):) ([0-9]{4}-[0-9]{2}-[0-9]{2} [0-9:.]+ [^;\s]+)`)
+
+// waldumpTimeLayout is how pg_waldump prints commit timestamps, in the zone it
+// runs in.
+const waldumpTimeLayout = "2006-01-02 15:04:05.999999 MST"
+
+// ReadWALDump reads the commit records from pg_waldump output, in WAL order.
+// Commit timestamps are printed with a zone abbreviation, which is only
+// understood for UTC and the local zone, so pg_waldump should be run with
+// TZ=UTC.
+func ReadWALDump(r io.Reader) ([]Commit, error) {
+	var commits []Commit
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		match := waldumpCommit.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		xid := match[1]
+		if match[4] != "" {
+			xid = match[4]
+		}
+
+		parsedXID, err := strconv.ParseUint(xid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xid in %q: %w", scanner.Text(), err)
+		}
+		hi, _ := strconv.ParseUint(match[2], 16, 32)
+		lo, _ := strconv.ParseUint(match[3], 16, 32)
+
+		committedAt, err := time.Parse(waldumpTimeLayout, match[5])
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit time in %q: %w", scanner.Text(), err)
+		}
+
+		commits = append(commits, Commit{
+			XID:         uint32(parsedXID),
+			LSN:         LSN(hi<<32 | lo),
+			CommittedAt: committedAt.UTC(),
+			Prepared:    match[4] != "",
+		})
+	}
+
+	return commits, scanner.Err()
+}
+
+// FindCommit finds the last commit before t among commits in WAL order, as
+// Search does for an archive.
+func FindCommit(commits []Commit, t time.Time) (Result, error) {
+	result := Result{TargetTime: t}
+	if len(commits) == 0 {
+		return result, fmt.Errorf("%w: no commit records found", ErrNoCommitBefore)
+	}
+
+	for idx, commit := range commits {
+		if commit.CommittedAt.After(t) {
+			if idx == 0 {
+				return result, fmt.Errorf("%w: first commit was at %s", ErrNoCommitBefore, commit.CommittedAt.Format(time.RFC3339Nano))
+			}
+
+			result.Before, result.After = commits[idx-1], &commits[idx]
+			return result, nil
+		}
+	}
+
+	result.Before = commits[len(commits)-1]
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// XIDCommit is when an xid committed, nil if it didn't or the server no longer
+// knows.
+type XIDCommit struct {
+	XID         string     `json:"xid"`
+	CommittedAt *time.Time `json:"committed_at"`
+}
+
+// Accuracy compares an estimate with the exact answer from commit timestamps.
+type Accuracy struct {
+	Estimate Result `json:"estimate"`
+	Exact    Result `json:"exact"`
+
+	// CommittedAt is when the estimated xid committed, if it did, and
+	// TimeError how long after the target time that was, or before it when
+	// negative
+	CommittedAt *time.Time     `json:"committed_at,omitempty"`
+	TimeError   *time.Duration `json:"time_error,omitempty"`
+
+	// XIDsOff is how many xids the estimate is after the exact answer, or
+	// before it when negative
+	XIDsOff int64 `json:"xids_off"`
+
+	// Neighbours are the xids either side of the estimate, in xid order
+	Neighbours []XIDCommit `json:"neighbours,omitempty"`
+}
+
+// MeasureAccuracy estimates the xid for t as configured, but without refining
+// the estimate with commit timestamps, and compares it with the exact answer
+// they give as CompareExact does.
+func (e *Estimator) MeasureAccuracy(ctx context.Context, conn Querier, table string, t time.Time, neighbours int) (Accuracy, error) {
+	if e.Strategy == StrategyCommitTimestamp {
+		return Accuracy{}, fmt.Errorf("measuring accuracy needs a strategy other than %s", StrategyCommitTimestamp)
+	}
+
+	inexact := *e
+	inexact.Exact, inexact.skipCommitTimestamps = false, true
+	estimate, err := inexact.EstimateXID(ctx, conn, table, t)
+	if err != nil {
+		return Accuracy{Estimate: estimate}, err
+	}
+
+	return e.CompareExact(ctx, conn, table, estimate, neighbours)
+}
+
+// CompareExact compares an estimate with the exact answer from commit
+// timestamps for the same target time. It also reads when the estimated xid
+// and neighbours either side of it committed, so the error can be seen in
+// context. The server must track commit timestamps, or this fails with
+// ErrCommitTimestampsDisabled.
+func (e *Estimator) CompareExact(ctx context.Context, conn Querier, table string, estimate Result, neighbours int) (Accuracy, error) {
+	accuracy := Accuracy{Estimate: estimate}
+
+	// The estimate's target already has any slack taken off
+	exact := *e
+	exact.Strategy, exact.Exact, exact.Slack = StrategyCommitTimestamp, true, 0
+
+	var err error
+	if accuracy.Exact, err = exact.EstimateXID(ctx, conn, table, estimate.TargetTime); err != nil {
+		return accuracy, fmt.Errorf("failed to find the exact xid: %w", err)
+	}
+
+	estimated, err := parseXID(accuracy.Estimate.XID())
+	if err != nil {
+		return accuracy, err
+	}
+	actual, err := parseXID(accuracy.Exact.XID())
+	if err != nil {
+		return accuracy, err
+	}
+	accuracy.XIDsOff = int64(int32(estimated - actual))
+
+	if err := conn.QueryRow(ctx, selectXIDCommitTimestamp, accuracy.Estimate.XID()).Scan(&accuracy.CommittedAt); err != nil {
+		return accuracy, fmt.Errorf("failed to read commit timestamp: %w", err)
+	}
+	if accuracy.CommittedAt != nil {
+		timeError := accuracy.CommittedAt.Sub(accuracy.Estimate.TargetTime)
+		accuracy.TimeError = &timeError
+	}
+
+	if neighbours > 0 {
+		if accuracy.Neighbours, err = neighbourCommits(ctx, conn, accuracy.Estimate.XID(), neighbours); err != nil {
+			return accuracy, err
+		}
+	}
+
+	level.Info(e.logger()).Log("event", "measured_accuracy", "strategy", accuracy.Estimate.Strategy,
+		"xid", accuracy.Estimate.XID(), "exact_xid", accuracy.Exact.XID(), "xids_off", accuracy.XIDsOff,
+		"committed_at", accuracy.CommittedAt, "time_error", accuracy.TimeError)
+
+	return accuracy, nil
+}
+
+func neighbourCommits(ctx context.Context, conn Querier, xid string, neighbours int) ([]XIDCommit, error) {
+	rows, err := conn.Query(ctx, selectNeighbourCommits, xid, neighbours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read neighbouring commit timestamps: %w", err)
+	}
+	defer rows.Close()
+
+	var commits []XIDCommit
+	for rows.Next() {
+		var commit XIDCommit
+		if err := rows.Scan(&commit.XID, &commit.CommittedAt); err != nil {
+			return nil, fmt.Errorf("failed to read neighbouring commit timestamps: %w", err)
+		}
+		commits = append(commits, commit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read neighbouring commit timestamps: %w", err)
+	}
+
+	return commits, nil
+}
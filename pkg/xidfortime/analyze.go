@@ -0,0 +1,165 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultMaxAnalyzeAge is how long before the target time a table may have
+// last been analyzed before its histogram is considered stale.
+const DefaultMaxAnalyzeAge = 24 * time.Hour
+
+// ErrAnalyzeNotPermitted is returned when asked to analyze a table the user
+// doesn't own.
+var ErrAnalyzeNotPermitted = errors.New("ANALYZE needs the table owner or a superuser")
+
+// checkAnalyzed warns when the table, or any of its partitions, was last
+// analyzed long enough before t that rows inserted since are missing from the
+// histogram, so the bounds bracketing t are far apart or missing entirely.
+func (e *Estimator) checkAnalyzed(ctx context.Context, conn Querier, rel Relation, inspection Inspection, t time.Time) error {
+	analyzed, never, err := lastAnalyzed(ctx, conn, rel, inspection)
+	if err != nil {
+		return err
+	}
+
+	maxAge := e.maxAnalyzeAge()
+	switch {
+	case never > 0:
+		level.Warn(e.logger()).Log("event", "never_analyzed", "tables", never,
+			"msg", "histogram bounds may be missing, run with --analyze to analyze the table first")
+	case analyzed != nil && t.Sub(*analyzed) > maxAge:
+		level.Warn(e.logger()).Log("event", "stale_statistics", "last_analyzed", *analyzed, "before_target", t.Sub(*analyzed),
+			"msg", "rows inserted since are missing from the histogram, run with --analyze to analyze the table first")
+	}
+
+	return nil
+}
+
+// lastAnalyzed is when the table, or the least recently analyzed of its
+// partitions, was last analyzed, and how many of them never have been.
+func lastAnalyzed(ctx context.Context, conn Querier, rel Relation, inspection Inspection) (analyzed *time.Time, never int, err error) {
+	tables := []string{string(rel.queryData().Table)}
+	if inspection.Partitioned {
+		tables = inspection.Partitions
+	}
+
+	if err := conn.QueryRow(ctx, selectLastAnalyzed, tables).Scan(&analyzed, &never); err != nil {
+		return nil, 0, fmt.Errorf("failed to check when table was analyzed: %w", err)
+	}
+
+	return analyzed, never, nil
+}
+
+func (e *Estimator) maxAnalyzeAge() time.Duration {
+	if e.MaxAnalyzeAge <= 0 {
+		return DefaultMaxAnalyzeAge
+	}
+
+	return e.MaxAnalyzeAge
+}
+
+// Analyze runs ANALYZE on the id and time columns of table, refreshing the
+// histogram the estimate relies on. It checks the user may analyze the table
+// first, failing with ErrAnalyzeNotPermitted rather than having Postgres skip
+// it with only a warning.
+func (e *Estimator) Analyze(ctx context.Context, conn Execer, table string) error {
+	rel, err := e.analyzable(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+
+	return e.analyze(ctx, conn, rel)
+}
+
+// AnalyzeWithStatistics analyzes table as Analyze does, but with the
+// statistics target of the id column raised to target for a histogram with
+// up to that many buckets, restoring the previous target once done. The finer
+// histogram is kept until the table is next analyzed. Changing the target
+// needs a conn that isn't read only.
+func (e *Estimator) AnalyzeWithStatistics(ctx context.Context, conn Execer, table string, target int) (err error) {
+	rel, err := e.analyzable(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+
+	data := rel.queryData()
+	var previous int
+	if err := conn.QueryRow(ctx, selectStatisticsTarget, string(data.Table), rel.IDColumn).Scan(&previous); err != nil {
+		return fmt.Errorf("failed to read statistics target: %w", err)
+	}
+
+	alter := func(ctx context.Context, target int) error {
+		sql, err := renderSQL("alterStatisticsTarget", alterStatisticsTarget, struct {
+			queryData
+			Target int
+		}{data, target})
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to set statistics target: %w", err)
+		}
+
+		level.Info(e.logger()).Log("event", "set_statistics_target", "column", rel.IDColumn, "target", target)
+		return nil
+	}
+
+	if err := alter(ctx, target); err != nil {
+		return err
+	}
+
+	// Restore the target even when interrupted, so the table isn't left
+	// analyzing with a large target forever
+	defer func() {
+		restoreCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if restoreErr := alter(restoreCtx, previous); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}()
+
+	return e.analyze(ctx, conn, rel)
+}
+
+// analyzable resolves table, checking the user may analyze and alter it.
+func (e *Estimator) analyzable(ctx context.Context, conn Execer, table string) (Relation, error) {
+	rel, err := e.Relation(table)
+	if err != nil {
+		return rel, err
+	}
+	if err := e.validateRelation(ctx, conn, rel); err != nil {
+		return rel, err
+	}
+
+	var permitted bool
+	if err := conn.QueryRow(ctx, selectCanAnalyze, string(rel.queryData().Table)).Scan(&permitted); err != nil {
+		return rel, fmt.Errorf("failed to check permission to analyze: %w", err)
+	}
+	if !permitted {
+		return rel, fmt.Errorf("cannot analyze %s: %w", rel.queryData().Table, ErrAnalyzeNotPermitted)
+	}
+
+	return rel, nil
+}
+
+func (e *Estimator) analyze(ctx context.Context, conn Execer, rel Relation) error {
+	data := rel.queryData()
+	sql, err := renderSQL("analyzeTable", analyzeTable, data)
+	if err != nil {
+		return err
+	}
+
+	began := time.Now()
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to analyze table: %w", err)
+	}
+
+	level.Info(e.logger()).Log("event", "analyzed_table", "table", data.Table, "elapsed", time.Since(began))
+	return nil
+}
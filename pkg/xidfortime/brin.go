@@ -0,0 +1,95 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// estimateByBRIN handles append-only tables, where a brin index on the time
+// column tells us the heap is physically ordered by insert time. Reading the
+// brin summaries directly requires pageinspect and superuser, so we bisect the
+// heap instead, summarising one block per probe, until we find the first block
+// inserted entirely after t. The rows we want are then in that block or the one
+// before it, and only those two are scanned.
+func (e *Estimator) estimateByBRIN(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	logger := e.logger()
+	result := Result{TargetTime: t, Strategy: StrategyBRIN}
+	data := rel.queryData()
+
+	var blocks int64
+	if err := conn.QueryRow(ctx, selectHeapBlocks, data.Table).Scan(&blocks); err != nil {
+		return result, fmt.Errorf("failed to count heap blocks: %w", err)
+	}
+
+	rangeSQL, err := renderSQL("selectBlockTimeRange", selectBlockTimeRange, data)
+	if err != nil {
+		return result, err
+	}
+
+	// Find the first block whose oldest row is after t. Empty blocks are treated
+	// as preceding t, which at worst widens the final scan.
+	lo, hi, probes := int64(0), blocks, 0
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		probes++
+
+		var oldest, newest *time.Time
+		if err := conn.QueryRow(ctx, rangeSQL, []int64{mid}).Scan(&oldest, &newest); err != nil {
+			return result, fmt.Errorf("failed to summarise heap block %d: %w", mid, err)
+		}
+
+		if oldest != nil && oldest.After(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	if lo == 0 {
+		return result, fmt.Errorf("target time %s predates the first heap block: %w", t, ErrOutOfRange)
+	}
+
+	boundary := []int64{lo - 1, lo}
+	level.Debug(logger).Log("event", "found_boundary_blocks", "blocks", blocks, "probes", probes,
+		"before_block", lo-1, "after_block", lo)
+
+	{
+		sql, err := renderSQL("selectBlocksAfterTime", selectBlocksAfterTime, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, boundary, t).Scan(&result.Exceeded.ID, &result.Exceeded.CreatedAt, &result.Exceeded.XMin); err != nil {
+			return result, fmt.Errorf("failed to find first row past target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_past_threshold",
+		"exceeded_id", result.Exceeded.ID,
+		"exceeded_created_at", result.Exceeded.CreatedAt,
+		"exceeded_xmin", result.Exceeded.XMin,
+		"exceeded_by", result.ExceededBy())
+
+	{
+		sql, err := renderSQL("selectBlocksAtOrBeforeTime", selectBlocksAtOrBeforeTime, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, boundary, t).
+			Scan(&result.Before.ID, &result.Before.CreatedAt, &result.Before.XMin); err != nil {
+			return result, fmt.Errorf("failed to find last row before target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_before_threshold",
+		"before_id", result.Before.ID,
+		"before_created_at", result.Before.CreatedAt,
+		"before_xmin", result.Before.XMin,
+		"before_by", result.BeforeBy())
+
+	return result, nil
+}
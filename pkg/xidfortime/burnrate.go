@@ -0,0 +1,219 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Sources of the rate xids are assigned at that BurnRate can measure from.
+const (
+	BurnRateSourceAuto     = "auto"
+	BurnRateSourceTracking = "tracking"
+	BurnRateSourceSample   = "sample"
+)
+
+// BurnRateSources lists the valid burn rate sources.
+var BurnRateSources = []string{BurnRateSourceAuto, BurnRateSourceTracking, BurnRateSourceSample}
+
+const (
+	// xidWrapLimit is how many xids past the oldest datfrozenxid can be
+	// assigned before wraparound.
+	xidWrapLimit = 1<<31 - 1
+	// xidStopMargin is how far short of wraparound the server stops assigning
+	// xids, which Postgres 14 raised from a million.
+	xidStopMargin       = 3000000
+	legacyXIDStopMargin = 1000000
+)
+
+// BurnRate is the rate xids are being assigned at, measured between two
+// samples of the xid counter, along with how far the cluster is from
+// wraparound.
+type BurnRate struct {
+	Source string    `json:"source"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	XIDs   uint64    `json:"xids"`
+
+	// OldestDatabase has the oldest datfrozenxid, of age FrozenXIDAge
+	OldestDatabase string `json:"oldest_database"`
+	FrozenXIDAge   int64  `json:"frozen_xid_age"`
+	// FreezeMaxAge is autovacuum_freeze_max_age, beyond which autovacuum is
+	// forced to freeze
+	FreezeMaxAge int64 `json:"freeze_max_age"`
+	// Remaining is how many more xids can be assigned before the server stops
+	// accepting writes to avoid wraparound.
+	Remaining int64 `json:"xids_remaining"`
+}
+
+// PerSecond is the average xids assigned a second.
+func (b BurnRate) PerSecond() float64 {
+	if elapsed := b.To.Sub(b.From); elapsed > 0 {
+		return float64(b.XIDs) / elapsed.Seconds()
+	}
+
+	return 0
+}
+
+// PerHour is the average xids assigned an hour.
+func (b BurnRate) PerHour() float64 {
+	return b.PerSecond() * 3600
+}
+
+// UntilWraparound projects how long until the server stops assigning xids at
+// the current rate, reporting false when no xids are being assigned.
+func (b BurnRate) UntilWraparound() (time.Duration, bool) {
+	return b.until(b.Remaining)
+}
+
+// UntilFreezeMaxAge projects how long until the oldest database reaches
+// autovacuum_freeze_max_age, forcing an anti-wraparound vacuum.
+func (b BurnRate) UntilFreezeMaxAge() (time.Duration, bool) {
+	return b.until(b.FreezeMaxAge - b.FrozenXIDAge)
+}
+
+func (b BurnRate) until(xids int64) (time.Duration, bool) {
+	rate := b.PerSecond()
+	switch {
+	case rate <= 0:
+		return 0, false
+	case xids <= 0:
+		return 0, true
+	}
+
+	return time.Duration(float64(xids) / rate * float64(time.Second)), true
+}
+
+// ErrNotEnoughSamples is returned when the tracking table has too few samples
+// within the window to measure a rate between.
+var ErrNotEnoughSamples = errors.New("tracking table has fewer than two samples in the window")
+
+// BurnRate measures the rate xids are assigned at, and projects it against the
+// oldest datfrozenxid. The tracking table in the estimator's tracking schema
+// gives the rate over the last window when it has samples spanning it, and
+// otherwise the xid counter is sampled twice, sample apart, which doesn't
+// itself assign any xids.
+func (e *Estimator) BurnRate(ctx context.Context, conn Querier, source string, window, sample time.Duration) (BurnRate, error) {
+	var (
+		rate BurnRate
+		err  error
+	)
+	if source != BurnRateSourceSample {
+		rate, err = e.trackedBurnRate(ctx, conn, window)
+		switch {
+		case err == nil:
+		case source == BurnRateSourceAuto && (errors.Is(err, ErrTrackingUnavailable) || errors.Is(err, ErrNotEnoughSamples)):
+			level.Info(e.logger()).Log("event", "sampling_burn_rate", "reason", err, "sample", sample)
+			source = BurnRateSourceSample
+		default:
+			return rate, err
+		}
+	}
+	if source == BurnRateSourceSample {
+		if rate, err = e.sampledBurnRate(ctx, conn, sample); err != nil {
+			return rate, err
+		}
+	}
+
+	if err := conn.QueryRow(ctx, selectOldestFrozenXID).Scan(&rate.OldestDatabase, &rate.FrozenXIDAge, &rate.FreezeMaxAge); err != nil {
+		return rate, fmt.Errorf("failed to read datfrozenxid: %w", err)
+	}
+
+	server, err := e.server(ctx, conn)
+	if err != nil {
+		return rate, err
+	}
+	margin := int64(xidStopMargin)
+	if server.Version < 140000 {
+		margin = legacyXIDStopMargin
+	}
+	rate.Remaining = xidWrapLimit - margin - rate.FrozenXIDAge
+
+	return rate, nil
+}
+
+func (e *Estimator) trackedBurnRate(ctx context.Context, conn Querier, window time.Duration) (BurnRate, error) {
+	rate := BurnRate{Source: BurnRateSourceTracking}
+
+	data := newTrackingData(e.trackingSchema(), Server{})
+	var exists bool
+	if err := conn.QueryRow(ctx, selectTrackingTable, data.Table).Scan(&exists); err != nil {
+		return rate, fmt.Errorf("failed to check for tracking table: %w", err)
+	}
+	if !exists {
+		return rate, ErrTrackingUnavailable
+	}
+
+	sql, err := renderSQL("selectTrackingWindow", selectTrackingWindow, data)
+	if err != nil {
+		return rate, err
+	}
+
+	rows, err := conn.Query(ctx, sql, window.Seconds())
+	if err != nil {
+		return rate, fmt.Errorf("failed to read tracking samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []Sample
+	for rows.Next() {
+		var sample Sample
+		if err := rows.Scan(&sample.RecordedAt, &sample.XID); err != nil {
+			return rate, fmt.Errorf("failed to read tracking samples: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return rate, fmt.Errorf("failed to read tracking samples: %w", err)
+	}
+
+	if len(samples) < 2 || !samples[1].RecordedAt.After(samples[0].RecordedAt) {
+		return rate, ErrNotEnoughSamples
+	}
+
+	first, err := strconv.ParseUint(samples[0].XID, 10, 64)
+	if err != nil {
+		return rate, fmt.Errorf("invalid sample xid %q: %w", samples[0].XID, err)
+	}
+	last, err := strconv.ParseUint(samples[1].XID, 10, 64)
+	if err != nil {
+		return rate, fmt.Errorf("invalid sample xid %q: %w", samples[1].XID, err)
+	}
+	if last < first {
+		return rate, fmt.Errorf("tracking samples went backwards from xid %d to %d", first, last)
+	}
+
+	rate.From, rate.To, rate.XIDs = samples[0].RecordedAt, samples[1].RecordedAt, last-first
+	return rate, nil
+}
+
+func (e *Estimator) sampledBurnRate(ctx context.Context, conn Querier, sample time.Duration) (BurnRate, error) {
+	rate := BurnRate{Source: BurnRateSourceSample}
+
+	sql, err := e.serverSQL(ctx, conn, "selectXIDCounter", selectXIDCounter)
+	if err != nil {
+		return rate, err
+	}
+
+	var first, last uint64
+	if err := conn.QueryRow(ctx, sql).Scan(&rate.From, &first); err != nil {
+		return rate, fmt.Errorf("failed to read xid counter: %w", err)
+	}
+
+	select {
+	case <-time.After(sample):
+	case <-ctx.Done():
+		return rate, ctx.Err()
+	}
+
+	if err := conn.QueryRow(ctx, sql).Scan(&rate.To, &last); err != nil {
+		return rate, fmt.Errorf("failed to read xid counter: %w", err)
+	}
+
+	rate.XIDs = last - first
+	return rate, nil
+}
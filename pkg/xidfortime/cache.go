@@ -0,0 +1,155 @@
+package xidfortime
+
+import "sync"
+
+// Cache holds what an Estimator learns of a table that doesn't depend on the
+// target time, such as its histogram bounds, so a batch of estimates against
+// the same table only pays for them once. It is safe for concurrent use, and a
+// nil Cache caches nothing.
+type Cache struct {
+	mu           sync.Mutex
+	bounds       map[boundsKey][]Row
+	inspections  map[Relation]Inspection
+	validated    map[Relation]bool
+	correlations map[Relation]*float64
+	detected     *Server
+}
+
+type boundsKey struct {
+	rel           Relation
+	strategy      string
+	samplePercent float64
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{
+		bounds: map[boundsKey][]Row{}, inspections: map[Relation]Inspection{}, validated: map[Relation]bool{},
+		correlations: map[Relation]*float64{},
+	}
+}
+
+// cachedBounds returns the bounds cached under key, calling fetch to find them
+// if there are none. Callers get their own copy, as they sort it in place.
+func (c *Cache) cachedBounds(key boundsKey, fetch func() ([]Row, error)) ([]Row, error) {
+	if c == nil {
+		return fetch()
+	}
+
+	c.mu.Lock()
+	bounds, ok := c.bounds[key]
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+		if bounds, err = fetch(); err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.bounds[key] = bounds
+		c.mu.Unlock()
+	}
+
+	return append([]Row(nil), bounds...), nil
+}
+
+func (c *Cache) cachedInspection(rel Relation, fetch func() (Inspection, error)) (Inspection, error) {
+	if c == nil {
+		return fetch()
+	}
+
+	c.mu.Lock()
+	inspection, ok := c.inspections[rel]
+	c.mu.Unlock()
+
+	if ok {
+		return inspection, nil
+	}
+
+	inspection, err := fetch()
+	if err != nil {
+		return inspection, err
+	}
+
+	c.mu.Lock()
+	c.inspections[rel] = inspection
+	c.mu.Unlock()
+
+	return inspection, nil
+}
+
+// cachedValidation calls validate unless rel has already passed it.
+func (c *Cache) cachedValidation(rel Relation, validate func() error) error {
+	if c == nil {
+		return validate()
+	}
+
+	c.mu.Lock()
+	ok := c.validated[rel]
+	c.mu.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	if err := validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.validated[rel] = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *Cache) cachedCorrelation(rel Relation, sample func() (*float64, error)) (*float64, error) {
+	if c == nil {
+		return sample()
+	}
+
+	c.mu.Lock()
+	correlation, ok := c.correlations[rel]
+	c.mu.Unlock()
+
+	if ok {
+		return correlation, nil
+	}
+
+	correlation, err := sample()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.correlations[rel] = correlation
+	c.mu.Unlock()
+
+	return correlation, nil
+}
+
+func (c *Cache) cachedServer(detect func() (Server, error)) (Server, error) {
+	if c == nil {
+		return detect()
+	}
+
+	c.mu.Lock()
+	detected := c.detected
+	c.mu.Unlock()
+
+	if detected != nil {
+		return *detected, nil
+	}
+
+	server, err := detect()
+	if err != nil {
+		return server, err
+	}
+
+	c.mu.Lock()
+	c.detected = &server
+	c.mu.Unlock()
+
+	return server, nil
+}
@@ -0,0 +1,140 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// Shard is a placement of a shard of a Citus distributed table, named as the
+// node it's placed on knows it.
+type Shard struct {
+	Host  string
+	Port  int
+	Table string
+}
+
+// Node identifies the node holding the shard, as host:port.
+func (s Shard) Node() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// DistributedShards lists the shard placements of table on every active
+// primary node when connected to a Citus coordinator, or nothing when Citus
+// isn't installed or the table isn't distributed.
+func DistributedShards(ctx context.Context, conn Querier, table string) ([]Shard, error) {
+	var citus bool
+	if err := conn.QueryRow(ctx, selectCitusInstalled).Scan(&citus); err != nil {
+		return nil, fmt.Errorf("failed to check for citus: %w", err)
+	}
+	if !citus {
+		return nil, nil
+	}
+
+	ident, err := ParseIdentifier(table)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, selectShardPlacements, string(quoteIdentifier(ident)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shard placements: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []Shard
+	for rows.Next() {
+		var shard Shard
+		if err := rows.Scan(&shard.Host, &shard.Port, &shard.Table); err != nil {
+			return nil, fmt.Errorf("failed to list shard placements: %w", err)
+		}
+		shards = append(shards, shard)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list shard placements: %w", err)
+	}
+
+	return shards, nil
+}
+
+// NodeConnector connects to a node of a Citus cluster, returning a function
+// to close the connection once done with.
+type NodeConnector func(ctx context.Context, host string, port int) (Querier, func(), error)
+
+// EstimateDistributed estimates the xid for t on every node holding a shard.
+// Each node assigns its own xids, so a single answer is meaningless: this
+// returns the newest estimate among each node's shards, keyed by node, which
+// is what a point-in-time recovery of the cluster needs. Shards with no rows
+// either side of t are skipped, but a node where every shard fails fails the
+// whole estimate.
+func (e *Estimator) EstimateDistributed(ctx context.Context, connect NodeConnector, shards []Shard, t time.Time) (map[string]Result, error) {
+	nodes := map[string][]Shard{}
+	for _, shard := range shards {
+		nodes[shard.Node()] = append(nodes[shard.Node()], shard)
+	}
+
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	results := map[string]Result{}
+	for _, node := range names {
+		result, err := e.estimateNode(ctx, connect, nodes[node], t)
+		if err != nil {
+			return results, fmt.Errorf("failed to estimate on node %s: %w", node, err)
+		}
+
+		level.Info(e.logger()).Log("event", "estimated_node", "node", node, "shards", len(nodes[node]),
+			"xid", result.XID(), "xid8", result.XID8)
+		results[node] = result
+	}
+
+	return results, nil
+}
+
+func (e *Estimator) estimateNode(ctx context.Context, connect NodeConnector, shards []Shard, t time.Time) (Result, error) {
+	conn, release, err := connect(ctx, shards[0].Host, shards[0].Port)
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+	defer release()
+
+	var (
+		newest    Result
+		newestXID uint64
+		lastErr   error
+	)
+	for _, shard := range shards {
+		result, err := e.EstimateXID(ctx, conn, shard.Table, t)
+		switch {
+		case errors.Is(err, ErrOutOfRange), errors.Is(err, ErrNullTimes), errors.Is(err, pgx.ErrNoRows):
+			level.Debug(e.logger()).Log("event", "skipped_shard", "shard", shard.Table, "error", err)
+			lastErr = err
+			continue
+		case err != nil:
+			return result, err
+		}
+
+		xid, err := strconv.ParseUint(result.XID8, 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("invalid xid8 %q: %w", result.XID8, err)
+		}
+		if newest.XID8 == "" || xid > newestXID {
+			newest, newestXID = result, xid
+		}
+	}
+
+	if newest.XID8 == "" {
+		return Result{TargetTime: t}, fmt.Errorf("no shard could be estimated: %w", lastErr)
+	}
+
+	return newest, nil
+}
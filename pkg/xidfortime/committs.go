@@ -0,0 +1,221 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrCommitTimestampsDisabled is returned in exact mode when the server isn't
+// running with track_commit_timestamp=on.
+var ErrCommitTimestampsDisabled = errors.New("exact mode requires track_commit_timestamp=on")
+
+const (
+	// maxCommitTimestampScan bounds how many xids are checked at once when
+	// looking for one with a commit timestamp, as aborted and subtransaction xids
+	// have none.
+	maxCommitTimestampScan = 1000
+	// commitTimestampWindow is how many xids either side of the bisected
+	// boundary are checked for the true last commit, as xids are assigned when a
+	// transaction starts and so don't commit in order.
+	commitTimestampWindow = 1000
+	// maxSeedWidenings caps how many times the seed range is doubled when its
+	// xids don't in fact straddle the target.
+	maxSeedWidenings = 16
+)
+
+// commitTimestampStrategy runs a table strategy to find the xmins of the rows
+// inserted either side of t, then uses them as a seed range in which to search
+// the commit timestamps recorded under track_commit_timestamp, finding the last
+// xid to commit before t exactly.
+type commitTimestampStrategy struct {
+	e    *Estimator
+	seed Strategy
+}
+
+func (s commitTimestampStrategy) Name() string { return StrategyCommitTimestamp }
+
+func (s commitTimestampStrategy) Viable(i Inspection) bool {
+	return i.TrackCommitTimestamp && s.seed != nil && s.seed.Viable(i)
+}
+
+func (s commitTimestampStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	logger := s.e.logger()
+	if s.seed == nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, fmt.Errorf("no table strategy to seed commit timestamps")
+	}
+
+	result, err := s.seed.Estimate(ctx, conn, rel, t)
+	if err == nil {
+		result, err = s.e.skipFrozen(ctx, conn, rel, result)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	lower, err := parseXID(result.Before.XMin)
+	if err != nil {
+		return result, err
+	}
+	upper, err := parseXID(result.Exceeded.XMin)
+	if err != nil {
+		return result, err
+	}
+
+	// Rows written by overlapping transactions can leave the row past t with
+	// the older xid, so order the pair before widen checks each side of t.
+	if int32(upper-lower) < 0 {
+		lower, upper = upper, lower
+	}
+
+	if lower, upper, err = s.widen(ctx, conn, t, lower, upper); err != nil {
+		return result, err
+	}
+
+	// Bisect offsets from the lower xid, where uint32 arithmetic takes care of
+	// any wraparound between the two. This finds a boundary, but not yet the
+	// last commit, as commit order differs from xid order.
+	lo, hi, probes := uint32(0), upper-lower, 0
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		probes++
+
+		scan := hi - mid - 1
+		if scan > maxCommitTimestampScan {
+			scan = maxCommitTimestampScan
+		}
+
+		offset, at, err := s.nextCommitTimestamp(ctx, conn, lower+mid, scan)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			hi = mid
+		case err != nil:
+			return result, err
+		case at.After(t):
+			hi = mid + offset
+		default:
+			lo = mid + offset
+		}
+	}
+
+	boundary := lower + lo
+	level.Debug(logger).Log("event", "bisected_commit_timestamps", "probes", probes,
+		"seed_strategy", s.seed.Name(), "boundary_xid", boundary)
+
+	var (
+		committed   string
+		committedAt time.Time
+	)
+	err = conn.QueryRow(ctx, selectLastCommitInWindow, int64(boundary), commitTimestampWindow, t).
+		Scan(&committed, &committedAt)
+	if err != nil {
+		return result, fmt.Errorf("failed to find last commit near xid %d: %w", boundary, err)
+	}
+
+	result.Strategy = s.Name()
+	result.CommittedXID, result.CommittedAt = committed, &committedAt
+
+	level.Debug(logger).Log("event", "found_last_commit", "committed_xid", committed, "committed_at", committedAt)
+
+	return result, nil
+}
+
+// widen checks the seed xids really do straddle t, which they may not if the
+// rows were inserted by long-running transactions, and doubles the range in
+// the offending direction until they do.
+func (s commitTimestampStrategy) widen(ctx context.Context, conn Querier, t time.Time, lower, upper uint32) (uint32, uint32, error) {
+	sql, err := s.e.serverSQL(ctx, conn, "selectNextXID", selectNextXID)
+	if err != nil {
+		return lower, upper, err
+	}
+
+	var nextXID int64
+	if err := conn.QueryRow(ctx, sql).Scan(&nextXID); err != nil {
+		return lower, upper, fmt.Errorf("failed to read next xid: %w", err)
+	}
+
+	// Commit timestamps are truncated along with the commit log, so nothing
+	// older than the oldest unfrozen xid has one
+	var oldestXID int64
+	if err := conn.QueryRow(ctx, selectOldestXID).Scan(&oldestXID); err != nil {
+		return lower, upper, fmt.Errorf("failed to read oldest xid: %w", err)
+	}
+	if int32(lower-uint32(oldestXID)) < 0 {
+		lower = uint32(oldestXID)
+	}
+
+	step := uint32(commitTimestampWindow)
+	for attempt := 0; ; attempt++ {
+		_, at, err := s.nextCommitTimestamp(ctx, conn, lower, 0)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return lower, upper, err
+		}
+		if err == nil && !at.After(t) {
+			break
+		}
+		// Never probe past the oldest xid, or wrap into the newest
+		floor := lower - uint32(oldestXID)
+		if attempt == maxSeedWidenings || floor == 0 {
+			return lower, upper, fmt.Errorf("could not find an xid committed before %s near xid %d", t, lower)
+		}
+		if floor < step {
+			step = floor
+		}
+
+		lower, step = lower-step, step*2
+	}
+
+	step = uint32(commitTimestampWindow)
+	for attempt := 0; attempt < maxSeedWidenings; attempt++ {
+		_, at, err := s.nextCommitTimestamp(ctx, conn, upper, 0)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return lower, upper, err
+		}
+		if err == nil && at.After(t) {
+			break
+		}
+
+		// Never probe xids that haven't been assigned, which Postgres rejects
+		headroom := uint32(nextXID) - 1 - upper
+		if headroom == 0 {
+			break
+		}
+		if headroom < step {
+			step = headroom
+		}
+
+		upper, step = upper+step, step*2
+	}
+
+	return lower, upper, nil
+}
+
+// nextCommitTimestamp returns the offset from xid, no more than scan, of the
+// first xid with a commit timestamp, along with that timestamp.
+func (s commitTimestampStrategy) nextCommitTimestamp(ctx context.Context, conn Querier, xid, scan uint32) (uint32, time.Time, error) {
+	var (
+		offset    int64
+		committed string
+		at        time.Time
+	)
+	err := conn.QueryRow(ctx, selectNextCommitTimestamp, int64(xid), int64(scan)).Scan(&offset, &committed, &at)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, at, fmt.Errorf("failed to read commit timestamps: %w", err)
+	}
+
+	return uint32(offset), at, err
+}
+
+func parseXID(xid string) (uint32, error) {
+	parsed, err := strconv.ParseUint(xid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid xid %q: %w", xid, err)
+	}
+
+	return uint32(parsed), nil
+}
@@ -0,0 +1,96 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CompactionTier thins samples of the tracking table older than After to one
+// per Resolution. A lookup among thinned samples is bracketed by two that are
+// less than twice Resolution apart.
+type CompactionTier struct {
+	Resolution time.Duration
+	After      time.Duration
+}
+
+// ParseCompactionTier parses a tier written as RESOLUTION:AFTER, such as 1h:168h
+// to keep one sample an hour once they're a week old.
+func ParseCompactionTier(s string) (CompactionTier, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return CompactionTier{}, fmt.Errorf("invalid compaction tier %q, expected RESOLUTION:AFTER", s)
+	}
+
+	resolution, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return CompactionTier{}, fmt.Errorf("invalid compaction tier %q: %w", s, err)
+	}
+	after, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return CompactionTier{}, fmt.Errorf("invalid compaction tier %q: %w", s, err)
+	}
+	if resolution <= 0 || after < 0 {
+		return CompactionTier{}, fmt.Errorf("invalid compaction tier %q, resolution must be positive and age not negative", s)
+	}
+
+	return CompactionTier{Resolution: resolution, After: after}, nil
+}
+
+// Compaction is what CompactTracking deleted.
+type Compaction struct {
+	Thinned int64 `json:"thinned"`
+	Expired int64 `json:"expired"`
+}
+
+// CompactTracking thins the samples of the tracking table in schema to the
+// resolution of each tier, and deletes those older than retain unless it is
+// zero. Each tier applies up to the age of the next, and older tiers must be
+// no finer than newer ones, so no lookup ever becomes more precise with age.
+func CompactTracking(ctx context.Context, conn Execer, schema string, tiers []CompactionTier, retain time.Duration) (Compaction, error) {
+	var compaction Compaction
+
+	tiers = append([]CompactionTier(nil), tiers...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].After < tiers[j].After })
+	for idx := 1; idx < len(tiers); idx++ {
+		if tiers[idx].Resolution < tiers[idx-1].Resolution {
+			return compaction, fmt.Errorf("compaction tier after %s is finer than the one before it", tiers[idx].After)
+		}
+	}
+
+	data := newTrackingData(schema, Server{})
+	thin, err := renderSQL("thinTrackingSamples", thinTrackingSamples, data)
+	if err != nil {
+		return compaction, err
+	}
+
+	for idx, tier := range tiers {
+		var before interface{}
+		if idx+1 < len(tiers) {
+			before = tiers[idx+1].After.Seconds()
+		}
+
+		tag, err := conn.Exec(ctx, thin, tier.After.Seconds(), before, tier.Resolution.Seconds())
+		if err != nil {
+			return compaction, fmt.Errorf("failed to thin tracking samples: %w", err)
+		}
+		compaction.Thinned += tag.RowsAffected()
+	}
+
+	if retain > 0 {
+		expire, err := renderSQL("deleteTrackingSamples", deleteTrackingSamples, data)
+		if err != nil {
+			return compaction, err
+		}
+
+		tag, err := conn.Exec(ctx, expire, retain.Seconds())
+		if err != nil {
+			return compaction, fmt.Errorf("failed to delete expired tracking samples: %w", err)
+		}
+		compaction.Expired = tag.RowsAffected()
+	}
+
+	return compaction, nil
+}
@@ -0,0 +1,102 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Policies for tables whose id order is poorly correlated with insertion time,
+// where the histogram strategy's probes by id can't be trusted.
+const (
+	CorrelationPolicyWarn   = "warn"
+	CorrelationPolicyRefuse = "refuse"
+)
+
+// CorrelationPolicies lists the valid correlation policies.
+var CorrelationPolicies = []string{CorrelationPolicyWarn, CorrelationPolicyRefuse}
+
+// DefaultMinCorrelation is the correlation below which id order is considered
+// too poorly correlated with insertion time to trust.
+const DefaultMinCorrelation = 0.9
+
+// CorrelationError is returned under the refuse policy when id order is too
+// poorly correlated with insertion time.
+type CorrelationError struct {
+	Source      string
+	Correlation float64
+	Threshold   float64
+}
+
+func (e *CorrelationError) Error() string {
+	return fmt.Sprintf("%s correlation of %.2f is below %.2f, so id order doesn't follow insertion time",
+		e.Source, e.Correlation, e.Threshold)
+}
+
+// checkCorrelation reads the correlation of the id column with the physical
+// order of the table from pg_stats, which is near one for append-only tables
+// but drops once a migration or repack rewrites rows out of order. With
+// SampleCorrelation it also ranks a sample of rows by id and by time, and
+// checks how well the two orders agree.
+func (e *Estimator) checkCorrelation(ctx context.Context, conn Querier, rel Relation, inspection Inspection) error {
+	threshold := e.minCorrelation()
+	if inspection.IDCorrelation != nil {
+		if err := e.correlated("pg_stats", *inspection.IDCorrelation, threshold); err != nil {
+			return err
+		}
+	}
+
+	if !e.SampleCorrelation {
+		return nil
+	}
+
+	sampled, err := e.Cache.cachedCorrelation(rel, func() (*float64, error) {
+		return e.sampleCorrelation(ctx, conn, rel)
+	})
+	if err != nil || sampled == nil {
+		return err
+	}
+
+	return e.correlated("sampled", *sampled, threshold)
+}
+
+func (e *Estimator) minCorrelation() float64 {
+	if e.MinCorrelation <= 0 {
+		return DefaultMinCorrelation
+	}
+
+	return e.MinCorrelation
+}
+
+func (e *Estimator) correlated(source string, correlation, threshold float64) error {
+	level.Debug(e.logger()).Log("event", "id_correlation", "source", source, "correlation", correlation)
+	if correlation >= threshold {
+		return nil
+	}
+
+	if e.CorrelationPolicy == CorrelationPolicyRefuse {
+		return &CorrelationError{Source: source, Correlation: correlation, Threshold: threshold}
+	}
+
+	level.Warn(e.logger()).Log("event", "poorly_correlated", "source", source, "correlation", correlation,
+		"threshold", threshold, "msg", "id order may not follow insertion time, so the estimate may be wrong")
+
+	return nil
+}
+
+// sampleCorrelation computes the rank correlation of id and time over a
+// TABLESAMPLE, which is nil if the sample has too few rows.
+func (e *Estimator) sampleCorrelation(ctx context.Context, conn Querier, rel Relation) (*float64, error) {
+	sql, err := renderSQL("selectSampleCorrelation", selectSampleCorrelation, rel.queryData())
+	if err != nil {
+		return nil, err
+	}
+
+	var correlation *float64
+	if err := conn.QueryRow(ctx, sql, e.samplePercent()).Scan(&correlation); err != nil {
+		return nil, fmt.Errorf("failed to sample id correlation: %w", err)
+	}
+
+	return correlation, nil
+}
@@ -0,0 +1,88 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCronUnavailable is returned when scheduling samples on a server without
+// the pg_cron extension.
+var ErrCronUnavailable = errors.New("pg_cron is not installed")
+
+// DefaultCronJob is the name of the pg_cron job recording samples, unless
+// another is configured.
+const DefaultCronJob = "xid-for-time-record"
+
+// ScheduleRecording schedules a pg_cron job named job to record a sample to the
+// tracking table in schema on schedule, so the database maintains its own
+// mapping between time and xids. Scheduling a job that already exists updates
+// it in place, so this can be run again safely. It needs pg_cron 1.4 or later,
+// and returns the id of the job.
+func ScheduleRecording(ctx context.Context, conn Querier, schema, job, schedule string) (int64, error) {
+	if err := checkCron(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	server, err := DetectServer(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	data := newTrackingData(schema, server)
+	var exists bool
+	if err := conn.QueryRow(ctx, selectTrackingTable, data.Table).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to check for tracking table: %w", err)
+	}
+	if !exists {
+		return 0, ErrTrackingUnavailable
+	}
+
+	command, err := renderSQL("recordTrackingSample", recordTrackingSample, data)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err := conn.QueryRow(ctx, scheduleCronJob, job, schedule, command).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to schedule pg_cron job: %w", err)
+	}
+
+	return id, nil
+}
+
+// UnscheduleRecording removes the pg_cron jobs named job, returning how many
+// there were. Removing a job that doesn't exist is not an error.
+func UnscheduleRecording(ctx context.Context, conn Querier, job string) (int, error) {
+	if err := checkCron(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	rows, err := conn.Query(ctx, unscheduleCronJob, job)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unschedule pg_cron job: %w", err)
+	}
+	defer rows.Close()
+
+	removed := 0
+	for rows.Next() {
+		removed++
+	}
+	if err := rows.Err(); err != nil {
+		return removed, fmt.Errorf("failed to unschedule pg_cron job: %w", err)
+	}
+
+	return removed, nil
+}
+
+func checkCron(ctx context.Context, conn Querier) error {
+	var installed bool
+	if err := conn.QueryRow(ctx, selectCronInstalled).Scan(&installed); err != nil {
+		return fmt.Errorf("failed to check for pg_cron: %w", err)
+	}
+	if !installed {
+		return ErrCronUnavailable
+	}
+
+	return nil
+}
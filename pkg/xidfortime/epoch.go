@@ -0,0 +1,40 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// fullXID extends a 32-bit xid with the epoch, producing the 64-bit xid8 that
+// pg_current_xact_id and friends return. The epoch comes from the next xid to
+// be assigned, where any xid numerically above its low 32 bits must belong to
+// the previous epoch.
+func (e *Estimator) fullXID(ctx context.Context, conn Querier, xid string) (string, error) {
+	xid32, err := parseXID(xid)
+	if err != nil {
+		return "", err
+	}
+
+	next, err := e.NextFullXID(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(next-uint64(uint32(next)-xid32), 10), nil
+}
+
+// NextFullXID reads the epoch-qualified xid that will be assigned next.
+func (e *Estimator) NextFullXID(ctx context.Context, conn Querier) (uint64, error) {
+	sql, err := e.serverSQL(ctx, conn, "selectNextFullXID", selectNextFullXID)
+	if err != nil {
+		return 0, err
+	}
+
+	var next uint64
+	if err := conn.QueryRow(ctx, sql).Scan(&next); err != nil {
+		return 0, fmt.Errorf("failed to read xid epoch: %w", err)
+	}
+
+	return next, nil
+}
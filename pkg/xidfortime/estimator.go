@@ -0,0 +1,560 @@
+// Package xidfortime estimates the last Postgres transaction ID that committed
+// before a given time, using the id and created_at columns of an application
+// table.
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/label"
+)
+
+// Querier is the subset of the pgx API used by the estimator. It is satisfied
+// by *pgx.Conn, *pgxpool.Pool and pgx.Tx, though only a pool is safe to use
+// with a Concurrency above one.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// ErrOutOfRange is wrapped by errors for target times or xids outside those of
+// the rows in the table, such as times before its first row was inserted.
+var ErrOutOfRange = errors.New("outside the range of the table")
+
+// ErrNullTimes is wrapped by errors when every row that could bracket the
+// target has a null time column, so there is nothing to estimate from.
+var ErrNullTimes = errors.New("time column is null")
+
+// Thresholds are the pair of histogram bounds that bracket the target time.
+type Thresholds struct {
+	MinID        string    `json:"min_id"`
+	MinCreatedAt time.Time `json:"min_created_at"`
+	MaxID        string    `json:"max_id"`
+	MaxCreatedAt time.Time `json:"max_created_at"`
+
+	// Partition is set when both bounds are in the same partition, which the
+	// probes between them are routed to if the table is range partitioned by
+	// id or time.
+	Partition string `json:"partition,omitempty"`
+}
+
+// Row is a single row of the estimation table.
+type Row struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	XMin      string    `json:"xmin,omitempty"`
+
+	// Partition is the partition holding the row, only known for histogram
+	// bounds of partitioned tables
+	Partition string `json:"partition,omitempty"`
+}
+
+// Result is the outcome of an estimate. Before is the last row inserted prior to
+// the target time, and its xmin is the estimated xid unless we found a better
+// CommittedXID, either exactly from commit timestamps or by walking back from an
+// xmin that didn't commit. XIDs are 32-bit, except XID8 which qualifies the
+// estimate with its epoch. Thresholds are only set by the histogram and
+// tablesample strategies. The tracking-table strategy sets Before and Exceeded
+// to the samples either side of the target, whose IDs are their LSNs, and
+// estimates the InterpolatedXID between them.
+type Result struct {
+	Strategy        string     `json:"strategy"`
+	TargetTime      time.Time  `json:"target_time"`
+	Thresholds      Thresholds `json:"thresholds"`
+	Exceeded        Row        `json:"exceeded"`
+	Before          Row        `json:"before"`
+	CommittedXID    string     `json:"committed_xid,omitempty"`
+	CommittedAt     *time.Time `json:"committed_at,omitempty"`
+	InterpolatedXID string     `json:"interpolated_xid,omitempty"`
+	XIDStatus       string     `json:"xid_status,omitempty"`
+	XID8            string     `json:"xid8"`
+
+	// Plans are the query plans of each statement run, when explaining.
+	Plans []Plan `json:"plans,omitempty"`
+
+	// FrozenSkipped counts the rows walked back past because their xmin was
+	// frozen, when the row found by the strategy was.
+	FrozenSkipped int `json:"frozen_skipped,omitempty"`
+
+	// Slack is how far before the requested time TargetTime was moved.
+	Slack time.Duration `json:"slack,omitempty"`
+
+	// ObservedSkew is the furthest any row's created_at ran behind that of a
+	// row inserted before it, within the window scanned for clock skew.
+	ObservedSkew time.Duration `json:"observed_skew,omitempty"`
+
+	// NullSkipped counts the rows between Before and Exceeded that were passed
+	// over because their time column is null.
+	NullSkipped int `json:"null_skipped,omitempty"`
+
+	// TxidSnapshot approximates the snapshot a transaction starting at the
+	// target time would have taken, as xmin:xmax:xip_list, when asked for.
+	TxidSnapshot string `json:"txid_snapshot,omitempty"`
+
+	// BeyondHead marks targets in the future, or newer than the newest row,
+	// for which the estimate is the latest xid assigned. Before is the newest
+	// row, and there is no row after the target.
+	BeyondHead bool `json:"beyond_head,omitempty"`
+}
+
+// XID is the estimated transaction ID.
+func (r Result) XID() string {
+	if r.CommittedXID != "" {
+		return r.CommittedXID
+	}
+	if r.InterpolatedXID != "" {
+		return r.InterpolatedXID
+	}
+
+	return r.Before.XMin
+}
+
+// ExceededBy is how far past the target time the first row after it was
+// inserted, or zero beyond the head of the table where there is none.
+func (r Result) ExceededBy() time.Duration {
+	if r.BeyondHead {
+		return 0
+	}
+
+	return r.Exceeded.CreatedAt.Sub(r.TargetTime)
+}
+
+// LowerXID is the xmin of the last row inserted before the target time, and so
+// the newest xid known to precede it.
+func (r Result) LowerXID() string {
+	return r.Before.XMin
+}
+
+// UpperXID is the xmin of the first row inserted after the target time, and so
+// the oldest xid known to follow it.
+func (r Result) UpperXID() string {
+	return r.Exceeded.XMin
+}
+
+// Gap is the time between the rows either side of the target time, within
+// which the estimated xid may have committed. It is zero beyond the head of
+// the table.
+func (r Result) Gap() time.Duration {
+	if r.BeyondHead {
+		return 0
+	}
+
+	return r.Exceeded.CreatedAt.Sub(r.Before.CreatedAt)
+}
+
+// BeforeBy is how far before the target time the estimated xid was inserted,
+// bounding the error of the estimate.
+func (r Result) BeforeBy() time.Duration {
+	return r.TargetTime.Sub(r.Before.CreatedAt)
+}
+
+const (
+	// DefaultIDColumn is the column used to order rows when none is configured
+	DefaultIDColumn = "id"
+	// DefaultTimeColumn is the column holding insert time when none is configured
+	DefaultTimeColumn = "created_at"
+	// DefaultSamplePercent is sampled from tables without a histogram
+	DefaultSamplePercent = 1.0
+)
+
+// Estimator finds the xid that committed before a target time. The zero value
+// is ready to use.
+type Estimator struct {
+	Logger kitlog.Logger
+
+	// IDColumn is a monotonically increasing column, such as a sequence-backed
+	// primary key. TimeColumn records when each row was inserted.
+	IDColumn   string
+	TimeColumn string
+
+	// Schema qualifies table names given without one, which are otherwise
+	// resolved through the search_path of the session.
+	Schema string
+
+	// Filter is a boolean SQL expression over the columns of the table, such as
+	// backfilled = false, excluding the rows it doesn't match from every probe.
+	// Rows whose times don't reflect when they were inserted corrupt estimates.
+	Filter string
+
+	// Concurrency is how many probe queries may run at once, defaulting to one.
+	Concurrency int
+
+	// Refine bisects the id range between the histogram thresholds before
+	// probing for the first row past the target time, which is much cheaper
+	// than scanning a bucket of millions of rows.
+	Refine bool
+
+	// Strategy forces the named strategy, rather than automatically choosing
+	// the cheapest viable one. See StrategyNames.
+	Strategy string
+
+	// Exact requires the commit-timestamp strategy, failing with
+	// ErrCommitTimestampsDisabled if the server doesn't track them.
+	Exact bool
+
+	// TrackingSchema is the schema of the tracking table, whose samples are
+	// preferred over the estimation table for the times they cover. It
+	// defaults to DefaultTrackingSchema.
+	TrackingSchema string
+
+	// SamplePercent is the percentage of the table's blocks sampled when the id
+	// column has no histogram, defaulting to DefaultSamplePercent.
+	SamplePercent float64
+
+	// Verify checks the estimated xid committed, walking back to the nearest
+	// one that did if not.
+	Verify bool
+
+	// UpdatePolicy decides what to do with tables whose ratio of updates to
+	// inserts exceeds UpdateRatio, as their xmins reflect updates. It defaults
+	// to UpdatePolicyWarn. See UpdatePolicies.
+	UpdatePolicy string
+	UpdateRatio  float64
+
+	// ReplicaLagPolicy decides what to do when connected to a standby that
+	// hasn't replayed past the target time, defaulting to
+	// ReplicaLagPolicyWarn. ReplicaLagPolicyWait waits up to ReplicaWait for
+	// it to catch up. See ReplicaLagPolicies.
+	ReplicaLagPolicy string
+	ReplicaWait      time.Duration
+
+	// CorrelationPolicy decides what to do before trusting the histogram
+	// strategy with ids whose order correlates with insertion time less than
+	// MinCorrelation. It defaults to CorrelationPolicyWarn, and
+	// SampleCorrelation checks a sample of rows as well as pg_stats. See
+	// CorrelationPolicies.
+	CorrelationPolicy string
+	MinCorrelation    float64
+	SampleCorrelation bool
+
+	// MaxAnalyzeAge is how long before the target time the table may have last
+	// been analyzed before the histogram strategy warns its bounds are stale,
+	// defaulting to DefaultMaxAnalyzeAge.
+	MaxAnalyzeAge time.Duration
+
+	// SkewWindow scans this many rows either side of the threshold for the
+	// newest xmin inserted before the target, robust to application servers
+	// whose clocks are skewed. Zero disables the scan.
+	SkewWindow int
+
+	// Explain runs EXPLAIN for every statement before running it, recording the
+	// plans on the Result so costly probes can be spotted.
+	Explain bool
+
+	// MaxCost and MaxRows refuse to run any statement the planner expects to
+	// cost more, or return more rows, failing with a CostError. This catches
+	// probes that a missing index has turned into full scans. Force logs a
+	// warning instead.
+	MaxCost float64
+	MaxRows float64
+	Force   bool
+
+	// StatementTimeout and LockTimeout are SET LOCAL in a transaction around
+	// each statement when set, which needs a conn that can begin transactions.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+
+	// Snapshot runs every statement of an estimate against the snapshot of one
+	// repeatable read, read only transaction, so concurrent writes can't make
+	// its statistics and row probes disagree. It needs a pool or connection.
+	Snapshot bool
+
+	// Retry retries statements that fail transiently, such as during a
+	// failover.
+	Retry RetryPolicy
+
+	// Cache, when set, keeps histogram bounds and table inspections between
+	// estimates, for batches of target times against the same table.
+	Cache *Cache
+
+	// Tolerance is the largest acceptable Gap. When set, estimates that miss it
+	// are retried with progressively more thorough settings and strategies,
+	// failing with a ToleranceError if none succeed.
+	Tolerance time.Duration
+
+	// Slack moves every target time earlier by this much before estimating,
+	// for a conservative recovery point that loses a little data rather than
+	// risk including anything after an incident.
+	Slack time.Duration
+
+	// TxidSnapshot also approximates the txid_snapshot at the target time from
+	// commit timestamps, for tools that consume snapshots rather than an xid.
+	TxidSnapshot bool
+
+	// detected is the server found at the start of the current estimate
+	detected *Server
+
+	// skipCommitTimestamps leaves automatically selected strategies unrefined
+	// by commit timestamps, so they can be measured against them
+	skipCommitTimestamps bool
+}
+
+// NewEstimator returns an Estimator that logs progress to logger.
+func NewEstimator(logger kitlog.Logger) *Estimator {
+	return &Estimator{Logger: logger}
+}
+
+func (e *Estimator) logger() kitlog.Logger {
+	if e.Logger == nil {
+		return kitlog.NewNopLogger()
+	}
+
+	return e.Logger
+}
+
+func (e *Estimator) concurrency() int {
+	if e.Concurrency < 1 {
+		return 1
+	}
+
+	return e.Concurrency
+}
+
+func (e *Estimator) trackingSchema() string {
+	if e.TrackingSchema == "" {
+		return DefaultTrackingSchema
+	}
+
+	return e.TrackingSchema
+}
+
+func (e *Estimator) samplePercent() float64 {
+	if e.SamplePercent <= 0 {
+		return DefaultSamplePercent
+	}
+
+	return e.SamplePercent
+}
+
+// Relation parses a possibly schema-qualified table name, and combines it with
+// the configured columns.
+func (e *Estimator) Relation(table string) (Relation, error) {
+	var rel Relation
+
+	ident, err := ParseIdentifier(table)
+	if err != nil {
+		return rel, err
+	}
+	if len(ident) == 2 {
+		rel.Schema, rel.Table = ident[0], ident[1]
+	} else {
+		rel.Table = ident[0]
+	}
+	if rel.Schema == "" && e.Schema != "" {
+		if rel.Schema, err = parseSchema(e.Schema); err != nil {
+			return rel, err
+		}
+	}
+
+	idColumn, timeColumn := e.IDColumn, e.TimeColumn
+	if idColumn == "" {
+		idColumn = DefaultIDColumn
+	}
+	if timeColumn == "" {
+		timeColumn = DefaultTimeColumn
+	}
+
+	if rel.IDColumn, err = parseColumn(idColumn); err != nil {
+		return rel, err
+	}
+	if rel.TimeColumn, err = parseColumn(timeColumn); err != nil {
+		return rel, err
+	}
+	if rel.filter, err = parseFilter(e.Filter); err != nil {
+		return rel, err
+	}
+
+	return rel, nil
+}
+
+// EstimateXID finds the last row of table inserted before t, returning the
+// xmin of that row as the estimated xid. The table may be schema-qualified, and
+// is resolved in the current schema if not.
+//
+// The target time is only ever bound as a query parameter. It is converted to
+// UTC first, as pgx binds the wall clock of a time to timestamp columns, so the
+// estimate would otherwise depend on the location t happens to be in. Any
+// Slack is taken off before estimating, and the Result's TargetTime is the
+// time that was estimated for.
+func (e *Estimator) EstimateXID(ctx context.Context, conn Querier, table string, t time.Time) (result Result, err error) {
+	t = t.UTC().Add(-e.Slack)
+	ctx, span := startSpan(ctx, "EstimateXID", label.String("table", table), label.String("target_time", t.Format(time.RFC3339Nano)))
+	defer func() { endSpan(ctx, span, err) }()
+
+	rel, err := e.Relation(table)
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	// The standby has to have replayed past t before the snapshot is taken
+	err = traced(ctx, "check_replica", func(ctx context.Context) error {
+		return e.checkReplica(ctx, conn, t)
+	})
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	conn, release, err := e.withSnapshot(ctx, conn)
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+	defer release()
+
+	if conn, err = e.withTimeouts(conn); err != nil {
+		return Result{TargetTime: t}, err
+	}
+	conn = e.withRetries(conn)
+
+	if e, err = e.withServer(ctx, conn); err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	if err := e.validateRelation(ctx, conn, rel); err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	if e.Explain || e.MaxCost > 0 || e.MaxRows > 0 {
+		checked, err := e.checked(conn, rel)
+		if err != nil {
+			return Result{TargetTime: t}, err
+		}
+
+		conn = checked
+		defer func() { result.Plans = checked.plans }()
+	}
+
+	// Samples from the tracking table are preferred for the times they cover,
+	// leaving the estimation table for times before tracking started
+	var tracked bool
+	err = traced(ctx, "check_tracking", func(ctx context.Context) (err error) {
+		result, tracked, err = e.estimateByTracking(ctx, conn, t)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	var head *Row
+	if !tracked {
+		err = traced(ctx, "check_head", func(ctx context.Context) (err error) {
+			head, err = e.beyondHead(ctx, conn, rel, t)
+			return err
+		})
+	}
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	switch {
+	case tracked:
+	case head != nil:
+		result, err = e.estimateHead(ctx, conn, t, *head)
+	default:
+		result, err = e.estimateTable(ctx, conn, rel, t)
+	}
+	result.Slack = e.Slack
+	if err == nil && e.Verify {
+		err = traced(ctx, "verify", func(ctx context.Context) (err error) {
+			result, err = e.verifyCommitted(ctx, conn, result)
+			return err
+		})
+	}
+	if err == nil {
+		result.XID8, err = e.fullXID(ctx, conn, result.XID())
+	}
+	if err == nil && e.TxidSnapshot {
+		err = traced(ctx, "txid_snapshot", func(ctx context.Context) (err error) {
+			result.TxidSnapshot, err = e.txidSnapshot(ctx, conn, result)
+			return err
+		})
+	}
+	if err != nil {
+		return result, err
+	}
+
+	span.SetAttributes(label.String("strategy", result.Strategy), label.String("xid", result.XID()))
+	level.Info(e.logger()).Log("event", "estimated", "strategy", result.Strategy, "xid", result.XID(), "xid8", result.XID8,
+		"lower_xid", result.LowerXID(), "upper_xid", result.UpperXID(), "gap", result.Gap())
+
+	return result, nil
+}
+
+// estimateTable estimates from the rows of the table either side of t,
+// narrowing and adjusting for updates as configured.
+func (e *Estimator) estimateTable(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	// Tables range partitioned by time are estimated from the partition the
+	// target falls in, unless the rows either side of it straddle partitions
+	partition, ok, err := e.timePartition(ctx, conn, rel, t)
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+	if ok {
+		result, err := e.estimateTable(ctx, conn, partition, t)
+		if !errors.Is(err, ErrOutOfRange) && !errors.Is(err, ErrNullTimes) && !errors.Is(err, pgx.ErrNoRows) {
+			return result, err
+		}
+
+		level.Info(e.logger()).Log("event", "partition_out_of_range", "partition", partition.Table, "error", err,
+			"msg", "falling back to the parent table")
+	}
+
+	var heavilyUpdated bool
+	err = traced(ctx, "check_updates", func(ctx context.Context) (err error) {
+		heavilyUpdated, err = e.checkUpdates(ctx, conn, rel)
+		return err
+	})
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	result, err := e.estimate(ctx, conn, rel, t)
+	if err == nil && e.SkewWindow > 0 && result.CommittedXID == "" {
+		err = traced(ctx, "skew_window", func(ctx context.Context) (err error) {
+			result, err = e.widenForSkew(ctx, conn, rel, result)
+			return err
+		})
+	}
+	if err == nil && heavilyUpdated && e.UpdatePolicy == UpdatePolicySample {
+		err = traced(ctx, "sample_minimum_xmin", func(ctx context.Context) (err error) {
+			result, err = e.sampleMinimumXMin(ctx, conn, rel, result)
+			return err
+		})
+	}
+	if err == nil && e.Tolerance > 0 && result.Gap() > e.Tolerance {
+		err = traced(ctx, "narrow", func(ctx context.Context) (err error) {
+			result, err = e.narrow(ctx, conn, rel, t, result)
+			return err
+		})
+	}
+
+	return result, err
+}
+
+func (e *Estimator) estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	var strategy Strategy
+	err := traced(ctx, "select_strategy", func(ctx context.Context) (err error) {
+		strategy, err = e.selectStrategy(ctx, conn, rel)
+		return err
+	})
+	if err != nil {
+		return Result{TargetTime: t}, err
+	}
+
+	level.Info(e.logger()).Log("event", "selected_strategy", "strategy", strategy.Name())
+
+	var result Result
+	err = traced(ctx, "estimate", func(ctx context.Context) (err error) {
+		result, err = strategy.Estimate(ctx, conn, rel, t)
+		return err
+	}, label.String("strategy", strategy.Name()))
+	if err != nil {
+		return result, err
+	}
+
+	return e.skipFrozen(ctx, conn, rel, result)
+}
@@ -0,0 +1,162 @@
+package xidfortime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// Plan is the query plan Postgres chose for a statement run by an estimate.
+type Plan struct {
+	Query string `json:"query"`
+	Plan  string `json:"plan"`
+}
+
+// CostError is returned when the planner expects a statement to cost more, or
+// return more rows, than the estimator allows.
+type CostError struct {
+	Query   string
+	Cost    float64
+	Rows    float64
+	MaxCost float64
+	MaxRows float64
+}
+
+func (e *CostError) Error() string {
+	return fmt.Sprintf("refusing to run %s: planner estimates cost %.0f and %.0f rows, exceeding max cost %.0f or max rows %.0f",
+		e.Query, e.Cost, e.Rows, e.MaxCost, e.MaxRows)
+}
+
+// checkedQuerier runs EXPLAIN for each statement before running it, so it can
+// record the plans and refuse statements that look too expensive. Statements
+// are named after the queries rendered for the relation, so plans can be
+// matched to the stage that ran them.
+type checkedQuerier struct {
+	Querier
+	e     *Estimator
+	names map[string]string
+
+	mu    sync.Mutex
+	plans []Plan
+}
+
+func (e *Estimator) checked(conn Querier, rel Relation) (*checkedQuerier, error) {
+	queries, err := renderQueries(rel, e.trackingSchema())
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	for _, query := range queries {
+		names[query.SQL] = query.Name
+	}
+
+	return &checkedQuerier{Querier: conn, e: e, names: names}, nil
+}
+
+func (q *checkedQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if err := q.check(ctx, sql, args); err != nil {
+		return errRow{err}
+	}
+
+	return q.Querier.QueryRow(ctx, sql, args...)
+}
+
+func (q *checkedQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := q.check(ctx, sql, args); err != nil {
+		return nil, err
+	}
+
+	return q.Querier.Query(ctx, sql, args...)
+}
+
+func (q *checkedQuerier) check(ctx context.Context, sql string, args []interface{}) error {
+	name := q.names[sql]
+	if name == "" {
+		name = strings.Join(strings.Fields(sql), " ")
+	}
+
+	if q.e.Explain {
+		q.explain(ctx, name, sql, args)
+	}
+	if q.e.MaxCost > 0 || q.e.MaxRows > 0 {
+		return q.guard(ctx, name, sql, args)
+	}
+
+	return nil
+}
+
+// explain records the plan for sql. Failing to explain shouldn't fail the
+// estimate, so errors are only logged.
+func (q *checkedQuerier) explain(ctx context.Context, name, sql string, args []interface{}) {
+	rows, err := q.Querier.Query(ctx, "explain (analyze off) "+sql, args...)
+	if err != nil {
+		level.Warn(q.e.logger()).Log("event", "explain_failed", "query", name, "error", err)
+		return
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			level.Warn(q.e.logger()).Log("event", "explain_failed", "query", name, "error", err)
+			return
+		}
+
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		level.Warn(q.e.logger()).Log("event", "explain_failed", "query", name, "error", err)
+		return
+	}
+
+	plan := Plan{Query: name, Plan: strings.Join(lines, "\n")}
+	level.Info(q.e.logger()).Log("event", "explained", "query", plan.Query, "plan", plan.Plan)
+
+	q.mu.Lock()
+	q.plans = append(q.plans, plan)
+	q.mu.Unlock()
+}
+
+// guard refuses statements whose planned cost or rows exceed the limits, unless
+// the estimator is forced, in which case it only warns.
+func (q *checkedQuerier) guard(ctx context.Context, name, sql string, args []interface{}) error {
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+
+	var raw []byte
+	if err := q.Querier.QueryRow(ctx, "explain (analyze off, format json) "+sql, args...).Scan(&raw); err != nil {
+		return fmt.Errorf("failed to plan %s: %w", name, err)
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil || len(plans) == 0 {
+		return fmt.Errorf("failed to parse plan of %s: %v", name, err)
+	}
+
+	cost, rows := plans[0].Plan.TotalCost, plans[0].Plan.PlanRows
+	if (q.e.MaxCost <= 0 || cost <= q.e.MaxCost) && (q.e.MaxRows <= 0 || rows <= q.e.MaxRows) {
+		return nil
+	}
+
+	err := &CostError{Query: name, Cost: cost, Rows: rows, MaxCost: q.e.MaxCost, MaxRows: q.e.MaxRows}
+	if q.e.Force {
+		level.Warn(q.e.logger()).Log("event", "expensive_query", "query", name, "cost", cost, "rows", rows)
+		return nil
+	}
+
+	return err
+}
+
+// errRow is a pgx.Row that fails to scan, for statements we refused to run.
+type errRow struct{ err error }
+
+func (r errRow) Scan(...interface{}) error { return r.err }
@@ -0,0 +1,55 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Extent finds the first and last rows of table with a time, between which
+// estimates can be made. Rows are taken in id order when ids are sequential,
+// and in time order otherwise.
+func (e *Estimator) Extent(ctx context.Context, conn Querier, table string) (first, last Row, err error) {
+	rel, err := e.Relation(table)
+	if err != nil {
+		return first, last, err
+	}
+	if err := e.validateRelation(ctx, conn, rel); err != nil {
+		return first, last, err
+	}
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return first, last, err
+	}
+
+	data := rel.queryData()
+	if !inspection.SequentialID {
+		data = data.orderedByTime()
+	}
+
+	for _, query := range []struct {
+		name, src string
+		row       *Row
+	}{
+		{"selectFirstRow", selectFirstRow, &first},
+		{"selectLastRow", selectLastRow, &last},
+	} {
+		sql, err := renderSQL(query.name, query.src, data)
+		if err != nil {
+			return first, last, err
+		}
+
+		err = conn.QueryRow(ctx, sql).Scan(&query.row.ID, &query.row.CreatedAt, &query.row.XMin)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return first, last, fmt.Errorf("table is empty or has no rows with a %s: %w", rel.TimeColumn, ErrNullTimes)
+		case err != nil:
+			return first, last, fmt.Errorf("failed to find extent of table: %w", err)
+		}
+	}
+
+	return first, last, nil
+}
@@ -0,0 +1,125 @@
+package xidfortime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFilter is returned for filters that could escape the condition
+// they're placed in.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// sqlFilter is a boolean expression restricting the rows probed, checked by
+// parseFilter to stay within the parentheses it's placed in.
+type sqlFilter string
+
+// filterKeywords may be followed by parentheses without calling a function.
+var filterKeywords = map[string]bool{
+	"all": true, "and": true, "any": true, "between": true, "else": true,
+	"ilike": true, "in": true, "is": true, "like": true, "not": true,
+	"or": true, "similar": true, "some": true, "then": true, "to": true,
+	"when": true,
+}
+
+// filterFunctions are the only functions filters may call, which read nothing
+// but their arguments and return straight away.
+var filterFunctions = map[string]bool{
+	"abs": true, "btrim": true, "cast": true, "char_length": true,
+	"coalesce": true, "date_part": true, "date_trunc": true, "extract": true,
+	"greatest": true, "least": true, "length": true, "lower": true,
+	"ltrim": true, "nullif": true, "octet_length": true, "position": true,
+	"round": true, "rtrim": true, "substring": true, "to_timestamp": true,
+	"trim": true, "upper": true,
+}
+
+// filterSubqueries are the keywords that start a query, which filters may
+// not contain.
+var filterSubqueries = map[string]bool{
+	"select": true, "table": true, "values": true, "with": true,
+}
+
+// parseFilter checks a filter is a single expression of the table's columns,
+// rejecting statement separators, comments, parameters, backslash escapes,
+// subqueries and calls to functions not in filterFunctions, and parentheses or
+// quotes left unbalanced. The query it's placed in checks it's a boolean
+// expression over the table's columns.
+func parseFilter(s string) (sqlFilter, error) {
+	s = strings.TrimSpace(s)
+
+	var (
+		quote  rune   // the quote we're inside, if any
+		word   []rune // the identifier or keyword being read
+		callee string // the word before any opening parenthesis
+		depth  int
+	)
+	runes := []rune(s)
+	for idx := 0; idx < len(runes); idx++ {
+		r, next := runes[idx], rune(0)
+		if idx+1 < len(runes) {
+			next = runes[idx+1]
+		}
+
+		switch {
+		case quote != 0 && r == quote:
+			if next == quote {
+				idx++
+				continue
+			}
+
+			// Quoted identifiers could name any function
+			if quote == '"' {
+				callee = `"`
+			}
+			quote = 0
+			continue
+		case quote == '\'' && r == '\\':
+			return "", fmt.Errorf("%w %q: backslash escapes aren't supported", ErrInvalidFilter, s)
+		case quote != 0:
+			continue
+		case isFilterWordRune(r):
+			word = append(word, r)
+			if isFilterWordRune(next) {
+				continue
+			}
+
+			callee, word = strings.ToLower(string(word)), nil
+			if filterSubqueries[callee] {
+				return "", fmt.Errorf("%w %q: subqueries aren't supported", ErrInvalidFilter, s)
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			if callee != "" && !unicode.IsDigit([]rune(callee)[0]) && !filterKeywords[callee] && !filterFunctions[callee] {
+				return "", fmt.Errorf("%w %q: calling %s isn't supported", ErrInvalidFilter, s, strings.Trim(callee, `"`))
+			}
+			depth++
+		case r == ')':
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("%w %q: unbalanced parentheses", ErrInvalidFilter, s)
+			}
+		case r == ';', r == '$', r == '\\',
+			r == '-' && next == '-', r == '/' && next == '*':
+			return "", fmt.Errorf("%w %q: unexpected %q", ErrInvalidFilter, s, r)
+		case unicode.IsSpace(r):
+			continue
+		}
+
+		callee = ""
+	}
+
+	switch {
+	case quote != 0:
+		return "", fmt.Errorf("%w %q: unterminated quote", ErrInvalidFilter, s)
+	case depth != 0:
+		return "", fmt.Errorf("%w %q: unbalanced parentheses", ErrInvalidFilter, s)
+	}
+
+	return sqlFilter(s), nil
+}
+
+func isFilterWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,60 @@
+package xidfortime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, tc := range []struct {
+		filter string
+		want   sqlFilter
+		valid  bool
+	}{
+		{filter: "tenant_id = 42", want: "tenant_id = 42", valid: true},
+		{filter: "  status = 'paid'  ", want: "status = 'paid'", valid: true},
+		{filter: "(a or b) and not (c)", want: "(a or b) and not (c)", valid: true},
+		{filter: "note = 'a; b -- /* $1'", want: "note = 'a; b -- /* $1'", valid: true},
+		{filter: "note = 'it''s'", want: "note = 'it''s'", valid: true},
+		{filter: `"odd""name" = 1`, want: `"odd""name" = 1`, valid: true},
+		{filter: `"semi;colon" = 'x'`, want: `"semi;colon" = 'x'`, valid: true},
+		{filter: "amount - 1 > 0", want: "amount - 1 > 0", valid: true},
+		{filter: "lower(email) = 'a'", want: "lower(email) = 'a'", valid: true},
+		{filter: "coalesce (amount, 0) > 1", want: "coalesce (amount, 0) > 1", valid: true},
+		{filter: "tenant_id in (1, 2)", want: "tenant_id in (1, 2)", valid: true},
+		{filter: "status = 'select pg_sleep(1)'", want: "status = 'select pg_sleep(1)'", valid: true},
+		{filter: `"select" = 1`, want: `"select" = 1`, valid: true},
+		{filter: "selected and pg_catalog.lower(x) = 'a'", want: "selected and pg_catalog.lower(x) = 'a'", valid: true},
+		{filter: "true) or (true"},
+		{filter: "(true"},
+		{filter: "a; drop table events"},
+		{filter: "true -- comment"},
+		{filter: "true /* comment */"},
+		{filter: "id = $1"},
+		{filter: "note = $$x$$"},
+		{filter: `note = E'\''`},
+		{filter: `note = '\'`},
+		{filter: "note = 'unterminated"},
+		{filter: `"unterminated = 1`},
+		{filter: "note = 'it'';drop"},
+		{filter: `"odd"" = 1`},
+		{filter: "(select pg_sleep(1e6)) is null"},
+		{filter: "exists (select 1)"},
+		{filter: "id in (table other)"},
+		{filter: "id in (values (1))"},
+		{filter: "pg_read_file('/etc/passwd') is not null"},
+		{filter: "pg_catalog.pg_sleep (1) is null"},
+		{filter: `"pg_sleep"(1) is null`},
+		{filter: "PG_SLEEP(1) is null"},
+	} {
+		got, err := parseFilter(tc.filter)
+		switch {
+		case tc.valid && err != nil:
+			t.Errorf("parseFilter(%q) returned error: %v", tc.filter, err)
+		case tc.valid && got != tc.want:
+			t.Errorf("parseFilter(%q) = %q, want %q", tc.filter, got, tc.want)
+		case !tc.valid && !errors.Is(err, ErrInvalidFilter):
+			t.Errorf("parseFilter(%q) = %q, %v, want ErrInvalidFilter", tc.filter, got, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// maxFrozenWalk is how many rows we walk back past frozen tuples before giving
+// up on finding a real xid.
+const maxFrozenWalk = 100000
+
+// isSpecialXID reports whether xid is one of the invalid, bootstrap or frozen
+// transaction ids, which tell us nothing about when the row was inserted.
+func isSpecialXID(xid string) bool {
+	parsed, err := parseXID(xid)
+	return err == nil && parsed < 3
+}
+
+// skipFrozen replaces a Before row whose xmin is frozen with the nearest
+// preceding row, in insertion order, that carries a real xid. Old tables are
+// often frozen right up to the threshold, so this can walk some way.
+func (e *Estimator) skipFrozen(ctx context.Context, conn Querier, rel Relation, result Result) (Result, error) {
+	if !isSpecialXID(result.Before.XMin) {
+		return result, nil
+	}
+
+	data, key, err := e.rowOrder(ctx, conn, rel)
+	if err != nil {
+		return result, err
+	}
+
+	sql, err := renderSQL("selectBeforeUnfrozen", selectBeforeUnfrozen, data)
+	if err != nil {
+		return result, err
+	}
+
+	var (
+		before Row
+		walked int
+	)
+	err = conn.QueryRow(ctx, sql, key(result.Before), maxFrozenWalk).
+		Scan(&before.ID, &before.CreatedAt, &before.XMin, &walked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, fmt.Errorf("the %d rows before %s all have frozen xmins, try the commit-timestamp strategy",
+			maxFrozenWalk, result.Before.ID)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to walk back past frozen rows: %w", err)
+	}
+
+	level.Info(e.logger()).Log("event", "skipped_frozen_rows", "frozen_id", result.Before.ID,
+		"frozen_xmin", result.Before.XMin, "before_id", before.ID, "before_xmin", before.XMin,
+		"walked", walked, "before_by", result.TargetTime.Sub(before.CreatedAt))
+
+	result.Before, result.FrozenSkipped = before, walked
+	return result, nil
+}
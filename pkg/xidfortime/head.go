@@ -0,0 +1,68 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// beyondHead returns the newest row of the table if it was inserted at or
+// before t, in which case no row follows the target for any strategy to find.
+// Tables whose ids aren't sequential can only find their newest row by time,
+// so are skipped unless the time column has a btree index to read it from.
+func (e *Estimator) beyondHead(ctx context.Context, conn Querier, rel Relation, t time.Time) (*Row, error) {
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	data := rel.queryData()
+	if !inspection.SequentialID {
+		if !inspection.TimeIndexMethods["btree"] {
+			return nil, nil
+		}
+		data = data.orderedByTime()
+	}
+
+	sql, err := renderSQL("selectLastRow", selectLastRow, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var last Row
+	err = conn.QueryRow(ctx, sql).Scan(&last.ID, &last.CreatedAt, &last.XMin)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, fmt.Errorf("table is empty or has no rows with a %s: %w", rel.TimeColumn, ErrNullTimes)
+	case err != nil:
+		return nil, fmt.Errorf("failed to find newest row: %w", err)
+	case last.CreatedAt.After(t):
+		return nil, nil
+	}
+
+	return &last, nil
+}
+
+// estimateHead answers for a target beyond the newest row with the latest xid
+// assigned, as every transaction before it may have committed by then.
+func (e *Estimator) estimateHead(ctx context.Context, conn Querier, t time.Time, head Row) (Result, error) {
+	result := Result{TargetTime: t, Strategy: StrategyHead, Before: head, BeyondHead: true}
+
+	sql, err := e.serverSQL(ctx, conn, "selectLatestXID", selectLatestXID)
+	if err != nil {
+		return result, err
+	}
+
+	if err := conn.QueryRow(ctx, sql).Scan(&result.CommittedXID); err != nil {
+		return result, fmt.Errorf("failed to read latest xid: %w", err)
+	}
+
+	level.Warn(e.logger()).Log("event", "target_beyond_head", "msg", "target is newer than the newest row, using the latest xid",
+		"head_id", head.ID, "head_created_at", head.CreatedAt, "latest_xid", result.CommittedXID)
+
+	return result, nil
+}
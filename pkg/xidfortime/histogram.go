@@ -0,0 +1,342 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/label"
+)
+
+// ErrNoHistogram is returned by the histogram strategy when pg_stats has no
+// histogram for the id column.
+var ErrNoHistogram = errors.New("no histogram bounds for id column")
+
+// errBeforeBounds is returned by findThresholds when t predates every bound,
+// in which case the first row of the table takes the place of the lower one.
+var errBeforeBounds = errors.New("target time predates every bound")
+
+// estimateByBounds takes a set of rows spread across the table, from which it
+// picks the pair that bracket t, then probes between them for the first row
+// inserted after t. The row preceding that one gives the estimate.
+func (e *Estimator) estimateByBounds(ctx context.Context, conn Querier, rel Relation, t time.Time, strategy string, bounds []Row) (Result, error) {
+	var err error
+	logger := e.logger()
+	result := Result{TargetTime: t, Strategy: strategy}
+	data := rel.queryData()
+
+	err = traced(ctx, "thresholds", func(ctx context.Context) (err error) {
+		result.Thresholds, err = findThresholds(bounds, t)
+		if errors.Is(err, errBeforeBounds) {
+			result.Thresholds, err = e.thresholdsFromFirstRow(ctx, conn, rel, t, bounds[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find thresholds: %w", err)
+		}
+
+		return nil
+	}, label.Int("bounds", len(bounds)))
+	if err != nil {
+		return result, err
+	}
+
+	level.Debug(logger).Log("event", "found_thresholds",
+		"min_id", result.Thresholds.MinID, "min_created_at", result.Thresholds.MinCreatedAt,
+		"max_id", result.Thresholds.MaxID, "max_created_at", result.Thresholds.MaxCreatedAt)
+
+	probe, err := e.routeToPartition(ctx, conn, rel, result.Thresholds)
+	if err != nil {
+		return result, err
+	}
+	data = probe.queryData()
+
+	if e.Refine {
+		err = traced(ctx, "refine", func(ctx context.Context) (err error) {
+			result.Thresholds, err = e.refineThresholds(ctx, conn, probe, t, result.Thresholds)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = traced(ctx, "past_threshold", func(ctx context.Context) error {
+		sql, err := renderSQL("selectPastThreshold", selectPastThreshold, data)
+		if err != nil {
+			return err
+		}
+
+		if err = conn.QueryRow(ctx, sql, result.Thresholds.MinID, result.Thresholds.MaxID, t).
+			Scan(&result.Exceeded.ID, &result.Exceeded.CreatedAt, &result.Exceeded.XMin); err != nil {
+			return fmt.Errorf("failed to find first row past threshold: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	level.Debug(logger).Log("event", "first_past_threshold",
+		"exceeded_id", result.Exceeded.ID,
+		"exceeded_created_at", result.Exceeded.CreatedAt,
+		"exceeded_xmin", result.Exceeded.XMin,
+		"exceeded_by", result.ExceededBy())
+
+	err = traced(ctx, "before_threshold", func(ctx context.Context) error {
+		sql, err := renderSQL("selectBeforeThreshold", selectBeforeThreshold, data)
+		if err != nil {
+			return err
+		}
+
+		if err = conn.QueryRow(ctx, sql, result.Exceeded.ID).
+			Scan(&result.Before.ID, &result.Before.CreatedAt, &result.Before.XMin, &result.NullSkipped); err != nil {
+			return fmt.Errorf("failed to find first row before threshold: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	level.Debug(logger).Log("event", "first_before_threshold",
+		"before_id", result.Before.ID,
+		"before_created_at", result.Before.CreatedAt,
+		"before_xmin", result.Before.XMin,
+		"before_by", result.BeforeBy())
+
+	if result.NullSkipped > 0 {
+		level.Warn(logger).Log("event", "skipped_null_times", "count", result.NullSkipped,
+			"before_id", result.Before.ID, "exceeded_id", result.Exceeded.ID)
+	}
+
+	return result, nil
+}
+
+// histogramBounds looks up the created_at and xmin of every histogram bound on
+// the id column, spreading lookups across e.Concurrency workers.
+func (e *Estimator) histogramBounds(ctx context.Context, conn Querier, rel Relation) ([]Row, error) {
+	return e.Cache.cachedBounds(boundsKey{rel: rel, strategy: StrategyHistogram}, func() (bounds []Row, err error) {
+		err = traced(ctx, "histogram_bounds", func(ctx context.Context) (err error) {
+			bounds, err = e.fetchHistogramBounds(ctx, conn, rel)
+			return err
+		})
+
+		return bounds, err
+	})
+}
+
+func (e *Estimator) fetchHistogramBounds(ctx context.Context, conn Querier, rel Relation) ([]Row, error) {
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if inspection.Partitioned {
+		if ids, err = e.partitionHistogramBounds(ctx, conn, rel, inspection.Partitions); err != nil {
+			return nil, err
+		}
+	} else {
+		sql, err := renderSQL("selectHistogramBounds", selectHistogramBounds, rel.queryData())
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.QueryRow(ctx, sql, rel.schemaArg(), rel.Table, rel.IDColumn).Scan(&ids)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to read histogram bounds: %w", err)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoHistogram
+	}
+
+	level.Debug(e.logger()).Log("event", "found_histogram_bounds", "count", len(ids))
+
+	bounds, nulls, err := e.lookupBounds(ctx, conn, rel, ids)
+	if err != nil {
+		return nil, err
+	}
+	if nulls > 0 {
+		level.Debug(e.logger()).Log("event", "skipped_null_bounds", "count", nulls)
+	}
+	if len(bounds) == 0 && nulls > 0 {
+		return nil, fmt.Errorf("every histogram bound has a null %s: %w", rel.TimeColumn, ErrNullTimes)
+	}
+
+	return bounds, nil
+}
+
+// findThresholds picks the pair of bounds adjacent in time that bracket t.
+func findThresholds(bounds []Row, t time.Time) (Thresholds, error) {
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i].CreatedAt.Before(bounds[j].CreatedAt)
+	})
+
+	// Find the newest bound before t, and the bound that follows it
+	idx := sort.Search(len(bounds), func(i int) bool {
+		return !bounds[i].CreatedAt.Before(t)
+	}) - 1
+	switch {
+	case len(bounds) == 0:
+		return Thresholds{}, fmt.Errorf("no bounds to bracket target time %s", t)
+	case idx < 0:
+		return Thresholds{}, errBeforeBounds
+	case idx+1 >= len(bounds):
+		return Thresholds{}, fmt.Errorf("no bounds bracket target time %s: %w", t, ErrOutOfRange)
+	}
+
+	thresholds := Thresholds{
+		MinID: bounds[idx].ID, MinCreatedAt: bounds[idx].CreatedAt,
+		MaxID: bounds[idx+1].ID, MaxCreatedAt: bounds[idx+1].CreatedAt,
+	}
+	if bounds[idx].Partition == bounds[idx+1].Partition {
+		thresholds.Partition = bounds[idx].Partition
+	}
+
+	return thresholds, nil
+}
+
+// thresholdsFromFirstRow brackets a target time older than every bound between
+// the first row of the table and the oldest bound, failing with ErrOutOfRange
+// if even the first row was inserted after it.
+func (e *Estimator) thresholdsFromFirstRow(ctx context.Context, conn Querier, rel Relation, t time.Time, oldest Row) (Thresholds, error) {
+	sql, err := renderSQL("selectFirstRow", selectFirstRow, rel.queryData())
+	if err != nil {
+		return Thresholds{}, err
+	}
+
+	var first Row
+	if err := conn.QueryRow(ctx, sql).Scan(&first.ID, &first.CreatedAt, &first.XMin); err != nil {
+		return Thresholds{}, fmt.Errorf("failed to find first row: %w", err)
+	}
+	if first.CreatedAt.After(t) {
+		return Thresholds{}, fmt.Errorf("target time %s predates the first row of the table, %s inserted at %s: %w",
+			t, first.ID, first.CreatedAt, ErrOutOfRange)
+	}
+
+	level.Debug(e.logger()).Log("event", "target_predates_bounds", "first_id", first.ID, "first_created_at", first.CreatedAt,
+		"oldest_bound_id", oldest.ID, "oldest_bound_created_at", oldest.CreatedAt)
+
+	return Thresholds{
+		MinID: first.ID, MinCreatedAt: first.CreatedAt,
+		MaxID: oldest.ID, MaxCreatedAt: oldest.CreatedAt,
+	}, nil
+}
+
+// sampleBounds builds approximate bounds from the rows of a TABLESAMPLE, for
+// tables that have never been analyzed or whose id column has no histogram.
+func (e *Estimator) sampleBounds(ctx context.Context, conn Querier, rel Relation) ([]Row, error) {
+	key := boundsKey{rel: rel, strategy: StrategyTableSample, samplePercent: e.samplePercent()}
+	return e.Cache.cachedBounds(key, func() (bounds []Row, err error) {
+		err = traced(ctx, "sample_bounds", func(ctx context.Context) (err error) {
+			bounds, err = e.fetchSampleBounds(ctx, conn, rel)
+			return err
+		})
+
+		return bounds, err
+	})
+}
+
+func (e *Estimator) fetchSampleBounds(ctx context.Context, conn Querier, rel Relation) ([]Row, error) {
+	sql, err := renderSQL("selectSampleBounds", selectSampleBounds, rel.queryData())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ids        []string
+		createdAts []time.Time
+		xmins      []string
+	)
+	if err := conn.QueryRow(ctx, sql, e.samplePercent()).Scan(&ids, &createdAts, &xmins); err != nil {
+		return nil, fmt.Errorf("failed to sample table: %w", err)
+	}
+
+	level.Debug(e.logger()).Log("event", "sampled_bounds", "count", len(ids))
+
+	bounds := make([]Row, len(ids))
+	for idx := range ids {
+		bounds[idx] = Row{ID: ids[idx], CreatedAt: createdAts[idx], XMin: xmins[idx]}
+	}
+
+	return bounds, nil
+}
+
+// lookupBounds fetches the created_at and xmin of each id, skipping any that no longer
+// exist in the table and counting those whose created_at is null.
+func (e *Estimator) lookupBounds(ctx context.Context, conn Querier, rel Relation, ids []string) ([]Row, int, error) {
+	data := rel.queryData()
+	sql, err := renderSQL("selectBoundCreatedAt", selectBoundCreatedAt, data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		bounds   = make([]Row, 0, len(ids))
+		nulls    int
+		firstErr error
+		queue    = make(chan string)
+	)
+
+	for worker := 0; worker < e.concurrency(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				var (
+					row       = Row{ID: id}
+					createdAt *time.Time
+					partition *string
+				)
+				err := conn.QueryRow(ctx, sql, id, string(data.Table)).Scan(&createdAt, &row.XMin, &partition)
+
+				mu.Lock()
+				switch {
+				case errors.Is(err, pgx.ErrNoRows):
+				case err != nil:
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to look up histogram bound %s: %w", id, err)
+						cancel()
+					}
+				case createdAt == nil:
+					nulls++
+				default:
+					row.CreatedAt = *createdAt
+					if partition != nil {
+						row.Partition = *partition
+					}
+					bounds = append(bounds, row)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		select {
+		case queue <- id:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+
+	return bounds, nulls, ctx.Err()
+}
@@ -0,0 +1,94 @@
+package xidfortime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFindThresholds(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 6, 1, hour, 0, 0, 0, time.UTC)
+	}
+
+	// Bounds come from the histogram in id order, which needn't be time order
+	bounds := func() []Row {
+		return []Row{
+			{ID: "30", CreatedAt: at(12), Partition: "events_2"},
+			{ID: "10", CreatedAt: at(10), Partition: "events_1"},
+			{ID: "20", CreatedAt: at(11), Partition: "events_1"},
+			{ID: "40", CreatedAt: at(13), Partition: "events_2"},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		bounds []Row
+		target time.Time
+		want   Thresholds
+		err    error
+	}{
+		{
+			name:   "between bounds",
+			bounds: bounds(),
+			target: at(11).Add(30 * time.Minute),
+			want: Thresholds{
+				MinID: "20", MinCreatedAt: at(11), MaxID: "30", MaxCreatedAt: at(12),
+			},
+		},
+		{
+			name:   "within a partition",
+			bounds: bounds(),
+			target: at(10).Add(time.Minute),
+			want: Thresholds{
+				MinID: "10", MinCreatedAt: at(10), MaxID: "20", MaxCreatedAt: at(11), Partition: "events_1",
+			},
+		},
+		{
+			name:   "at a bound",
+			bounds: bounds(),
+			target: at(12),
+			want: Thresholds{
+				MinID: "20", MinCreatedAt: at(11), MaxID: "30", MaxCreatedAt: at(12),
+			},
+		},
+		{
+			name:   "before every bound",
+			bounds: bounds(),
+			target: at(9),
+			err:    errBeforeBounds,
+		},
+		{
+			name:   "at the oldest bound",
+			bounds: bounds(),
+			target: at(10),
+			err:    errBeforeBounds,
+		},
+		{
+			name:   "after every bound",
+			bounds: bounds(),
+			target: at(14),
+			err:    ErrOutOfRange,
+		},
+		{
+			name:   "single bound",
+			bounds: []Row{{ID: "10", CreatedAt: at(10)}},
+			target: at(11),
+			err:    ErrOutOfRange,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := findThresholds(tc.bounds, tc.target)
+			switch {
+			case !errors.Is(err, tc.err):
+				t.Fatalf("findThresholds returned error %v, want %v", err, tc.err)
+			case got != tc.want:
+				t.Fatalf("findThresholds = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := findThresholds(nil, at(10)); err == nil {
+		t.Errorf("findThresholds found thresholds without any bounds")
+	}
+}
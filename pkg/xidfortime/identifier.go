@@ -0,0 +1,97 @@
+package xidfortime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ParseIdentifier parses a possibly schema-qualified identifier such as
+// analytics."Events". Unquoted parts are folded to lower case, matching how
+// Postgres resolves them.
+func ParseIdentifier(s string) (pgx.Identifier, error) {
+	var (
+		ident  pgx.Identifier
+		part   strings.Builder
+		quoted bool // currently inside double quotes
+		closed bool // the current part was quoted and has been closed
+	)
+
+	flush := func() error {
+		if part.Len() == 0 {
+			return fmt.Errorf("invalid identifier %q: empty name", s)
+		}
+		ident = append(ident, part.String())
+		part.Reset()
+		closed = false
+		return nil
+	}
+
+	runes := []rune(s)
+	for idx := 0; idx < len(runes); idx++ {
+		r := runes[idx]
+		switch {
+		case quoted && r == '"':
+			if idx+1 < len(runes) && runes[idx+1] == '"' {
+				part.WriteRune('"')
+				idx++
+				continue
+			}
+			quoted, closed = false, true
+		case quoted:
+			part.WriteRune(r)
+		case r == '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case closed:
+			return nil, fmt.Errorf("invalid identifier %q: unexpected %q after quoted name", s, r)
+		case r == '"':
+			if part.Len() > 0 {
+				return nil, fmt.Errorf("invalid identifier %q: unexpected quote", s)
+			}
+			quoted = true
+		default:
+			part.WriteString(strings.ToLower(string(r)))
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("invalid identifier %q: unterminated quote", s)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(ident) > 2 {
+		return nil, fmt.Errorf("invalid identifier %q: expected [schema.]name", s)
+	}
+
+	return ident, nil
+}
+
+// parseColumn parses an unqualified column identifier.
+func parseColumn(s string) (string, error) {
+	ident, err := ParseIdentifier(s)
+	if err != nil {
+		return "", err
+	}
+	if len(ident) != 1 {
+		return "", fmt.Errorf("invalid column %q: must not be qualified", s)
+	}
+
+	return ident[0], nil
+}
+
+// parseSchema parses an unqualified schema identifier.
+func parseSchema(s string) (string, error) {
+	ident, err := ParseIdentifier(s)
+	if err != nil {
+		return "", err
+	}
+	if len(ident) != 1 {
+		return "", fmt.Errorf("invalid schema %q: must not be qualified", s)
+	}
+
+	return ident[0], nil
+}
@@ -0,0 +1,102 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// timestampedIDDefaults are the functions generating UUIDv7s or ULIDs, whose
+// keys lead with the millisecond they were created.
+var timestampedIDDefaults = []string{"uuidv7(", "uuid_generate_v7(", "ulid("}
+
+// timestampedID reports whether the id column default embeds a timestamp.
+func timestampedID(idDefault string) bool {
+	for _, fn := range timestampedIDDefaults {
+		if strings.Contains(idDefault, fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// crockford is the base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// keyAfter returns the smallest key created after the millisecond of t, so
+// every key below it was created at or before t. Uuid columns use the UUIDv7
+// layout, which ULIDs stored as uuids share, and textual ids that of a
+// canonical upper case ULID.
+func keyAfter(idType string, t time.Time) string {
+	ms := uint64(t.UnixNano()/int64(time.Millisecond)) + 1
+
+	if idType == "uuid" {
+		prefix := fmt.Sprintf("%012x", ms&(1<<48-1))
+		return prefix[:8] + "-" + prefix[8:] + "-0000-0000-000000000000"
+	}
+
+	key := make([]byte, 10)
+	for idx := len(key) - 1; idx >= 0; idx-- {
+		key[idx] = crockford[ms&31]
+		ms >>= 5
+	}
+
+	return string(key) + strings.Repeat("0", 16)
+}
+
+// estimateByKeyTimestamp locates the boundary row directly from the timestamp
+// embedded in each key, reading the first row keyed after t and the row before
+// it from the primary key index. This needs no statistics at all, but is only
+// as precise as the keys' clock, to the millisecond.
+func (e *Estimator) estimateByKeyTimestamp(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	logger := e.logger()
+	result := Result{TargetTime: t, Strategy: StrategyKeyTimestamp}
+	data := rel.queryData()
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return result, err
+	}
+
+	key := keyAfter(inspection.IDType, t)
+	{
+		sql, err := renderSQL("selectAtOrAfterKey", selectAtOrAfterKey, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, key).Scan(&result.Exceeded.ID, &result.Exceeded.CreatedAt, &result.Exceeded.XMin); err != nil {
+			return result, fmt.Errorf("failed to find first row keyed after target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_past_threshold", "key", key,
+		"exceeded_id", result.Exceeded.ID,
+		"exceeded_created_at", result.Exceeded.CreatedAt,
+		"exceeded_xmin", result.Exceeded.XMin,
+		"exceeded_by", result.ExceededBy())
+
+	{
+		sql, err := renderSQL("selectBeforeThreshold", selectBeforeThreshold, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, result.Exceeded.ID).
+			Scan(&result.Before.ID, &result.Before.CreatedAt, &result.Before.XMin, &result.NullSkipped); err != nil {
+			return result, fmt.Errorf("failed to find last row keyed before target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_before_threshold",
+		"before_id", result.Before.ID,
+		"before_created_at", result.Before.CreatedAt,
+		"before_xmin", result.Before.XMin,
+		"before_by", result.BeforeBy())
+
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package xidfortime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyAfter(t *testing.T) {
+	// The millisecond of the ULID spec's example, 01ARZ3NDEKTSV4RRFFQ69G5FAV
+	ms := time.Unix(0, 1469922850259*int64(time.Millisecond))
+
+	for _, tc := range []struct {
+		name   string
+		idType string
+		t      time.Time
+		want   string
+	}{
+		{name: "ulid", idType: "text", t: ms, want: "01ARZ3NDEM0000000000000000"},
+		{name: "ulid within the millisecond", idType: "text", t: ms.Add(999 * time.Microsecond), want: "01ARZ3NDEM0000000000000000"},
+		{name: "ulid at the epoch", idType: "text", t: time.Unix(0, 0), want: "00000000010000000000000000"},
+		{name: "uuid", idType: "uuid", t: ms, want: "01563e3a-b5d4-0000-0000-000000000000"},
+		{name: "uuid within the millisecond", idType: "uuid", t: ms.Add(999 * time.Microsecond), want: "01563e3a-b5d4-0000-0000-000000000000"},
+		{name: "uuid at the epoch", idType: "uuid", t: time.Unix(0, 0), want: "00000000-0001-0000-0000-000000000000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := keyAfter(tc.idType, tc.t); got != tc.want {
+				t.Errorf("keyAfter(%q, %s) = %s, want %s", tc.idType, tc.t, got, tc.want)
+			}
+		})
+	}
+
+	// Keys from the millisecond of t sort before the key after it
+	if key := keyAfter("text", ms); "01ARZ3NDEKTSV4RRFFQ69G5FAV" >= key {
+		t.Errorf("keyAfter(%s) = %s, which sorts before a key from that millisecond", ms, key)
+	}
+}
+
+func TestTimestampedID(t *testing.T) {
+	for idDefault, want := range map[string]bool{
+		"uuidv7()":                  true,
+		"public.uuid_generate_v7()": true,
+		"ulid()":                    true,
+		"gen_random_uuid()":         false,
+		"nextval('events_id_seq')":  false,
+		"":                          false,
+	} {
+		if got := timestampedID(idDefault); got != want {
+			t.Errorf("timestampedID(%q) = %v, want %v", idDefault, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// leafPartitions lists the leaf partitions of a partitioned table, at any
+// depth, as regclass names.
+func (e *Estimator) leafPartitions(ctx context.Context, conn Querier, rel Relation) ([]string, error) {
+	var partitions []string
+	if err := conn.QueryRow(ctx, selectLeafPartitions, rel.queryData().Table).Scan(&partitions); err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	return partitions, nil
+}
+
+// rangePartitionKey is the column a table is range partitioned by, if it is
+// partitioned by a single column.
+func (e *Estimator) rangePartitionKey(ctx context.Context, conn Querier, rel Relation) (string, error) {
+	var key string
+	if err := conn.QueryRow(ctx, selectRangePartitionKey, rel.queryData().Table).Scan(&key); err != nil {
+		return "", fmt.Errorf("failed to read partition key: %w", err)
+	}
+
+	return key, nil
+}
+
+// PartitionRange is a partition holding the rows from From, inclusive, up to
+// To. Either is nil when the range is unbounded.
+type PartitionRange struct {
+	Partition string
+	From, To  *time.Time
+}
+
+// Contains reports whether a row inserted at t belongs in the partition.
+func (r PartitionRange) Contains(t time.Time) bool {
+	return (r.From == nil || !t.Before(*r.From)) && (r.To == nil || t.Before(*r.To))
+}
+
+// partitionRanges reads the bounds of each partition of a table that is range
+// partitioned by time, ignoring any default partition.
+func (e *Estimator) partitionRanges(ctx context.Context, conn Querier, rel Relation) ([]PartitionRange, error) {
+	rows, err := conn.Query(ctx, selectPartitionRanges, rel.queryData().Table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partition bounds: %w", err)
+	}
+	defer rows.Close()
+
+	var ranges []PartitionRange
+	for rows.Next() {
+		var r PartitionRange
+		if err := rows.Scan(&r.Partition, &r.From, &r.To); err != nil {
+			return nil, fmt.Errorf("failed to read partition bounds: %w", err)
+		}
+		ranges = append(ranges, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read partition bounds: %w", err)
+	}
+
+	return ranges, nil
+}
+
+// timePartition finds the partition whose bounds contain t, for tables range
+// partitioned by time and the chunks of hypertables. Its bounds are free thresholds, so the estimate can
+// jump straight to it without reading any statistics of the parent.
+func (e *Estimator) timePartition(ctx context.Context, conn Querier, rel Relation, t time.Time) (Relation, bool, error) {
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return rel, false, err
+	}
+
+	for _, r := range inspection.PartitionRanges {
+		if r.Contains(t) {
+			level.Debug(e.logger()).Log("event", "found_time_partition", "partition", r.Partition,
+				"from", r.From, "to", r.To)
+
+			partition, err := partitionRelation(rel, r.Partition)
+			return partition, err == nil, err
+		}
+	}
+
+	return rel, false, nil
+}
+
+// partitionHistogramBounds reads the histogram bounds of the id column from
+// every leaf partition. Postgres only analyzes the partitions themselves, so
+// their histograms together take the place of one for the parent.
+func (e *Estimator) partitionHistogramBounds(ctx context.Context, conn Querier, rel Relation, partitions []string) ([]string, error) {
+	var ids []string
+	if err := conn.QueryRow(ctx, selectPartitionHistogramBounds, partitions, rel.IDColumn).Scan(&ids); err != nil {
+		return nil, fmt.Errorf("failed to read partition histogram bounds: %w", err)
+	}
+
+	level.Debug(e.logger()).Log("event", "found_partition_histograms", "partitions", len(partitions), "bounds", len(ids))
+	return ids, nil
+}
+
+// routeToPartition returns rel for the partition both thresholds are in, if
+// the table is range partitioned by id or time, as then every row between the
+// thresholds is in that partition too. Otherwise it returns rel.
+func (e *Estimator) routeToPartition(ctx context.Context, conn Querier, rel Relation, thresholds Thresholds) (Relation, error) {
+	if thresholds.Partition == "" {
+		return rel, nil
+	}
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return rel, err
+	}
+	if inspection.PartitionKey != rel.IDColumn && inspection.PartitionKey != rel.TimeColumn {
+		return rel, nil
+	}
+
+	level.Debug(e.logger()).Log("event", "routed_to_partition", "partition", thresholds.Partition,
+		"partition_key", inspection.PartitionKey)
+
+	return partitionRelation(rel, thresholds.Partition)
+}
+
+// partitionRelation is rel with its table replaced by one of its partitions,
+// so probes within that partition skip the others entirely.
+func partitionRelation(rel Relation, partition string) (Relation, error) {
+	ident, err := ParseIdentifier(partition)
+	if err != nil {
+		return rel, err
+	}
+
+	rel.Schema, rel.Table = "", ident[len(ident)-1]
+	if len(ident) == 2 {
+		rel.Schema = ident[0]
+	}
+
+	return rel, nil
+}
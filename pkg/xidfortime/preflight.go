@@ -0,0 +1,186 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Statuses of a preflight check, from best to worst.
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// Check is the outcome of one preflight check. Failures stop estimates from
+// working at all, while warnings make them slower or less accurate.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Failed is whether any check failed.
+func Failed(checks []Check) bool {
+	for _, check := range checks {
+		if check.Status == CheckFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Preflight checks whether table is set up for estimates, reporting what would
+// otherwise surface as a failed or inaccurate estimate: missing permissions and
+// statistics, missing indexes, heavy updates, poor correlation and stale
+// statistics, and what the server supports. Checks that depend on an earlier
+// failure are skipped, so the report ends at the first failure.
+func (e *Estimator) Preflight(ctx context.Context, conn Querier, table string) ([]Check, error) {
+	var checks []Check
+	report := func(name, status, detail string, args ...interface{}) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	server, err := DetectServer(ctx, conn)
+	switch {
+	case server.Version > 0 && server.Version < MinServerVersion:
+		report("server", CheckFail, "%v", err)
+		return checks, nil
+	case err != nil:
+		return checks, err
+	}
+	report("server", CheckPass, "server_version_num %d, xid8 %t, pg_walinspect %t", server.Version, server.XID8(), server.WALInspectRecords())
+
+	rel, err := e.Relation(table)
+	if err != nil {
+		return checks, err
+	}
+	err = checkRelation(ctx, conn, rel)
+	switch {
+	case errors.Is(err, ErrRelationNotFound):
+		report("table", CheckFail, "%v", err)
+		return checks, nil
+	case err != nil:
+		return checks, err
+	}
+	report("table", CheckPass, "%s has columns %s and %s", rel.queryData().Table, rel.IDColumn, rel.TimeColumn)
+
+	var selectable, statsVisible bool
+	if err := conn.QueryRow(ctx, selectPrivileges, string(rel.queryData().Table), rel.IDColumn).Scan(&selectable, &statsVisible); err != nil {
+		return checks, fmt.Errorf("failed to check privileges: %w", err)
+	}
+	if !selectable {
+		report("select_permission", CheckFail, "the current user has no select privilege on the table")
+		return checks, nil
+	}
+	report("select_permission", CheckPass, "can select from the table")
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return checks, err
+	}
+
+	switch {
+	case !statsVisible:
+		report("statistics_visible", CheckWarn, "pg_stats hides the statistics of %s, as row level security is active on the table", rel.IDColumn)
+	default:
+		report("statistics_visible", CheckPass, "pg_stats shows the statistics of %s", rel.IDColumn)
+	}
+
+	switch {
+	case inspection.HasHistogram:
+		report("histogram", CheckPass, "%s has histogram bounds", rel.IDColumn)
+	case statsVisible:
+		report("histogram", CheckWarn, "%s has no histogram bounds, so estimates need an index on %s or fall back to sampling, analyze the table to fix", rel.IDColumn, rel.TimeColumn)
+	default:
+		report("histogram", CheckWarn, "%s has no visible histogram bounds, so estimates need an index on %s or fall back to sampling", rel.IDColumn, rel.TimeColumn)
+	}
+
+	idMethods, err := indexMethods(ctx, conn, rel, rel.IDColumn)
+	if err != nil {
+		return checks, err
+	}
+	switch {
+	case idMethods["btree"]:
+		report("id_index", CheckPass, "%s has a btree index", rel.IDColumn)
+	default:
+		report("id_index", CheckWarn, "%s has no btree index, so each probe by id scans the table", rel.IDColumn)
+	}
+
+	switch {
+	case inspection.TimeIndexMethods["btree"]:
+		report("time_index", CheckPass, "%s has a btree index, so estimates read it directly", rel.TimeColumn)
+	case len(inspection.TimeIndexMethods) > 0:
+		report("time_index", CheckPass, "%s has a %s index", rel.TimeColumn, joinMethods(inspection.TimeIndexMethods))
+	default:
+		report("time_index", CheckWarn, "%s has no index, so estimates rely on statistics of %s", rel.TimeColumn, rel.IDColumn)
+	}
+
+	switch {
+	case inspection.SequentialID:
+		report("id_order", CheckPass, "%s is a %s assigned in insertion order", rel.IDColumn, inspection.IDType)
+	default:
+		report("id_order", CheckWarn, "%s is a %s not known to be assigned in insertion order, so only strategies reading by time are used", rel.IDColumn, inspection.IDType)
+	}
+
+	inserts, updates, err := updateStats(ctx, conn, rel)
+	if err != nil {
+		return checks, err
+	}
+	switch threshold := e.updateRatio(); {
+	case inserts == 0:
+		report("update_ratio", CheckPass, "no inserts counted by pg_stat_user_tables")
+	case float64(updates)/float64(inserts) > threshold:
+		report("update_ratio", CheckWarn, "%d updates to %d inserts is above %.2f, so xmins may reflect updates rather than inserts", updates, inserts, threshold)
+	default:
+		report("update_ratio", CheckPass, "%d updates to %d inserts", updates, inserts)
+	}
+
+	switch threshold := e.minCorrelation(); {
+	case inspection.IDCorrelation == nil:
+		report("correlation", CheckWarn, "pg_stats has no correlation for %s", rel.IDColumn)
+	case *inspection.IDCorrelation < threshold:
+		report("correlation", CheckWarn, "%s correlation of %.2f is below %.2f, so id order may not follow insertion time", rel.IDColumn, *inspection.IDCorrelation, threshold)
+	default:
+		report("correlation", CheckPass, "%s correlation of %.2f", rel.IDColumn, *inspection.IDCorrelation)
+	}
+
+	analyzed, never, err := lastAnalyzed(ctx, conn, rel, inspection)
+	if err != nil {
+		return checks, err
+	}
+	switch maxAge := e.maxAnalyzeAge(); {
+	case never > 0:
+		report("analyzed", CheckWarn, "%d tables have never been analyzed", never)
+	case analyzed != nil && time.Since(*analyzed) > maxAge:
+		report("analyzed", CheckWarn, "last analyzed %s ago, more than %s", time.Since(*analyzed).Round(time.Second), maxAge)
+	case analyzed != nil:
+		report("analyzed", CheckPass, "last analyzed %s ago", time.Since(*analyzed).Round(time.Second))
+	default:
+		report("analyzed", CheckPass, "statistics are not tracked for the table")
+	}
+
+	switch {
+	case inspection.TrackCommitTimestamp:
+		report("commit_timestamps", CheckPass, "track_commit_timestamp is on, so estimates are refined to the exact xid")
+	default:
+		report("commit_timestamps", CheckWarn, "track_commit_timestamp is off, so estimates can't be refined or made exact")
+	}
+
+	return checks, nil
+}
+
+func joinMethods(methods map[string]bool) string {
+	names := make([]string, 0, len(methods))
+	for method := range methods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, " and ")
+}
@@ -0,0 +1,74 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrRelationNotFound is wrapped by errors for tables or columns that don't
+// exist, or that we can't see.
+var ErrRelationNotFound = errors.New("table or column not found")
+
+// Queries renders every statement an estimate against table could run, without
+// touching the database, so they can be reviewed before the estimator is
+// granted access.
+func (e *Estimator) Queries(table string) ([]Query, error) {
+	rel, err := e.Relation(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderQueries(rel, e.trackingSchema())
+}
+
+// ValidateRelation checks the table and its id and time columns exist.
+// Estimates do the same before running any statement that names them.
+func (e *Estimator) ValidateRelation(ctx context.Context, conn Querier, table string) error {
+	rel, err := e.Relation(table)
+	if err != nil {
+		return err
+	}
+
+	return e.validateRelation(ctx, conn, rel)
+}
+
+// validateRelation checks rel against the catalog, so a mistyped table or
+// column fails clearly before we interpolate it into anything.
+func (e *Estimator) validateRelation(ctx context.Context, conn Querier, rel Relation) error {
+	return e.Cache.cachedValidation(rel, func() error {
+		return traced(ctx, "validate_relation", func(ctx context.Context) error {
+			return checkRelation(ctx, conn, rel)
+		})
+	})
+}
+
+func checkRelation(ctx context.Context, conn Querier, rel Relation) error {
+	want := 2
+	if rel.IDColumn == rel.TimeColumn {
+		want = 1
+	}
+
+	var found int
+	table := string(rel.queryData().Table)
+	if err := conn.QueryRow(ctx, selectRelationColumns, table, rel.IDColumn, rel.TimeColumn).Scan(&found); err != nil {
+		return fmt.Errorf("failed to validate table: %w", err)
+	}
+	if found < want {
+		return fmt.Errorf("table %s must exist with columns %s and %s: %w", table, rel.IDColumn, rel.TimeColumn, ErrRelationNotFound)
+	}
+
+	if rel.filter != "" {
+		sql, err := renderSQL("selectFilter", selectFilter, rel.queryData())
+		if err != nil {
+			return err
+		}
+		if err := conn.QueryRow(ctx, sql).Scan(); !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w %q: %v", ErrInvalidFilter, rel.filter, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// RangeResult brackets the xids of transactions that committed within a time
+// window, made of the estimates for either end of it.
+type RangeResult struct {
+	From Result `json:"from"`
+	To   Result `json:"to"`
+}
+
+// LowerXID is the last xid to commit before the window opened.
+func (r RangeResult) LowerXID() string {
+	return r.From.XID()
+}
+
+// UpperXID is the last xid to commit before the window closed.
+func (r RangeResult) UpperXID() string {
+	return r.To.XID()
+}
+
+// Transactions estimates how many transactions committed within the window,
+// counting every xid assigned between the two ends. This includes aborted
+// transactions, so is an upper bound.
+func (r RangeResult) Transactions() uint64 {
+	from, err := strconv.ParseUint(r.From.XID8, 10, 64)
+	if err != nil {
+		return 0
+	}
+	to, err := strconv.ParseUint(r.To.XID8, 10, 64)
+	if err != nil || to < from {
+		return 0
+	}
+
+	return to - from
+}
+
+// Duration is how long the window lasted, between the targets estimated for.
+func (r RangeResult) Duration() time.Duration {
+	return r.To.TargetTime.Sub(r.From.TargetTime)
+}
+
+// TransactionRate is the average rate at which xids were assigned across the
+// window, per second, for checking a proposed window against the usual rate.
+func (r RangeResult) TransactionRate() float64 {
+	if r.Duration() <= 0 {
+		return 0
+	}
+
+	return float64(r.Transactions()) / r.Duration().Seconds()
+}
+
+// EstimateRange estimates the xids either side of the window from to, sharing
+// bounds and inspections between the two estimates.
+func (e *Estimator) EstimateRange(ctx context.Context, conn Querier, table string, from, to time.Time) (RangeResult, error) {
+	var result RangeResult
+	if to.Before(from) {
+		return result, fmt.Errorf("window closes at %s before it opens at %s", to, from)
+	}
+
+	ranged := *e
+	if ranged.Cache == nil {
+		ranged.Cache = NewCache()
+	}
+
+	var err error
+	if result.From, err = ranged.EstimateXID(ctx, conn, table, from); err != nil {
+		return result, fmt.Errorf("failed to estimate start of window: %w", err)
+	}
+	if result.To, err = ranged.EstimateXID(ctx, conn, table, to); err != nil {
+		return result, fmt.Errorf("failed to estimate end of window: %w", err)
+	}
+
+	level.Info(e.logger()).Log("event", "estimated_range", "from", from, "to", to,
+		"lower_xid", result.LowerXID(), "upper_xid", result.UpperXID(), "transactions", result.Transactions(),
+		"transactions_per_second", result.TransactionRate())
+
+	return result, nil
+}
@@ -0,0 +1,43 @@
+package xidfortime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRangeResult(t *testing.T) {
+	from := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name         string
+		from, to     string
+		duration     time.Duration
+		transactions uint64
+		rate         float64
+	}{
+		{name: "window", from: "1000", to: "4000", duration: time.Minute, transactions: 3000, rate: 50},
+		{name: "across an epoch", from: "4294967000", to: "4294968296", duration: time.Second, transactions: 1296, rate: 1296},
+		{name: "empty window", from: "1000", to: "1000", duration: time.Minute},
+		{name: "ends out of order", from: "4000", to: "1000", duration: time.Minute},
+		{name: "no xid8", from: "", to: "4000", duration: time.Minute},
+		{name: "no duration", from: "1000", to: "4000", transactions: 3000},
+		{name: "negative duration", from: "1000", to: "4000", duration: -time.Minute, transactions: 3000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := RangeResult{
+				From: Result{TargetTime: from, XID8: tc.from},
+				To:   Result{TargetTime: from.Add(tc.duration), XID8: tc.to},
+			}
+
+			if got := r.Transactions(); got != tc.transactions {
+				t.Errorf("Transactions() = %d, want %d", got, tc.transactions)
+			}
+			if got := r.Duration(); got != tc.duration {
+				t.Errorf("Duration() = %s, want %s", got, tc.duration)
+			}
+			if got := r.TransactionRate(); got != tc.rate {
+				t.Errorf("TransactionRate() = %g, want %g", got, tc.rate)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// maxRefineIterations caps the bisection, which is plenty to exhaust the key
+// space of a bigint or a typical textual id.
+const maxRefineIterations = 128
+
+// refineThresholds narrows the thresholds by bisecting the id range between
+// them, so the probe for the first row past t scans only a handful of rows
+// instead of an entire histogram bucket. The returned thresholds are always
+// real rows, with Min inserted at or before t and Max after it.
+func (e *Estimator) refineThresholds(ctx context.Context, conn Querier, rel Relation, t time.Time, thresholds Thresholds) (Thresholds, error) {
+	idType, _, err := e.inspectID(ctx, conn, rel)
+	if err != nil {
+		return thresholds, err
+	}
+
+	// midpoint orders strings by byte, which the probes must match or mid may
+	// fall outside the thresholds in the column's collation
+	data := rel.queryData()
+	data.BytewiseID = textualID(idType)
+
+	sql, err := renderSQL("selectBisect", selectBisect, data)
+	if err != nil {
+		return thresholds, err
+	}
+
+	// upper is the key we bisect towards, which moves below Max whenever the
+	// range between the midpoint and Max turns out to be empty.
+	upper, iterations := thresholds.MaxID, 0
+	for ; iterations < maxRefineIterations; iterations++ {
+		mid, ok := midpoint(thresholds.MinID, upper)
+		if !ok {
+			break
+		}
+
+		var row Row
+		err := conn.QueryRow(ctx, sql, thresholds.MinID, mid, thresholds.MaxID).Scan(&row.ID, &row.CreatedAt)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			upper = mid
+		case err != nil:
+			return thresholds, fmt.Errorf("failed to bisect thresholds: %w", err)
+		case row.CreatedAt.After(t):
+			thresholds.MaxID, thresholds.MaxCreatedAt, upper = row.ID, row.CreatedAt, row.ID
+		default:
+			thresholds.MinID, thresholds.MinCreatedAt = row.ID, row.CreatedAt
+		}
+	}
+
+	level.Debug(e.logger()).Log("event", "refined_thresholds", "iterations", iterations,
+		"min_id", thresholds.MinID, "min_created_at", thresholds.MinCreatedAt,
+		"max_id", thresholds.MaxID, "max_created_at", thresholds.MaxCreatedAt)
+
+	return thresholds, nil
+}
+
+// midpoint finds a key strictly between lo and hi. Integer ids are bisected
+// numerically, and anything else as a string of printable ASCII, which covers
+// the base32-style textual ids this tool was written for. It returns false
+// when no such key exists.
+func midpoint(lo, hi string) (string, bool) {
+	if a, ok := new(big.Int).SetString(lo, 10); ok {
+		if b, ok := new(big.Int).SetString(hi, 10); ok {
+			mid := new(big.Int).Add(a, b)
+			mid.Rsh(mid, 1)
+			return mid.String(), mid.Cmp(a) > 0 && mid.Cmp(b) < 0
+		}
+	}
+
+	// Pad by an extra digit, so adjacent strings still have keys between them
+	width := len(lo) + 1
+	if len(hi) >= width {
+		width = len(hi) + 1
+	}
+
+	a, ok := asciiToInt(lo, width)
+	if !ok {
+		return "", false
+	}
+	b, ok := asciiToInt(hi, width)
+	if !ok {
+		return "", false
+	}
+
+	mid := new(big.Int).Add(a, b)
+	mid.Rsh(mid, 1)
+	if mid.Cmp(a) <= 0 || mid.Cmp(b) >= 0 {
+		return "", false
+	}
+
+	return intToASCII(mid, width), true
+}
+
+// textualID is whether ids of the type sort by collation, as format_type names
+// text, varchar and char columns.
+func textualID(idType string) bool {
+	return idType == "text" || strings.HasPrefix(idType, "character")
+}
+
+// Printable ASCII from space to tilde, treated as digits of a base 95 number
+const (
+	asciiFirst = ' '
+	asciiBase  = '~' - ' ' + 1
+)
+
+func asciiToInt(s string, width int) (*big.Int, bool) {
+	n, base := new(big.Int), big.NewInt(asciiBase)
+	for idx := 0; idx < width; idx++ {
+		digit := byte(asciiFirst)
+		if idx < len(s) {
+			digit = s[idx]
+		}
+		if digit < asciiFirst || digit > '~' {
+			return nil, false
+		}
+
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit-asciiFirst)))
+	}
+
+	return n, true
+}
+
+func intToASCII(n *big.Int, width int) string {
+	digits := make([]byte, width)
+	n, base, digit := new(big.Int).Set(n), big.NewInt(asciiBase), new(big.Int)
+	for idx := width - 1; idx >= 0; idx-- {
+		n.DivMod(n, base, digit)
+		digits[idx] = byte(digit.Int64()) + asciiFirst
+	}
+
+	return strings.TrimRight(string(digits), string(asciiFirst))
+}
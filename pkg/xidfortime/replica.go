@@ -0,0 +1,103 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Policies for standbys that haven't replayed past the target time, whose
+// estimates miss whatever the primary committed since.
+const (
+	ReplicaLagPolicyWarn   = "warn"
+	ReplicaLagPolicyRefuse = "refuse"
+	ReplicaLagPolicyWait   = "wait"
+)
+
+// ReplicaLagPolicies lists the valid replica lag policies.
+var ReplicaLagPolicies = []string{ReplicaLagPolicyWarn, ReplicaLagPolicyRefuse, ReplicaLagPolicyWait}
+
+const (
+	// DefaultReplicaWait is how long the wait policy waits for the standby to
+	// replay past the target time.
+	DefaultReplicaWait = time.Minute
+	// replicaPollInterval is how often the wait policy checks replay progress.
+	replicaPollInterval = time.Second
+)
+
+// ReplicaLagError is returned under the refuse policy, or once the wait policy
+// gives up, when the standby hasn't replayed past the target time.
+type ReplicaLagError struct {
+	Target   time.Time
+	Replayed *time.Time
+}
+
+func (e *ReplicaLagError) Error() string {
+	if e.Replayed == nil {
+		return fmt.Sprintf("standby has replayed no commits, so can't estimate for %s", e.Target.Format(time.RFC3339Nano))
+	}
+
+	return fmt.Sprintf("standby has only replayed commits up to %s, %s before the target time",
+		e.Replayed.Format(time.RFC3339Nano), e.Target.Sub(*e.Replayed))
+}
+
+// checkReplica checks a standby has replayed past t, as otherwise the rows and
+// xids either side of it may not have reached it yet. Standbys caught up with
+// their primary are trusted, as the primary has committed nothing since.
+// Replay can only be waited for outside of a snapshot, which would never see
+// what's replayed meanwhile.
+func (e *Estimator) checkReplica(ctx context.Context, conn Querier, t time.Time) error {
+	sql, err := e.serverSQL(ctx, conn, "selectReplayStatus", selectReplayStatus)
+	if err != nil {
+		return err
+	}
+
+	wait := e.ReplicaWait
+	if wait <= 0 {
+		wait = DefaultReplicaWait
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		var (
+			standby, caughtUp bool
+			replayed          *time.Time
+		)
+		if err := conn.QueryRow(ctx, sql).Scan(&standby, &replayed, &caughtUp); err != nil {
+			return fmt.Errorf("failed to check replay status: %w", err)
+		}
+
+		switch {
+		case !standby:
+			return nil
+		case replayed != nil && !replayed.Before(t):
+			level.Debug(e.logger()).Log("event", "replica_replayed_target", "replayed_at", *replayed)
+			return nil
+		case caughtUp:
+			level.Debug(e.logger()).Log("event", "replica_caught_up", "replayed_at", replayed,
+				"msg", "standby has replayed all it received, so the primary committed nothing since")
+			return nil
+		}
+
+		lagErr := &ReplicaLagError{Target: t, Replayed: replayed}
+		switch {
+		case e.ReplicaLagPolicy == ReplicaLagPolicyRefuse:
+			return lagErr
+		case e.ReplicaLagPolicy != ReplicaLagPolicyWait:
+			level.Warn(e.logger()).Log("event", "replica_behind", "replayed_at", replayed, "error", lagErr,
+				"msg", "commits after the last replayed are missing, so the estimate may be too early")
+			return nil
+		case time.Now().After(deadline):
+			return fmt.Errorf("gave up waiting after %s: %w", wait, lagErr)
+		}
+
+		level.Info(e.logger()).Log("event", "waiting_for_replica", "replayed_at", replayed)
+		select {
+		case <-time.After(replicaPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package xidfortime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ResultsTable is the table results are recorded to, as an audit history of
+// every estimate made.
+const ResultsTable = "xid_for_time_results"
+
+// RecordedResult is an estimate as recorded to the results table, naming the
+// database and table it was made against.
+type RecordedResult struct {
+	Source  string
+	Table   string
+	Result  Result
+	Elapsed time.Duration
+}
+
+type resultsData struct {
+	Schema string
+	Table  string
+	Index  string
+}
+
+func newResultsData(schema string) resultsData {
+	return resultsData{
+		Schema: pgx.Identifier{schema}.Sanitize(),
+		Table:  pgx.Identifier{schema, ResultsTable}.Sanitize(),
+		Index:  pgx.Identifier{ResultsTable + "_target_time_idx"}.Sanitize(),
+	}
+}
+
+// InstallResults creates the results table in schema if it doesn't already
+// exist.
+func InstallResults(ctx context.Context, conn Execer, schema string) error {
+	data := newResultsData(schema)
+
+	var exists bool
+	if err := conn.QueryRow(ctx, selectResultsTable, data.Table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for results table: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	for idx, src := range createResultsTable {
+		sql, err := renderSQL(fmt.Sprintf("createResultsTable%d", idx), src, data)
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create results table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RecordResult inserts a result into the results table in schema, returning
+// the id it was recorded under.
+func RecordResult(ctx context.Context, conn Querier, schema string, recorded RecordedResult) (int64, error) {
+	sql, err := renderSQL("insertResult", insertResult, newResultsData(schema))
+	if err != nil {
+		return 0, err
+	}
+
+	document, err := json.Marshal(recorded.Result)
+	if err != nil {
+		return 0, err
+	}
+
+	r := recorded.Result
+	var before, exceeded *time.Time
+	if !r.Before.CreatedAt.IsZero() {
+		before = &r.Before.CreatedAt
+	}
+	if !r.BeyondHead && !r.Exceeded.CreatedAt.IsZero() {
+		exceeded = &r.Exceeded.CreatedAt
+	}
+
+	var id int64
+	err = conn.QueryRow(ctx, sql, recorded.Source, recorded.Table, r.TargetTime, r.Slack.Microseconds(), r.Strategy,
+		r.XID(), r.XID8, r.LowerXID(), r.UpperXID(), before, exceeded, r.Gap().Microseconds(),
+		recorded.Elapsed.Microseconds(), string(document)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record result: %w", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,129 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// maxRetryBackoff caps the delay between attempts, however many have failed.
+const maxRetryBackoff = 10 * time.Second
+
+// RetryPolicy retries operations that fail with transient errors, such as
+// connection resets, serialization failures and failovers, waiting an
+// exponentially increasing time with jitter between attempts. The zero value
+// never retries.
+type RetryPolicy struct {
+	// Retries is how many times to retry after the first attempt fails
+	Retries int
+	// Backoff is the delay before the first retry, doubling after each
+	Backoff time.Duration
+}
+
+// Do runs fn until it succeeds, fails with an error that isn't transient, or
+// exhausts the retries, returning the last error.
+func (p RetryPolicy) Do(ctx context.Context, logger kitlog.Logger, operation string, fn func() error) error {
+	backoff := p.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Retries || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		// Full jitter spreads retries from many clients hitting the same failover
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+		level.Warn(logger).Log("event", "retrying", "operation", operation, "attempt", attempt+1,
+			"delay", delay, "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// IsTransient reports whether err is likely to succeed if retried, as with
+// lost connections, servers that are starting or shutting down, and
+// serialization failures. Cancellations and timeouts are never transient.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"): // connection_exception
+			return true
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization_failure, deadlock_detected
+			return true
+		case pgErr.Code == "53300": // too_many_connections
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err) || strings.Contains(err.Error(), "conn closed")
+}
+
+// retryQuerier retries statements that fail transiently. Every statement the
+// estimator runs is a read, so retrying is always safe, and a pool replaces
+// the broken connection on the next attempt.
+type retryQuerier struct {
+	Querier
+	e *Estimator
+}
+
+func (e *Estimator) withRetries(conn Querier) Querier {
+	if e.Retry.Retries <= 0 {
+		return conn
+	}
+
+	return retryQuerier{Querier: conn, e: e}
+}
+
+func (q retryQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return retryRow{q: q, ctx: ctx, sql: sql, args: args}
+}
+
+func (q retryQuerier) Query(ctx context.Context, sql string, args ...interface{}) (rows pgx.Rows, err error) {
+	err = q.e.Retry.Do(ctx, q.e.logger(), "query", func() error {
+		rows, err = q.Querier.Query(ctx, sql, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+// retryRow runs the query when scanned, as that's when pgx reports its errors.
+type retryRow struct {
+	q    retryQuerier
+	ctx  context.Context
+	sql  string
+	args []interface{}
+}
+
+func (r retryRow) Scan(dest ...interface{}) error {
+	return r.q.e.Retry.Do(r.ctx, r.q.e.logger(), "query", func() error {
+		return r.q.Querier.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
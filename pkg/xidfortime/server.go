@@ -0,0 +1,116 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// MinServerVersion is the oldest Postgres we support, as server_version_num.
+const MinServerVersion = 90600
+
+// Server describes the Postgres server an estimate runs against, which decides
+// the functions our SQL can use. Postgres 13 renamed the txid_* functions to
+// pg_*_xact_id, taking the new xid8 type, and deprecated the old names.
+type Server struct {
+	// Version is server_version_num, such as 130004 for 13.4
+	Version int `json:"version"`
+	// WALInspect is whether the pg_walinspect extension is installed
+	WALInspect bool `json:"wal_inspect"`
+}
+
+// XID8 is whether the server has the xid8 type and pg_*_xact_id functions.
+func (s Server) XID8() bool { return s.Version >= 130000 }
+
+// XIDStatus is whether the server can report the status of an xid.
+func (s Server) XIDStatus() bool { return s.Version >= 100000 }
+
+// WALInspectRecords is whether WAL records can be read with pg_walinspect.
+func (s Server) WALInspectRecords() bool { return s.Version >= 150000 && s.WALInspect }
+
+// serverData is passed to templates whose functions depend on the server.
+// Fields are SQL expressions, for interpolation.
+type serverData struct {
+	// NextFullXID is the next xid to be assigned, including its epoch, as bigint
+	NextFullXID string
+	// StatusFunction reports the status of the bigint xid candidate
+	StatusFunction string
+	// ReceiveLSN and ReplayLSN are how far a standby has received and replayed
+	// WAL, which Postgres 10 renamed from xlog locations
+	ReceiveLSN, ReplayLSN string
+}
+
+func (s Server) queryData() serverData {
+	data := serverData{
+		NextFullXID:    "txid_snapshot_xmax(txid_current_snapshot())",
+		StatusFunction: "txid_status(candidate)",
+		ReceiveLSN:     "pg_last_wal_receive_lsn()",
+		ReplayLSN:      "pg_last_wal_replay_lsn()",
+	}
+	if s.XID8() {
+		data.NextFullXID = "pg_snapshot_xmax(pg_current_snapshot())::text::bigint"
+		data.StatusFunction = "pg_xact_status(candidate::text::xid8)"
+	}
+	if s.Version < 100000 {
+		data.ReceiveLSN = "pg_last_xlog_receive_location()"
+		data.ReplayLSN = "pg_last_xlog_replay_location()"
+	}
+
+	return data
+}
+
+// DetectServer reads the version and capabilities of the server, failing
+// clearly for servers too old to support.
+func DetectServer(ctx context.Context, conn Querier) (Server, error) {
+	var server Server
+	if err := conn.QueryRow(ctx, selectServer).Scan(&server.Version, &server.WALInspect); err != nil {
+		return server, fmt.Errorf("failed to detect server version: %w", err)
+	}
+	if server.Version < MinServerVersion {
+		return server, fmt.Errorf("server version %d is older than the oldest supported, %d", server.Version, MinServerVersion)
+	}
+
+	return server, nil
+}
+
+// server detects the server once per Cache, or returns what withServer found.
+func (e *Estimator) server(ctx context.Context, conn Querier) (Server, error) {
+	if e.detected != nil {
+		return *e.detected, nil
+	}
+
+	return e.Cache.cachedServer(func() (Server, error) {
+		server, err := DetectServer(ctx, conn)
+		if err == nil {
+			level.Debug(e.logger()).Log("event", "detected_server", "server_version", server.Version,
+				"xid8", server.XID8(), "wal_inspect", server.WALInspect)
+		}
+
+		return server, err
+	})
+}
+
+// withServer detects the server at the start of an estimate, returning a copy
+// of the estimator that reuses what it found for the rest of it.
+func (e *Estimator) withServer(ctx context.Context, conn Querier) (*Estimator, error) {
+	server, err := e.server(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	detected := *e
+	detected.detected = &server
+
+	return &detected, nil
+}
+
+// serverSQL renders a template whose functions depend on the server.
+func (e *Estimator) serverSQL(ctx context.Context, conn Querier, name, src string) (string, error) {
+	server, err := e.server(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	return renderSQL(name, src, server.queryData())
+}
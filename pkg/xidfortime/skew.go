@@ -0,0 +1,85 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// widenForSkew scans e.SkewWindow rows either side of the Before row, in
+// insertion order, and replaces it with whichever row inserted at or before
+// the target has the newest xmin. Application servers with skewed clocks write
+// created_at slightly out of order, so the row found by a strategy may not be
+// the last transaction before the target. The largest amount any row's
+// created_at runs behind a row inserted before it is reported as the observed
+// skew.
+func (e *Estimator) widenForSkew(ctx context.Context, conn Querier, rel Relation, result Result) (Result, error) {
+	data, key, err := e.rowOrder(ctx, conn, rel)
+	if err != nil {
+		return result, err
+	}
+
+	sql, err := renderSQL("selectSkewWindow", selectSkewWindow, data)
+	if err != nil {
+		return result, err
+	}
+
+	rows, err := conn.Query(ctx, sql, key(result.Before), e.SkewWindow)
+	if err != nil {
+		return result, fmt.Errorf("failed to scan rows around threshold: %w", err)
+	}
+	defer rows.Close()
+
+	var window []Row
+	for rows.Next() {
+		var row Row
+		if err := rows.Scan(&row.ID, &row.CreatedAt, &row.XMin); err != nil {
+			return result, fmt.Errorf("failed to scan rows around threshold: %w", err)
+		}
+		window = append(window, row)
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to scan rows around threshold: %w", err)
+	}
+
+	reference, err := parseXID(result.Before.XMin)
+	if err != nil {
+		return result, err
+	}
+
+	// Compare xids relative to the Before row, as sampleMinimumXMin does
+	var (
+		newest, newestAge = result.Before, int32(0)
+		latest            time.Time
+		skew              time.Duration
+	)
+	for _, row := range window {
+		if row.CreatedAt.After(latest) {
+			latest = row.CreatedAt
+		}
+		if behind := latest.Sub(row.CreatedAt); behind > skew {
+			skew = behind
+		}
+
+		if row.CreatedAt.After(result.TargetTime) || isSpecialXID(row.XMin) {
+			continue
+		}
+
+		xmin, err := parseXID(row.XMin)
+		if err != nil {
+			return result, err
+		}
+
+		if age := int32(xmin - reference); age > newestAge {
+			newest, newestAge = row, age
+		}
+	}
+
+	level.Info(e.logger()).Log("event", "scanned_skew_window", "scanned", len(window), "observed_skew", skew,
+		"before_id", newest.ID, "before_xmin", newest.XMin, "xids_newer", newestAge)
+
+	result.Before, result.ObservedSkew = newest, skew
+	return result, nil
+}
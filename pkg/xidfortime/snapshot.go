@@ -0,0 +1,190 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// snapshotOptions are those of the transaction every statement of an estimate
+// runs in when Snapshot is set.
+var snapshotOptions = pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+// txBeginner is satisfied by pools and connections, but not transactions,
+// which can't change their isolation level once begun.
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// snapshotQuerier runs every statement against the snapshot taken by a single
+// repeatable read transaction, so the statistics, thresholds and row probes of
+// an estimate can't disagree because of concurrent writes or an ANALYZE.
+//
+// Each statement runs in a savepoint of that transaction whenever it's free.
+// With concurrency the snapshot is also exported, so statements arriving while
+// it's busy can run in a transaction of their own that imports it.
+type snapshotQuerier struct {
+	ctx      context.Context // cancelled once the estimate is done
+	holder   pgx.Tx
+	free     chan struct{} // holds a token while the holder is free
+	conn     txBeginner
+	snapshot string
+}
+
+// withSnapshot wraps conn to run every statement in one snapshot, returning a
+// function that releases it once the estimate is done.
+func (e *Estimator) withSnapshot(ctx context.Context, conn Querier) (Querier, func(), error) {
+	if !e.Snapshot {
+		return conn, func() {}, nil
+	}
+
+	b, ok := conn.(txBeginner)
+	if !ok {
+		return nil, nil, fmt.Errorf("snapshots need a connection that can begin transactions")
+	}
+
+	holder, err := b.BeginTx(ctx, snapshotOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	release := func() {
+		cancel()
+		holder.Rollback(context.Background())
+	}
+
+	q := &snapshotQuerier{ctx: ctx, holder: holder, free: make(chan struct{}, 1)}
+	q.free <- struct{}{}
+	if e.concurrency() > 1 {
+		if err := holder.QueryRow(ctx, selectExportSnapshot).Scan(&q.snapshot); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("failed to export snapshot: %w", err)
+		}
+		q.conn = b
+	}
+
+	return q, release, nil
+}
+
+// Begin starts a transaction in the snapshot, satisfying beginner so timeouts
+// can be set within it.
+//
+// Holders of concurrent estimates sharing a pool can take every connection in
+// it, so a statement waiting on the pool could wait forever. Instead it takes
+// whichever of a pooled connection and the holder comes free first, and the
+// holder always does. A connection that comes too late is still established,
+// and returned to the pool for the next statement.
+func (q *snapshotQuerier) Begin(ctx context.Context) (pgx.Tx, error) {
+	select {
+	case <-q.free:
+		return q.beginHolder(ctx)
+	default:
+	}
+
+	if q.conn == nil {
+		select {
+		case <-q.free:
+			return q.beginHolder(ctx)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	type begun struct {
+		tx  pgx.Tx
+		err error
+	}
+	result := make(chan begun, 1)
+	go func() {
+		tx, err := q.conn.BeginTx(q.ctx, snapshotOptions)
+		result <- begun{tx, err}
+	}()
+	abandon := func() {
+		go func() {
+			if r := <-result; r.err == nil {
+				r.tx.Rollback(context.Background())
+			}
+		}()
+	}
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return q.importSnapshot(ctx, r.tx)
+	case <-q.free:
+		abandon()
+		return q.beginHolder(ctx)
+	case <-ctx.Done():
+		abandon()
+		return nil, ctx.Err()
+	}
+}
+
+// beginHolder starts a savepoint of the holder, which must have been taken
+// from free, returning it once the savepoint ends.
+func (q *snapshotQuerier) beginHolder(ctx context.Context) (pgx.Tx, error) {
+	tx, err := q.holder.Begin(ctx)
+	if err != nil {
+		q.free <- struct{}{}
+		return nil, err
+	}
+
+	return &holderTx{Tx: tx, free: q.free}, nil
+}
+
+func (q *snapshotQuerier) importSnapshot(ctx context.Context, tx pgx.Tx) (pgx.Tx, error) {
+	// SET TRANSACTION SNAPSHOT takes no parameters, but the identifier came
+	// from the server and contains only hex digits and dashes
+	if _, err := tx.Exec(ctx, fmt.Sprintf("set transaction snapshot '%s'", q.snapshot)); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to import snapshot: %w", err)
+	}
+
+	return tx, nil
+}
+
+// holderTx is a savepoint of the holder, freeing it for the next statement
+// once committed or rolled back.
+type holderTx struct {
+	pgx.Tx
+	free chan struct{}
+	once sync.Once
+}
+
+func (tx *holderTx) Commit(ctx context.Context) error {
+	defer tx.once.Do(func() { tx.free <- struct{}{} })
+	return tx.Tx.Commit(ctx)
+}
+
+func (tx *holderTx) Rollback(ctx context.Context) error {
+	defer tx.once.Do(func() { tx.free <- struct{}{} })
+	return tx.Tx.Rollback(ctx)
+}
+
+func (q *snapshotQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return errRow{err}
+	}
+
+	return txRow{tx: tx, ctx: ctx, row: tx.QueryRow(ctx, sql, args...)}
+}
+
+func (q *snapshotQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return txRows{Rows: rows, tx: tx, ctx: ctx}, nil
+}
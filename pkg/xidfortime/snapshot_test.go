@@ -0,0 +1,167 @@
+package xidfortime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// fakePool hands out at most its capacity of transactions at once, blocking
+// further BeginTx calls as a pgxpool does once every connection is acquired.
+type fakePool struct {
+	conns chan struct{}
+}
+
+func newFakePool(maxConns int) *fakePool {
+	return &fakePool{conns: make(chan struct{}, maxConns)}
+}
+
+func (p *fakePool) BeginTx(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+	select {
+	case p.conns <- struct{}{}:
+		return &fakeTx{release: func() { <-p.conns }}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *fakePool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return errRow{nil}
+}
+
+func (p *fakePool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return nil, nil
+}
+
+// fakeTx is a transaction on a connection of a fakePool, or a savepoint of one
+// when release is nil. Statements take a moment, so they overlap.
+type fakeTx struct {
+	pgx.Tx
+	once    sync.Once
+	release func()
+}
+
+func (tx *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+func (tx *fakeTx) end() {
+	tx.once.Do(func() {
+		if tx.release != nil {
+			tx.release()
+		}
+	})
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error   { tx.end(); return nil }
+func (tx *fakeTx) Rollback(ctx context.Context) error { tx.end(); return nil }
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return nil, nil
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	time.Sleep(time.Millisecond)
+	return fakeRow{}
+}
+
+type fakeRow struct{}
+
+func (fakeRow) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		if s, ok := d.(*string); ok {
+			*s = "00000003-0000001B-1"
+		}
+	}
+
+	return nil
+}
+
+// More concurrent estimates than the pool has connections take every one of
+// them as holders, which must not leave their statements waiting forever.
+func TestSnapshotMoreEstimatesThanConns(t *testing.T) {
+	const (
+		maxConns  = 4
+		estimates = 3 * maxConns
+	)
+	pool := newFakePool(maxConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, estimates*maxConns)
+	for idx := 0; idx < estimates; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			e := &Estimator{Snapshot: true, Concurrency: maxConns}
+			conn, release, err := e.withSnapshot(ctx, pool)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer release()
+
+			var probes sync.WaitGroup
+			for worker := 0; worker < maxConns; worker++ {
+				probes.Add(1)
+				go func() {
+					defer probes.Done()
+					for probe := 0; probe < 5; probe++ {
+						var value string
+						if err := conn.QueryRow(ctx, "select 1").Scan(&value); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+			probes.Wait()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("estimate failed: %v", err)
+	}
+}
+
+// Statements may use the holder as well as pooled connections, but never the
+// holder from two at once.
+func TestSnapshotHolderExclusive(t *testing.T) {
+	e := &Estimator{Snapshot: true, Concurrency: 4}
+	conn, release, err := e.withSnapshot(context.Background(), newFakePool(1))
+	if err != nil {
+		t.Fatalf("withSnapshot returned error: %v", err)
+	}
+	defer release()
+
+	q := conn.(*snapshotQuerier)
+	first, err := q.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin returned error: %v", err)
+	}
+	if _, ok := first.(*holderTx); !ok {
+		t.Fatalf("first statement ran on %T, not the free holder", first)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if second, err := q.Begin(ctx); err == nil {
+		t.Fatalf("second statement began on %T while the holder was busy and the pool exhausted", second)
+	}
+
+	first.Rollback(context.Background())
+	second, err := q.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin returned error once the holder was free: %v", err)
+	}
+	second.Rollback(context.Background())
+}
@@ -0,0 +1,1077 @@
+package xidfortime
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// relationSchema is the schema of the table named $2 for catalog lookups: $1
+// when the table was qualified, or else the first schema on the search_path
+// holding it, as the probes find it, rather than only the first schema.
+const relationSchema = `coalesce($1, (
+       select n.nspname
+         from pg_class c
+         join pg_namespace n on n.oid = c.relnamespace
+        where c.oid = to_regclass(quote_ident($2))
+       ))`
+
+// andFilter restricts a probe to the rows matching the relation's filter, if
+// it has one.
+const andFilter = `{{ with .Filter }}
+   and ({{ . }}){{ end }}`
+
+// andNestedFilter is andFilter for subqueries.
+const andNestedFilter = `{{ with .Filter }}
+          and ({{ . }}){{ end }}`
+
+// bytewiseID collates the id column preceding it in byte order, when it's
+// textual and so would otherwise sort by its collation.
+const bytewiseID = `{{ if .BytewiseID }} collate "C"{{ end }}`
+
+const (
+	selectHistogramBounds = `
+select histogram_bounds::text::text[]
+  from pg_stats
+ where schemaname = ` + relationSchema + `
+   and tablename = $2
+   and attname = $3;
+`
+	selectBoundCreatedAt = `
+select {{ .TimeColumn }}
+     , xmin::text
+     , nullif(tableoid, to_regclass($2)::oid)::regclass::text
+  from {{ .Table }}
+ where {{ .IDColumn }} = $1` + andFilter + `;
+`
+	selectBeforeUnfrozen = `
+select id
+     , created_at
+     , xmin::text
+     , walked
+  from (
+       select {{ .IDColumn }} as id
+            , {{ .TimeColumn }} as created_at
+            , xmin
+            , row_number() over (order by {{ .OrderColumn }} desc) as walked
+         from {{ .Table }}
+        where {{ .OrderColumn }} < $1
+          and {{ .TimeColumn }} is not null` + andNestedFilter + `
+        order by {{ .OrderColumn }} desc
+        limit $2
+       ) w
+ where xmin::text::bigint > 2
+ order by walked
+ limit 1;
+`
+	selectRowsUpTo = `
+select coalesce(array_agg(id), '{}')
+     , coalesce(array_agg(created_at), '{}')
+     , coalesce(array_agg(xmin), '{}')
+  from (
+       select {{ .IDColumn }}::text as id
+            , {{ .TimeColumn }} as created_at
+            , xmin::text as xmin
+         from {{ .Table }}
+        where {{ .OrderColumn }} <= $1
+          and {{ .TimeColumn }} is not null` + andNestedFilter + `
+        order by {{ .OrderColumn }} desc
+        limit $2
+       ) w;
+`
+	selectSkewWindow = `
+select id
+     , created_at
+     , xmin
+  from (
+       (
+       select {{ .IDColumn }}::text as id
+            , {{ .TimeColumn }} as created_at
+            , xmin::text as xmin
+            , -row_number() over (order by {{ .OrderColumn }} desc) as position
+         from {{ .Table }}
+        where {{ .OrderColumn }} <= $1
+          and {{ .TimeColumn }} is not null` + andNestedFilter + `
+        order by {{ .OrderColumn }} desc
+        limit $2
+       )
+       union all
+       (
+       select {{ .IDColumn }}::text as id
+            , {{ .TimeColumn }} as created_at
+            , xmin::text as xmin
+            , row_number() over (order by {{ .OrderColumn }} asc) as position
+         from {{ .Table }}
+        where {{ .OrderColumn }} > $1
+          and {{ .TimeColumn }} is not null` + andNestedFilter + `
+        order by {{ .OrderColumn }} asc
+        limit $2
+       )
+       ) w
+ order by position;
+`
+	selectSampleCorrelation = `
+select corr(id_rank, time_rank)
+  from (
+       select rank() over (order by {{ .IDColumn }}) as id_rank
+            , rank() over (order by {{ .TimeColumn }}) as time_rank
+         from {{ .Table }} tablesample system ($1)
+        where {{ .TimeColumn }} is not null` + andNestedFilter + `
+       ) s;
+`
+	selectSampleBounds = `
+select coalesce(array_agg({{ .IDColumn }}::text), '{}')
+     , coalesce(array_agg({{ .TimeColumn }}), '{}')
+     , coalesce(array_agg(xmin::text), '{}')
+  from {{ .Table }} tablesample system ($1)
+ where {{ .TimeColumn }} is not null` + andFilter + `;
+`
+	selectBisect = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+  from {{ .Table }}
+ where {{ .IDColumn }}` + bytewiseID + ` > $1
+   and {{ .IDColumn }}` + bytewiseID + ` >= $2
+   and {{ .IDColumn }}` + bytewiseID + ` < $3
+   and {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .IDColumn }}` + bytewiseID + ` asc
+ limit 1;
+`
+	selectPastThreshold = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .IDColumn }} > $1
+   and {{ .IDColumn }} <= $2
+   and {{ .TimeColumn }} > $3` + andFilter + `
+ order by {{ .IDColumn }} asc
+ limit 1;
+`
+	selectFirstRow = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .OrderColumn }} asc
+ limit 1;
+`
+	selectLastRow = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .OrderColumn }} desc
+ limit 1;
+`
+	selectBeforeThreshold = `
+select b.{{ .IDColumn }}
+     , b.{{ .TimeColumn }}
+     , b.xmin::text
+     , (
+       select count(*)
+         from {{ .Table }} n
+        where n.{{ .IDColumn }} > b.{{ .IDColumn }}
+          and n.{{ .IDColumn }} < $1
+          and n.{{ .TimeColumn }} is null` + andNestedFilter + `
+       )
+  from {{ .Table }} b
+ where b.{{ .IDColumn }} < $1
+   and b.{{ .TimeColumn }} is not null` + andFilter + `
+ order by b.{{ .IDColumn }} desc
+ limit 1;
+`
+	selectAtOrAfterKey = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .IDColumn }} >= $1
+   and {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .IDColumn }} asc
+ limit 1;
+`
+)
+
+// Relation identifies the table and columns used for an estimate. Names are
+// unquoted, and Schema is empty when the table was not qualified.
+type Relation struct {
+	Schema, Table        string
+	IDColumn, TimeColumn string
+
+	// filter restricts the rows probed, as configured by Estimator.Filter
+	filter sqlFilter
+}
+
+// schemaArg is the schema for binding as a query parameter, where NULL stands
+// for the current schema.
+func (r Relation) schemaArg() interface{} {
+	if r.Schema == "" {
+		return nil
+	}
+
+	return r.Schema
+}
+
+func (r Relation) queryData() queryData {
+	table := pgx.Identifier{r.Table}
+	if r.Schema != "" {
+		table = pgx.Identifier{r.Schema, r.Table}
+	}
+
+	id := quoteIdentifier(pgx.Identifier{r.IDColumn})
+	return queryData{
+		Table:       quoteIdentifier(table),
+		IDColumn:    id,
+		TimeColumn:  quoteIdentifier(pgx.Identifier{r.TimeColumn}),
+		OrderColumn: id,
+		Filter:      r.filter,
+	}
+}
+
+// queryData is passed to each SQL template when rendering. Its fields can only
+// be built by quoteIdentifier or parseFilter, so nothing else reaches the SQL.
+type queryData struct {
+	Table      quotedIdentifier
+	IDColumn   quotedIdentifier
+	TimeColumn quotedIdentifier
+
+	// OrderColumn is the column that walks rows in insertion order, which is
+	// the id unless ids aren't sequential
+	OrderColumn quotedIdentifier
+
+	// Filter is checked by parseFilter before reaching the SQL
+	Filter sqlFilter
+
+	// BytewiseID compares a textual id in byte order rather than by its
+	// collation, as midpoint does
+	BytewiseID bool
+}
+
+// orderedByTime walks rows by the time column instead of the id.
+func (d queryData) orderedByTime() queryData {
+	d.OrderColumn = d.TimeColumn
+	return d
+}
+
+// quotedIdentifier is an identifier quoted for interpolation into SQL, where it
+// can only ever name an object, never change the statement around it.
+type quotedIdentifier string
+
+func quoteIdentifier(ident pgx.Identifier) quotedIdentifier {
+	return quotedIdentifier(ident.Sanitize())
+}
+
+const (
+	selectInspection = `
+select exists (
+       select 1
+         from pg_stats
+        where schemaname = ` + relationSchema + `
+          and tablename = $2
+          and attname = $3
+          and histogram_bounds is not null
+       )
+     , coalesce(current_setting('track_commit_timestamp', true)::bool, false)
+     , exists (
+       select 1
+         from pg_class c
+         join pg_namespace n on n.oid = c.relnamespace
+        where n.nspname = ` + relationSchema + `
+          and c.relname = $2
+          and c.relkind = 'p'
+       )
+     , exists (select 1 from pg_extension where extname = 'timescaledb')
+     , (
+       select correlation::float8
+         from pg_stats
+        where schemaname = ` + relationSchema + `
+          and tablename = $2
+          and attname = $3
+        order by inherited
+        limit 1
+       );
+`
+	selectIndexMethods = `
+select coalesce(array_agg(distinct am.amname::text), '{}')
+  from pg_index i
+  join pg_class c on c.oid = i.indexrelid
+  join pg_am am on am.oid = c.relam
+  join pg_attribute a on a.attrelid = i.indrelid
+                     and a.attnum = i.indkey[0]
+ where i.indrelid = to_regclass($1)
+   and i.indisvalid
+   and i.indpred is null
+   and a.attname = $2;
+`
+	selectLeafPartitions = `
+with recursive tree as (
+     select inhrelid as relid
+       from pg_inherits
+      where inhparent = to_regclass($1)
+      union all
+     select i.inhrelid
+       from pg_inherits i
+       join tree t on i.inhparent = t.relid
+)
+select coalesce(array_agg(c.oid::regclass::text order by c.oid), '{}')
+  from tree t
+  join pg_class c on c.oid = t.relid
+ where c.relkind <> 'p';
+`
+	selectRangePartitionKey = `
+select coalesce((
+       select a.attname::text
+         from pg_partitioned_table p
+         join pg_attribute a on a.attrelid = p.partrelid
+                            and a.attnum = p.partattrs[0]
+        where p.partrelid = to_regclass($1)
+          and p.partstrat = 'r'
+          and p.partnatts = 1
+       ), '');
+`
+	selectPartitionRanges = `
+select c.oid::regclass::text
+     , substring(b.expr from $$FROM \('([^']*)'\)$$)::timestamptz
+     , substring(b.expr from $$TO \('([^']*)'\)$$)::timestamptz
+  from pg_inherits i
+  join pg_class c on c.oid = i.inhrelid
+     , pg_get_expr(c.relpartbound, c.oid) b(expr)
+ where i.inhparent = to_regclass($1)
+   and b.expr like 'FOR VALUES FROM %';
+`
+	selectHypertableChunks = `
+select format('%I.%I', chunk_schema, chunk_name)
+     , range_start
+     , range_end
+  from timescaledb_information.chunks
+ where hypertable_schema = ` + relationSchema + `
+   and hypertable_name = $2
+   and primary_dimension = $3;
+`
+	selectPartitionHistogramBounds = `
+select coalesce(array_agg(bound), '{}')
+  from pg_stats s
+     , unnest(s.histogram_bounds::text::text[]) bound
+ where s.attname = $2
+   and not s.inherited
+   and to_regclass(format('%I.%I', s.schemaname, s.tablename)) = any($1::text[]::regclass[]);
+`
+	selectIDColumn = `
+select format_type(a.atttypid, a.atttypmod)
+     , coalesce(pg_get_expr(d.adbin, d.adrelid), '')
+  from pg_attribute a
+  left join pg_attrdef d on d.adrelid = a.attrelid
+                        and d.adnum = a.attnum
+ where a.attrelid = to_regclass($1)
+   and a.attname = $2
+   and not a.attisdropped;
+`
+	selectAtOrBeforeTime = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .TimeColumn }} <= $1` + andFilter + `
+ order by {{ .TimeColumn }} desc
+ limit 1;
+`
+	selectAfterTime = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .TimeColumn }} > $1` + andFilter + `
+ order by {{ .TimeColumn }} asc
+ limit 1;
+`
+)
+
+// The heap is probed a block at a time by listing every possible tuple id in
+// the block, which Postgres resolves with a cheap TID scan.
+const (
+	selectHeapBlocks = `
+select pg_relation_size(to_regclass($1)) / current_setting('block_size')::bigint;
+`
+	blockTIDs = `
+array(
+  select format('(%s,%s)', block, item)::tid
+    from unnest($1::bigint[]) block
+       , generate_series(1, (current_setting('block_size')::int - 24) / 28) item
+)
+`
+	selectBlockTimeRange = `
+select min({{ .TimeColumn }})
+     , max({{ .TimeColumn }})
+  from {{ .Table }}
+ where ctid = any(` + blockTIDs + `)` + andFilter + `;
+`
+	selectBlocksAtOrBeforeTime = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where ctid = any(` + blockTIDs + `)
+   and {{ .TimeColumn }} <= $2` + andFilter + `
+ order by {{ .TimeColumn }} desc
+ limit 1;
+`
+	selectBlocksAfterTime = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where ctid = any(` + blockTIDs + `)
+   and {{ .TimeColumn }} > $2` + andFilter + `
+ order by {{ .TimeColumn }} asc
+ limit 1;
+`
+)
+
+// selectNextCommitTimestamp finds the first xid at or after $1, and within $2
+// xids of it, that has a commit timestamp. Offsets wrap at 2^32 so the range may
+// span an xid wraparound.
+const selectNextCommitTimestamp = `
+select x.offs
+     , x.xid::text
+     , committed_at
+  from (
+       select offs
+            , ((($1::bigint + offs) % 4294967296)::text)::xid as xid
+         from generate_series(0, $2::bigint) offs
+       ) x
+ cross join lateral pg_xact_commit_timestamp(x.xid) committed_at
+ where committed_at is not null
+ limit 1;
+`
+
+// selectLastCommitInWindow finds the xid within $2 of $1 that committed last,
+// at or before $3.
+const selectLastCommitInWindow = `
+select x.xid::text
+     , committed_at
+  from (
+       select (((($1::bigint + offs) % 4294967296 + 4294967296) % 4294967296)::text)::xid as xid
+         from generate_series(-$2::bigint, $2::bigint) offs
+       ) x
+ cross join lateral pg_xact_commit_timestamp(x.xid) committed_at
+ where committed_at <= $3
+ order by committed_at desc
+ limit 1;
+`
+
+// selectLastAnalyzed is when the least recently analyzed of the tables $1 was
+// last analyzed, and how many have never been.
+const selectLastAnalyzed = `
+select min(greatest(last_analyze, last_autoanalyze))
+     , count(*) filter (where last_analyze is null and last_autoanalyze is null)
+  from pg_stat_all_tables
+ where relid = any($1::regclass[]);
+`
+
+// selectCanAnalyze checks the current user owns, or is a member of the role
+// owning, the table $1, or is a superuser, as ANALYZE requires.
+const selectCanAnalyze = `
+select pg_has_role(c.relowner, 'usage') or r.rolsuper
+  from pg_class c
+     , pg_roles r
+ where c.oid = $1::regclass
+   and r.rolname = current_user;
+`
+
+// selectPrivileges checks the current user can select from the table $1, and
+// can see the statistics pg_stats has for its column $2, which it hides for
+// columns the user can't select and tables with row level security active.
+const selectPrivileges = `
+select has_table_privilege(c.oid, 'select')
+     , has_column_privilege(c.oid, $2, 'select')
+       and not (c.relrowsecurity and row_security_active(c.oid))
+  from pg_class c
+ where c.oid = to_regclass($1);
+`
+
+// analyzeTable analyzes only the id and time columns, which are all the
+// estimate reads statistics for.
+const analyzeTable = `
+analyze {{ .Table }} ({{ .IDColumn }}{{ if ne .IDColumn .TimeColumn }}, {{ .TimeColumn }}{{ end }});
+`
+
+// selectFilter checks the filter is a boolean expression over the columns of
+// the table, without reading any rows.
+const selectFilter = `
+select
+  from {{ .Table }}
+ where false` + andFilter + `;
+`
+
+// selectStatisticsTarget is the statistics target of column $2 of table $1,
+// or -1 when it uses default_statistics_target.
+const selectStatisticsTarget = `
+select coalesce(attstattarget::int, -1)
+  from pg_attribute
+ where attrelid = $1::regclass
+   and attname = $2;
+`
+
+// alterStatisticsTarget sets the statistics target of the id column, which
+// takes effect from the next ANALYZE.
+const alterStatisticsTarget = `
+alter table {{ .Table }} alter column {{ .IDColumn }} set statistics {{ .Target }};
+`
+
+// selectNeighbourCommits is when each xid within $2 of $1 committed, in xid
+// order, with null for those that didn't or that are too old to know.
+const selectNeighbourCommits = `
+select x.xid::text
+     , pg_xact_commit_timestamp(x.xid)
+  from (
+       select offs
+            , (((($1::bigint + offs) % 4294967296 + 4294967296) % 4294967296)::text)::xid as xid
+         from generate_series(-$2::bigint, $2::bigint) offs
+       ) x
+ order by offs;
+`
+
+// selectReplayStatus reads whether the server is a standby, when it last
+// replayed a commit, and whether it's caught up with the primary: streaming,
+// with everything received replayed, as when the primary has been idle since.
+const selectReplayStatus = `
+select pg_is_in_recovery()
+     , pg_last_xact_replay_timestamp()
+     , coalesce(
+       (select status = 'streaming' from pg_stat_wal_receiver)
+       and {{ .ReceiveLSN }} = {{ .ReplayLSN }}
+       , false);
+`
+
+// selectNextXID is the next xid to be assigned, without assigning one.
+const selectNextXID = `
+select {{ .NextFullXID }} % 4294967296;
+`
+
+// selectLatestXID is the last xid assigned, which may not have committed.
+const selectLatestXID = `
+select (({{ .NextFullXID }} - 1) % 4294967296)::text;
+`
+
+// selectNextFullXID is the next xid to be assigned, including its epoch.
+const selectNextFullXID = `
+select {{ .NextFullXID }};
+`
+
+const selectUpdateStats = `
+select n_tup_ins
+     , n_tup_upd
+  from pg_stat_user_tables
+ where relid = to_regclass($1);
+`
+
+// selectCandidateTables finds tables with a sequence or identity backed column,
+// and a timestamp column, preferring timestamps that default to the current
+// time or are named like created_at.
+const selectCandidateTables = `
+select n.nspname::text
+     , c.relname::text
+     , id_column.attname::text
+     , time_column.attname::text
+     , s.n_tup_ins
+     , s.n_tup_upd
+     , s.n_live_tup
+  from pg_class c
+  join pg_namespace n on n.oid = c.relnamespace
+  join pg_stat_user_tables s on s.relid = c.oid
+ cross join lateral (
+       select a.attname
+         from pg_attribute a
+         left join pg_attrdef d on d.adrelid = a.attrelid
+                               and d.adnum = a.attnum
+        where a.attrelid = c.oid
+          and a.attnum > 0
+          and not a.attisdropped
+          and (a.attidentity <> '' or pg_get_expr(d.adbin, d.adrelid) like '%nextval(%')
+        order by a.attnum
+        limit 1
+       ) id_column
+ cross join lateral (
+       select a.attname
+         from pg_attribute a
+         left join pg_attrdef d on d.adrelid = a.attrelid
+                               and d.adnum = a.attnum
+        where a.attrelid = c.oid
+          and a.attnum > 0
+          and not a.attisdropped
+          and a.atttypid in ('timestamp'::regtype, 'timestamptz'::regtype)
+        order by coalesce(pg_get_expr(d.adbin, d.adrelid) ~* '(now|clock_timestamp|statement_timestamp|transaction_timestamp)\(|current_timestamp', false) desc
+               , a.attname ~* '(created|inserted)' desc
+               , a.attnum
+        limit 1
+       ) time_column
+ where c.relkind in ('r', 'p')
+   and n.nspname not in ('pg_catalog', 'information_schema');
+`
+
+// selectXIDCommitTimestamp is when $1 committed, or null if unknown or the
+// server doesn't track commit timestamps.
+const selectXIDCommitTimestamp = `
+select case when coalesce(current_setting('track_commit_timestamp', true)::bool, false)
+            then pg_xact_commit_timestamp($1::text::xid)
+       end;
+`
+
+// selectTrackCommitTimestamp is whether the server tracks commit timestamps.
+const selectTrackCommitTimestamp = `
+select coalesce(current_setting('track_commit_timestamp', true)::bool, false);
+`
+
+// selectWindowCommitTimestamps lists the commit timestamp of each xid from $1
+// to $2 xids after it, null for those without one such as aborted xids.
+// Offsets wrap at 2^32, skipping the invalid xid 0.
+const selectWindowCommitTimestamps = `
+select x.offs
+     , pg_xact_commit_timestamp(x.xid)
+  from (
+       select offs
+            , ((($1::bigint + offs) % 4294967296)::text)::xid as xid
+         from generate_series(0, $2::bigint) offs
+        where ($1::bigint + offs) % 4294967296 <> 0
+       ) x
+ order by x.offs;
+`
+
+// selectAtOrBeforeXID and selectAfterXID find the rows either side of xid $3
+// between two bounds, comparing ages so the order survives wraparound.
+const (
+	selectAtOrBeforeXID = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .IDColumn }} >= $1
+   and {{ .IDColumn }} <= $2
+   and age(xmin) >= age($3::text::xid)
+   and {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .IDColumn }} desc
+ limit 1;
+`
+	selectAfterXID = `
+select {{ .IDColumn }}
+     , {{ .TimeColumn }}
+     , xmin::text
+  from {{ .Table }}
+ where {{ .IDColumn }} > $1
+   and {{ .IDColumn }} <= $2
+   and age(xmin) < age($3::text::xid)
+   and {{ .TimeColumn }} is not null` + andFilter + `
+ order by {{ .IDColumn }} asc
+ limit 1;
+`
+)
+
+// selectServer reads the server version, and whether pg_walinspect is
+// installed.
+const selectServer = `
+select current_setting('server_version_num')::int
+     , exists (select 1 from pg_extension where extname = 'pg_walinspect');
+`
+
+// selectWALRange reads the end of WAL, as written or replayed, the oldest
+// segment in pg_wal, and the size of each segment.
+const selectWALRange = `
+select case when pg_is_in_recovery() then pg_last_wal_replay_lsn() else pg_current_wal_lsn() end::text
+     , coalesce((select min(name) from pg_ls_waldir() where name ~ '^[0-9A-F]{24}$'), '')
+     , pg_size_bytes(current_setting('wal_segment_size'));
+`
+
+// selectCommitRecord finds the commit record of xid $3 between LSNs $1 and $2.
+const selectCommitRecord = `
+select start_lsn::text
+  from pg_get_wal_records_info($1::pg_lsn, $2::pg_lsn)
+ where xid = $3::text::xid
+   and resource_manager = 'Transaction'
+   and record_type in ('COMMIT', 'COMMIT_PREPARED')
+ limit 1;
+`
+
+// selectCommittedXID walks back from the 32-bit xid $1, for at most $2 xids,
+// to the first that didn't abort and isn't still in progress. The status
+// function needs a 64-bit xid, which we build from the current epoch.
+const selectCommittedXID = `
+select offs
+     , (candidate % 4294967296)::text
+     , coalesce({{ .StatusFunction }}, 'unknown')
+  from (
+       select next - ((next % 4294967296 - $1::bigint + 4294967296) % 4294967296) as estimate
+         from (select {{ .NextFullXID }} as next) head
+       ) e
+     , generate_series(0, $2::bigint) offs
+     , lateral (select estimate - offs as candidate) c
+ where coalesce({{ .StatusFunction }}, 'unknown') not in ('aborted', 'in progress')
+ limit 1;
+`
+
+// selectRelationColumns checks the table and both columns exist, returning the
+// number of columns found.
+const selectRelationColumns = `
+select count(*)
+  from pg_attribute
+ where attrelid = to_regclass($1)
+   and attname in ($2, $3)
+   and not attisdropped;
+`
+
+// selectCitusInstalled and selectShardPlacements find where the shards of a
+// Citus distributed table are placed, from the coordinator.
+const (
+	selectCitusInstalled = `
+select exists (select 1 from pg_extension where extname = 'citus');
+`
+	selectShardPlacements = `
+select n.nodename::text
+     , n.nodeport
+     , shard_name(s.logicalrelid, s.shardid)::text
+  from pg_dist_shard s
+  join pg_dist_placement p on p.shardid = s.shardid
+  join pg_dist_node n on n.groupid = p.groupid
+ where s.logicalrelid = to_regclass($1)
+   and n.isactive
+   and n.noderole = 'primary'
+ order by n.nodename, n.nodeport, s.shardid;
+`
+)
+
+// selectExportSnapshot exports the snapshot of the current transaction, so
+// others can share it while that transaction is open.
+const selectExportSnapshot = `
+select pg_export_snapshot();
+`
+
+// createTrackingTable installs the tracking table, with an index to find the
+// samples either side of a time. Servers before Postgres 13 have no xid8, so
+// the epoch-qualified xid is stored as bigint.
+var createTrackingTable = []string{`
+create schema if not exists {{ .Schema }};
+`, `
+create table if not exists {{ .Table }} (
+  recorded_at timestamptz not null default now(),
+  xid {{ .XIDType }} not null,
+  lsn pg_lsn not null
+);
+`, `
+create index if not exists {{ .Index }} on {{ .Table }} (recorded_at);
+`}
+
+// recordTrackingSample records the xid assigned to, and end of WAL written by,
+// the inserting transaction against the time it started. It is scheduled as
+// it is by pg_cron, and returns the sample when run by insertTrackingSample.
+const (
+	recordTrackingSample = `insert into {{ .Table }} (recorded_at, xid, lsn) values (now(), {{ .CurrentXID }}, {{ .CurrentLSN }})`
+	insertTrackingSample = `
+` + recordTrackingSample + `
+returning recorded_at, xid::text, lsn::text;
+`
+)
+
+// thinTrackingSamples deletes all but the first sample in each bucket of $3
+// seconds, among those recorded at least $1 seconds ago and, unless $2 is null,
+// at most $2 seconds ago. Buckets are aligned to the epoch, so thinning the
+// same samples again deletes nothing more.
+const thinTrackingSamples = `
+delete from {{ .Table }}
+where ctid in (
+  select ctid
+  from (
+    select ctid
+         , row_number() over (
+             partition by floor(extract(epoch from recorded_at) / $3::float8)
+             order by recorded_at
+           ) as n
+    from {{ .Table }}
+    where recorded_at < now() - $1::float8 * interval '1 second'
+      and ($2::float8 is null or recorded_at >= now() - $2::float8 * interval '1 second')
+  ) buckets
+  where n > 1
+);
+`
+
+// deleteTrackingSamples deletes samples recorded more than $1 seconds ago.
+const deleteTrackingSamples = `
+delete from {{ .Table }} where recorded_at < now() - $1::float8 * interval '1 second';
+`
+
+// selectCurrentSample reads a sample without recording it anywhere, assigning
+// an xid to the transaction it runs in.
+const selectCurrentSample = `
+select now(), {{ .CurrentXID }}::text, {{ .CurrentLSN }}::text;
+`
+
+// selectCronInstalled checks for the pg_cron extension.
+const selectCronInstalled = `
+select exists (select 1 from pg_extension where extname = 'pg_cron');
+`
+
+// scheduleCronJob creates or updates the pg_cron job named $1 to run the
+// command $3 on schedule $2, in the current database.
+const scheduleCronJob = `select cron.schedule_in_database($1, $2, $3, current_database());`
+
+// unscheduleCronJob removes every pg_cron job named $1, returning a row for
+// each.
+const unscheduleCronJob = `select cron.unschedule(jobid) from cron.job where jobname = $1;`
+
+// selectTrackingTable checks whether the tracking table $1 exists.
+const selectTrackingTable = `select to_regclass($1) is not null;`
+
+// selectTrackingSamples finds the last sample recorded at or before the target
+// time $1, and the first after it.
+const selectTrackingSamples = `
+(
+  select recorded_at, xid::text, lsn::text
+  from {{ .Table }}
+  where recorded_at <= $1
+  order by recorded_at desc
+  limit 1
+)
+union all
+(
+  select recorded_at, xid::text, lsn::text
+  from {{ .Table }}
+  where recorded_at > $1
+  order by recorded_at
+  limit 1
+);
+`
+
+// createResultsTable installs the results table, keeping the full result as
+// jsonb alongside the columns most often searched by.
+var createResultsTable = []string{`
+create schema if not exists {{ .Schema }};
+`, `
+create table if not exists {{ .Table }} (
+  id bigserial primary key,
+  recorded_at timestamptz not null default now(),
+  source text not null,
+  table_name text not null,
+  target_time timestamptz not null,
+  slack interval not null,
+  strategy text not null,
+  xid bigint not null,
+  xid8 bigint,
+  lower_xid bigint,
+  upper_xid bigint,
+  before_created_at timestamptz,
+  exceeded_created_at timestamptz,
+  gap interval not null,
+  elapsed interval not null,
+  result jsonb not null
+);
+`, `
+create index if not exists {{ .Index }} on {{ .Table }} (target_time);
+`}
+
+// selectResultsTable checks whether the results table exists, so recorders
+// needn't be allowed to create it once it does.
+const selectResultsTable = `select to_regclass($1) is not null;`
+
+// insertResult records a result, with durations given in microseconds.
+const insertResult = `
+insert into {{ .Table }} (
+  source, table_name, target_time, slack, strategy, xid, xid8, lower_xid, upper_xid,
+  before_created_at, exceeded_created_at, gap, elapsed, result
+)
+values (
+  $1, $2, $3, $4 * interval '1 microsecond', $5, $6::bigint, nullif($7, '')::bigint,
+  nullif($8, '')::bigint, nullif($9, '')::bigint, $10, $11,
+  $12 * interval '1 microsecond', $13 * interval '1 microsecond', $14
+)
+returning id;
+`
+
+// selectTrackingWindow finds the first sample of the tracking table recorded
+// within the last $1 seconds, and the latest.
+const selectTrackingWindow = `
+(
+  select recorded_at, xid::text
+  from {{ .Table }}
+  where recorded_at >= now() - $1::float8 * interval '1 second'
+  order by recorded_at
+  limit 1
+)
+union all
+(
+  select recorded_at, xid::text
+  from {{ .Table }}
+  order by recorded_at desc
+  limit 1
+);
+`
+
+// selectXIDCounter reads the next xid to be assigned against the time, without
+// assigning one.
+const selectXIDCounter = `
+select clock_timestamp(), {{ .NextFullXID }};
+`
+
+// selectOldestFrozenXID finds the database whose datfrozenxid is oldest, which
+// bounds how many xids the cluster can assign before wraparound, along with
+// the age at which autovacuum is forced to freeze it.
+const selectOldestFrozenXID = `
+select datname::text
+     , age(datfrozenxid)::bigint
+     , current_setting('autovacuum_freeze_max_age')::bigint
+  from pg_database
+ order by age(datfrozenxid) desc
+ limit 1;
+`
+
+// selectOldestXID is the datfrozenxid of the database frozen longest ago,
+// before which the cluster keeps no commit log or commit timestamps.
+const selectOldestXID = `
+select datfrozenxid::text::bigint
+  from pg_database
+ order by age(datfrozenxid) desc
+ limit 1;
+`
+
+// Query is a statement the estimator may run, rendered for review.
+type Query struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+// relationQueries are every template rendered against a Relation, roughly in
+// the order an estimate runs them.
+var relationQueries = []struct{ name, src string }{
+	{"selectHistogramBounds", selectHistogramBounds},
+	{"selectBoundCreatedAt", selectBoundCreatedAt},
+	{"selectSampleBounds", selectSampleBounds},
+	{"selectSampleCorrelation", selectSampleCorrelation},
+	{"selectBisect", selectBisect},
+	{"selectPastThreshold", selectPastThreshold},
+	{"selectBeforeThreshold", selectBeforeThreshold},
+	{"selectAtOrAfterKey", selectAtOrAfterKey},
+	{"selectAtOrBeforeTime", selectAtOrBeforeTime},
+	{"selectAfterTime", selectAfterTime},
+	{"selectHeapBlocks", selectHeapBlocks},
+	{"selectBlockTimeRange", selectBlockTimeRange},
+	{"selectBlocksAtOrBeforeTime", selectBlocksAtOrBeforeTime},
+	{"selectBlocksAfterTime", selectBlocksAfterTime},
+	{"selectAtOrBeforeXID", selectAtOrBeforeXID},
+	{"selectAfterXID", selectAfterXID},
+	{"selectFilter", selectFilter},
+	{"analyzeTable", analyzeTable},
+}
+
+// orderedQueries walk rows in insertion order, and are rendered for tables
+// with sequential ids and again for those without.
+var orderedQueries = []struct{ name, src string }{
+	{"selectFirstRow", selectFirstRow},
+	{"selectLastRow", selectLastRow},
+	{"selectBeforeUnfrozen", selectBeforeUnfrozen},
+	{"selectRowsUpTo", selectRowsUpTo},
+	{"selectSkewWindow", selectSkewWindow},
+}
+
+// serverQueries read only the catalog and server state, and are run as they
+// are.
+var serverQueries = []struct{ name, src string }{
+	{"selectRelationColumns", selectRelationColumns},
+	{"selectInspection", selectInspection},
+	{"selectIndexMethods", selectIndexMethods},
+	{"selectIDColumn", selectIDColumn},
+	{"selectLeafPartitions", selectLeafPartitions},
+	{"selectRangePartitionKey", selectRangePartitionKey},
+	{"selectPartitionRanges", selectPartitionRanges},
+	{"selectHypertableChunks", selectHypertableChunks},
+	{"selectPartitionHistogramBounds", selectPartitionHistogramBounds},
+	{"selectUpdateStats", selectUpdateStats},
+	{"selectOldestXID", selectOldestXID},
+	{"selectNextCommitTimestamp", selectNextCommitTimestamp},
+	{"selectLastCommitInWindow", selectLastCommitInWindow},
+	{"selectXIDCommitTimestamp", selectXIDCommitTimestamp},
+	{"selectTrackCommitTimestamp", selectTrackCommitTimestamp},
+	{"selectWindowCommitTimestamps", selectWindowCommitTimestamps},
+	{"selectNeighbourCommits", selectNeighbourCommits},
+	{"selectLastAnalyzed", selectLastAnalyzed},
+	{"selectCanAnalyze", selectCanAnalyze},
+	{"selectPrivileges", selectPrivileges},
+	{"selectStatisticsTarget", selectStatisticsTarget},
+	{"selectServer", selectServer},
+	{"selectExportSnapshot", selectExportSnapshot},
+	{"selectWALRange", selectWALRange},
+	{"selectCommitRecord", selectCommitRecord},
+	{"selectCitusInstalled", selectCitusInstalled},
+	{"selectShardPlacements", selectShardPlacements},
+	{"selectTrackingTable", selectTrackingTable},
+}
+
+// versionedQueries are rendered for the functions of each server version.
+var versionedQueries = []struct{ name, src string }{
+	{"selectNextXID", selectNextXID},
+	{"selectLatestXID", selectLatestXID},
+	{"selectNextFullXID", selectNextFullXID},
+	{"selectCommittedXID", selectCommittedXID},
+	{"selectReplayStatus", selectReplayStatus},
+	{"selectXIDCounter", selectXIDCounter},
+}
+
+// renderQueries renders every statement an estimate against rel could run,
+// looking up samples from the tracking table in trackingSchema first. Ordered
+// queries are rendered walking by id and then by time, and versioned queries
+// once for the functions of Postgres 13 and later, and once for those of
+// earlier versions.
+func renderQueries(rel Relation, trackingSchema string) ([]Query, error) {
+	sql, err := renderSQL("selectTrackingSamples", selectTrackingSamples, newTrackingData(trackingSchema, Server{}))
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []Query{{Name: "selectTrackingSamples", SQL: sql}}
+	for _, query := range relationQueries {
+		sql, err := renderSQL(query.name, query.src, rel.queryData())
+		if err != nil {
+			return nil, err
+		}
+
+		queries = append(queries, Query{Name: query.name, SQL: sql})
+	}
+
+	for _, data := range []queryData{rel.queryData(), rel.queryData().orderedByTime()} {
+		for _, query := range orderedQueries {
+			sql, err := renderSQL(query.name, query.src, data)
+			if err != nil {
+				return nil, err
+			}
+
+			queries = append(queries, Query{Name: query.name, SQL: sql})
+		}
+	}
+
+	for _, query := range serverQueries {
+		queries = append(queries, Query{Name: query.name, SQL: query.src})
+	}
+
+	for _, server := range []Server{{Version: 130000}, {Version: MinServerVersion}} {
+		for _, query := range versionedQueries {
+			sql, err := renderSQL(query.name, query.src, server.queryData())
+			if err != nil {
+				return nil, err
+			}
+
+			queries = append(queries, Query{Name: query.name, SQL: sql})
+		}
+	}
+
+	return queries, nil
+}
+
+func renderSQL(name, templateSource string, data interface{}) (string, error) {
+	var buffer bytes.Buffer
+	t := template.Must(template.New(name).Parse(templateSource))
+	if err := t.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+
+	return string(buffer.Bytes()), nil
+}
@@ -0,0 +1,285 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Strategies used to locate the rows either side of the target time
+const (
+	StrategyAuto            = "auto"
+	StrategyTracking        = "tracking-table"
+	StrategyTimeIndex       = "timestamp-index"
+	StrategyKeyTimestamp    = "key-timestamp"
+	StrategyBRIN            = "brin"
+	StrategyHistogram       = "histogram"
+	StrategyTableSample     = "tablesample"
+	StrategyCommitTimestamp = "commit-timestamp"
+
+	// StrategyHead is reported for targets beyond the newest row, and can't be
+	// forced
+	StrategyHead = "head"
+)
+
+// StrategyNames lists every strategy that can be forced, cheapest first.
+var StrategyNames = []string{
+	StrategyTracking, StrategyTimeIndex, StrategyKeyTimestamp, StrategyBRIN, StrategyHistogram, StrategyTableSample, StrategyCommitTimestamp,
+}
+
+// Strategy locates the rows inserted either side of a target time, whose xmins
+// bracket the xid we're looking for.
+type Strategy interface {
+	// Name identifies the strategy, and is recorded on each Result
+	Name() string
+	// Viable reports whether the strategy can run against an inspected table
+	Viable(Inspection) bool
+	Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error)
+}
+
+// Inspection is what we learn of a table and server when selecting a strategy.
+type Inspection struct {
+	HasHistogram         bool
+	TimeIndexMethods     map[string]bool
+	TrackCommitTimestamp bool
+
+	// Partitioned is set for declaratively partitioned tables, whose leaf
+	// Partitions each have their own statistics. PartitionKey is the column
+	// they're range partitioned by, if there's only one.
+	Partitioned  bool
+	Partitions   []string
+	PartitionKey string
+
+	// PartitionRanges are the bounds of each partition when the table is range
+	// partitioned by the time column, or of each chunk of a Hypertable whose
+	// chunks are split by it
+	PartitionRanges []PartitionRange
+	Hypertable      bool
+
+	// IDCorrelation is the correlation pg_stats has for the id column with the
+	// physical order of the table, if analyzed
+	IDCorrelation *float64
+
+	// IDType is the type of the id column, and SequentialID whether its ids
+	// are assigned in insertion order, which every strategy probing by id
+	// relies on. TimestampedID is set for UUIDv7 and ULID keys.
+	IDType        string
+	SequentialID  bool
+	TimestampedID bool
+}
+
+// Inspect reads pg_stats, pg_index and server settings to find which
+// strategies are viable for rel.
+func (e *Estimator) Inspect(ctx context.Context, conn Querier, rel Relation) (Inspection, error) {
+	return e.Cache.cachedInspection(rel, func() (Inspection, error) {
+		return e.inspect(ctx, conn, rel)
+	})
+}
+
+func (e *Estimator) inspect(ctx context.Context, conn Querier, rel Relation) (Inspection, error) {
+	var (
+		inspection Inspection
+		timescale  bool
+	)
+	err := conn.QueryRow(ctx, selectInspection, rel.schemaArg(), rel.Table, rel.IDColumn).
+		Scan(&inspection.HasHistogram, &inspection.TrackCommitTimestamp, &inspection.Partitioned, &timescale, &inspection.IDCorrelation)
+	if err != nil {
+		return inspection, fmt.Errorf("failed to inspect table: %w", err)
+	}
+
+	if inspection.Partitioned {
+		if inspection.Partitions, err = e.leafPartitions(ctx, conn, rel); err != nil {
+			return inspection, err
+		}
+		if inspection.PartitionKey, err = e.rangePartitionKey(ctx, conn, rel); err != nil {
+			return inspection, err
+		}
+		if inspection.PartitionKey == rel.TimeColumn {
+			if inspection.PartitionRanges, err = e.partitionRanges(ctx, conn, rel); err != nil {
+				return inspection, err
+			}
+		}
+
+		bounds, err := e.partitionHistogramBounds(ctx, conn, rel, inspection.Partitions)
+		if err != nil {
+			return inspection, err
+		}
+		inspection.HasHistogram = len(bounds) > 0
+	}
+
+	if timescale {
+		if inspection.PartitionRanges, err = e.hypertableChunks(ctx, conn, rel); err != nil {
+			return inspection, err
+		}
+		inspection.Hypertable = len(inspection.PartitionRanges) > 0
+	}
+
+	if inspection.TimeIndexMethods, err = e.timeIndexMethods(ctx, conn, rel); err != nil {
+		return inspection, err
+	}
+
+	var idDefault string
+	if inspection.IDType, idDefault, err = e.inspectID(ctx, conn, rel); err != nil {
+		return inspection, err
+	}
+	inspection.SequentialID = sequentialID(inspection.IDType, idDefault)
+	inspection.TimestampedID = timestampedID(idDefault)
+
+	return inspection, nil
+}
+
+// tableStrategies are the strategies that read only the estimation table, in
+// order of increasing cost.
+func (e *Estimator) tableStrategies() []Strategy {
+	return []Strategy{
+		timeIndexStrategy{e}, keyTimestampStrategy{e}, brinStrategy{e}, histogramStrategy{e}, tableSampleStrategy{e},
+	}
+}
+
+// selectStrategy picks the cheapest viable table strategy, refining its answer
+// with commit timestamps whenever the server tracks them, unless e.Strategy
+// forces a particular one. Forced strategies are run whether or not they look
+// viable, except in exact mode, which insists on commit timestamps.
+func (e *Estimator) selectStrategy(ctx context.Context, conn Querier, rel Relation) (Strategy, error) {
+	name := e.Strategy
+	if name == "" {
+		name = StrategyAuto
+	}
+	if e.Exact {
+		name = StrategyCommitTimestamp
+	}
+
+	if name != StrategyAuto && name != StrategyCommitTimestamp {
+		for _, strategy := range e.tableStrategies() {
+			if strategy.Name() == name {
+				return strategy, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	level.Debug(e.logger()).Log("event", "inspected_table", "has_histogram", inspection.HasHistogram,
+		"time_index_methods", fmt.Sprintf("%v", inspection.TimeIndexMethods),
+		"track_commit_timestamp", inspection.TrackCommitTimestamp,
+		"id_type", inspection.IDType, "sequential_id", inspection.SequentialID,
+		"timestamped_id", inspection.TimestampedID, "partitions", len(inspection.Partitions),
+		"hypertable", inspection.Hypertable)
+
+	if !inspection.SequentialID {
+		level.Info(e.logger()).Log("event", "id_not_sequential", "id_type", inspection.IDType,
+			"msg", "ids don't follow insertion order, so only strategies reading by time are used")
+	}
+
+	if e.Exact && !inspection.TrackCommitTimestamp {
+		return nil, ErrCommitTimestampsDisabled
+	}
+
+	var seed Strategy
+	for _, strategy := range e.tableStrategies() {
+		if strategy.Viable(inspection) {
+			seed = strategy
+			break
+		}
+	}
+
+	if name == StrategyCommitTimestamp || (inspection.TrackCommitTimestamp && !e.skipCommitTimestamps) {
+		return commitTimestampStrategy{e, seed}, nil
+	}
+
+	return seed, nil
+}
+
+type timeIndexStrategy struct{ e *Estimator }
+
+func (s timeIndexStrategy) Name() string { return StrategyTimeIndex }
+
+func (s timeIndexStrategy) Viable(i Inspection) bool { return i.TimeIndexMethods["btree"] }
+
+func (s timeIndexStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	return s.e.estimateByTimeIndex(ctx, conn, rel, t)
+}
+
+type keyTimestampStrategy struct{ e *Estimator }
+
+func (s keyTimestampStrategy) Name() string { return StrategyKeyTimestamp }
+
+func (s keyTimestampStrategy) Viable(i Inspection) bool { return i.TimestampedID }
+
+func (s keyTimestampStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	return s.e.estimateByKeyTimestamp(ctx, conn, rel, t)
+}
+
+type brinStrategy struct{ e *Estimator }
+
+func (s brinStrategy) Name() string { return StrategyBRIN }
+
+func (s brinStrategy) Viable(i Inspection) bool { return i.TimeIndexMethods["brin"] }
+
+func (s brinStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	return s.e.estimateByBRIN(ctx, conn, rel, t)
+}
+
+type histogramStrategy struct{ e *Estimator }
+
+func (s histogramStrategy) Name() string { return StrategyHistogram }
+
+func (s histogramStrategy) Viable(i Inspection) bool { return i.HasHistogram && i.SequentialID }
+
+func (s histogramStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	inspection, err := s.e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+	if !inspection.SequentialID {
+		level.Warn(s.e.logger()).Log("event", "id_not_sequential", "id_type", inspection.IDType,
+			"msg", "histogram strategy assumes ids follow insertion order, so the estimate may be wrong")
+	}
+	if err := s.e.checkCorrelation(ctx, conn, rel, inspection); err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+	if err := s.e.checkAnalyzed(ctx, conn, rel, inspection, t); err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+
+	bounds, err := s.e.histogramBounds(ctx, conn, rel)
+	if err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+
+	return s.e.estimateByBounds(ctx, conn, rel, t, s.Name(), bounds)
+}
+
+// tableSampleStrategy is always viable, but reads a sample of the whole table
+// and is only as precise as the sample is dense. When ids aren't sequential it
+// brackets the target with the sampled rows alone.
+type tableSampleStrategy struct{ e *Estimator }
+
+func (s tableSampleStrategy) Name() string { return StrategyTableSample }
+
+func (s tableSampleStrategy) Viable(Inspection) bool { return true }
+
+func (s tableSampleStrategy) Estimate(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	inspection, err := s.e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+
+	bounds, err := s.e.sampleBounds(ctx, conn, rel)
+	if err != nil {
+		return Result{TargetTime: t, Strategy: s.Name()}, err
+	}
+
+	if !inspection.SequentialID {
+		return s.e.estimateBySample(t, s.Name(), bounds)
+	}
+
+	return s.e.estimateByBounds(ctx, conn, rel, t, s.Name(), bounds)
+}
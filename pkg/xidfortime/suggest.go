@@ -0,0 +1,64 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Candidate is a table that looks suitable for estimating xids, having a
+// sequence-backed id and a timestamp defaulting to the insert time.
+type Candidate struct {
+	Schema     string  `json:"schema"`
+	Table      string  `json:"table"`
+	IDColumn   string  `json:"id_column"`
+	TimeColumn string  `json:"time_column"`
+	Inserts    int64   `json:"inserts"`
+	Updates    int64   `json:"updates"`
+	LiveRows   int64   `json:"live_rows"`
+	Score      float64 `json:"score"`
+}
+
+// UpdateRatio is the ratio of updates to inserts, where tables with few updates
+// give xmins that best reflect insert time.
+func (c Candidate) UpdateRatio() float64 {
+	if c.Inserts == 0 {
+		return 0
+	}
+
+	return float64(c.Updates) / float64(c.Inserts)
+}
+
+// SuggestTables scans the catalog for tables with a serial or identity id and
+// a timestamp column, ranking them so those with many inserts and few updates
+// come first.
+func SuggestTables(ctx context.Context, conn Querier) ([]Candidate, error) {
+	rows, err := conn.Query(ctx, selectCandidateTables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan catalog for candidate tables: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []Candidate
+	for rows.Next() {
+		var c Candidate
+		if err := rows.Scan(&c.Schema, &c.Table, &c.IDColumn, &c.TimeColumn, &c.Inserts, &c.Updates, &c.LiveRows); err != nil {
+			return nil, err
+		}
+
+		// Favour insert volume, as denser tables bracket the target more tightly,
+		// and penalise updates, which make xmin unreliable.
+		c.Score = math.Log10(float64(c.Inserts)+1) * math.Max(0, 1-c.UpdateRatio())
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	return candidates, nil
+}
@@ -0,0 +1,219 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// TimeResult is the outcome of estimating when an xid committed. Before and
+// After are the rows whose xmins bracket the xid, between which CommittedAt is
+// interpolated, unless commit timestamps recorded it exactly.
+type TimeResult struct {
+	XID         string    `json:"xid"`
+	Strategy    string    `json:"strategy"`
+	CommittedAt time.Time `json:"committed_at"`
+	Before      Row       `json:"before"`
+	After       Row       `json:"after"`
+}
+
+// Gap is the time between the rows either side of the xid, within which it
+// must have committed. It is zero for exact results.
+func (r TimeResult) Gap() time.Duration {
+	return r.After.CreatedAt.Sub(r.Before.CreatedAt)
+}
+
+// EstimateTime finds when xid committed, reading the commit timestamp if the
+// server tracks them, or otherwise interpolating between the rows of table
+// inserted either side of it.
+func (e *Estimator) EstimateTime(ctx context.Context, conn Querier, table, xid string) (TimeResult, error) {
+	logger := e.logger()
+	result := TimeResult{XID: xid}
+
+	if _, err := parseXID(xid); err != nil {
+		return result, err
+	}
+
+	rel, err := e.Relation(table)
+	if err != nil {
+		return result, err
+	}
+
+	conn, release, err := e.withSnapshot(ctx, conn)
+	if err != nil {
+		return result, err
+	}
+	defer release()
+
+	if conn, err = e.withTimeouts(conn); err != nil {
+		return result, err
+	}
+	conn = e.withRetries(conn)
+
+	if e, err = e.withServer(ctx, conn); err != nil {
+		return result, err
+	}
+
+	if err := e.validateRelation(ctx, conn, rel); err != nil {
+		return result, err
+	}
+
+	if e.Strategy == "" || e.Strategy == StrategyAuto || e.Strategy == StrategyCommitTimestamp {
+		var committedAt *time.Time
+		if err := conn.QueryRow(ctx, selectXIDCommitTimestamp, xid).Scan(&committedAt); err != nil {
+			return result, fmt.Errorf("failed to read commit timestamp: %w", err)
+		}
+		if committedAt != nil {
+			result.Strategy, result.CommittedAt = StrategyCommitTimestamp, *committedAt
+			level.Info(logger).Log("event", "estimated_time", "strategy", result.Strategy, "xid", xid, "committed_at", result.CommittedAt)
+			return result, nil
+		}
+		if e.Exact || e.Strategy == StrategyCommitTimestamp {
+			return result, fmt.Errorf("no commit timestamp recorded for xid %s", xid)
+		}
+	}
+
+	var bounds []Row
+	switch e.Strategy {
+	case StrategyTableSample:
+		result.Strategy = StrategyTableSample
+		bounds, err = e.sampleBounds(ctx, conn, rel)
+	case "", StrategyAuto, StrategyHistogram:
+		result.Strategy = StrategyHistogram
+		bounds, err = e.histogramBounds(ctx, conn, rel)
+		if errors.Is(err, ErrNoHistogram) && e.Strategy != StrategyHistogram {
+			result.Strategy = StrategyTableSample
+			bounds, err = e.sampleBounds(ctx, conn, rel)
+		}
+	default:
+		return result, fmt.Errorf("strategy %q cannot estimate time for an xid", e.Strategy)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	var next uint32
+	{
+		sql, err := e.serverSQL(ctx, conn, "selectNextXID", selectNextXID)
+		if err != nil {
+			return result, err
+		}
+
+		var nextXID int64
+		if err := conn.QueryRow(ctx, sql).Scan(&nextXID); err != nil {
+			return result, fmt.Errorf("failed to read next xid: %w", err)
+		}
+		next = uint32(nextXID)
+	}
+
+	target := xidAge(next, xid)
+	if target > math.MaxInt32 {
+		return result, fmt.Errorf("xid %s is newer than the next xid %d: %w", xid, next, ErrOutOfRange)
+	}
+
+	lower, upper, err := findXIDThresholds(bounds, next, target)
+	if err != nil {
+		return result, err
+	}
+
+	level.Debug(logger).Log("event", "found_thresholds", "min_id", lower.ID, "min_xmin", lower.XMin, "max_id", upper.ID, "max_xmin", upper.XMin)
+
+	// Ids that don't follow insertion order can't be probed between the bounds,
+	// which are then the nearest rows we know of
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return result, err
+	}
+
+	result.Before, result.After = lower, upper
+	if inspection.SequentialID {
+		if result.Before, result.After, err = e.probeXID(ctx, conn, rel, lower, upper, xid); err != nil {
+			return result, err
+		}
+	}
+
+	result.CommittedAt = interpolate(result.Before, result.After, next, target)
+
+	level.Info(logger).Log("event", "estimated_time", "strategy", result.Strategy, "xid", xid, "committed_at", result.CommittedAt,
+		"before_id", result.Before.ID, "before_xmin", result.Before.XMin,
+		"after_id", result.After.ID, "after_xmin", result.After.XMin, "gap", result.Gap())
+
+	return result, nil
+}
+
+// probeXID finds the rows between two bounds either side of xid, by id.
+func (e *Estimator) probeXID(ctx context.Context, conn Querier, rel Relation, lower, upper Row, xid string) (before, after Row, err error) {
+	data := rel.queryData()
+
+	{
+		sql, err := renderSQL("selectAtOrBeforeXID", selectAtOrBeforeXID, data)
+		if err != nil {
+			return before, after, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, lower.ID, upper.ID, xid).
+			Scan(&before.ID, &before.CreatedAt, &before.XMin); err != nil {
+			return before, after, fmt.Errorf("failed to find last row at or before xid: %w", err)
+		}
+	}
+
+	{
+		sql, err := renderSQL("selectAfterXID", selectAfterXID, data)
+		if err != nil {
+			return before, after, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, before.ID, upper.ID, xid).
+			Scan(&after.ID, &after.CreatedAt, &after.XMin); err != nil {
+			return before, after, fmt.Errorf("failed to find first row after xid: %w", err)
+		}
+	}
+
+	return before, after, nil
+}
+
+// xidAge is how many xids before next that xid was assigned, with special xids
+// treated as older than any other.
+func xidAge(next uint32, xid string) uint32 {
+	parsed, err := parseXID(xid)
+	if err != nil || parsed < 3 {
+		return math.MaxUint32
+	}
+
+	return next - parsed
+}
+
+// findXIDThresholds picks the pair of bounds adjacent in age that bracket an xid
+// of the target age.
+func findXIDThresholds(bounds []Row, next, target uint32) (lower, upper Row, err error) {
+	sort.Slice(bounds, func(i, j int) bool {
+		return xidAge(next, bounds[i].XMin) > xidAge(next, bounds[j].XMin)
+	})
+
+	// Find the youngest bound at least as old as target, and the bound after it
+	idx := sort.Search(len(bounds), func(i int) bool {
+		return xidAge(next, bounds[i].XMin) < target
+	}) - 1
+	if idx < 0 || idx+1 >= len(bounds) {
+		return lower, upper, fmt.Errorf("no bounds bracket xid: %w", ErrOutOfRange)
+	}
+
+	return bounds[idx], bounds[idx+1], nil
+}
+
+// interpolate estimates when an xid of the target age committed, assuming xids
+// were assigned at a steady rate between the rows either side of it.
+func interpolate(before, after Row, next, target uint32) time.Time {
+	beforeAge, afterAge := xidAge(next, before.XMin), xidAge(next, after.XMin)
+	if beforeAge <= afterAge || beforeAge == math.MaxUint32 {
+		return before.CreatedAt
+	}
+
+	fraction := float64(beforeAge-target) / float64(beforeAge-afterAge)
+	return before.CreatedAt.Add(time.Duration(fraction * float64(after.CreatedAt.Sub(before.CreatedAt))))
+}
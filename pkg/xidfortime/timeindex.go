@@ -0,0 +1,77 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// timeIndexMethods lists the access methods, such as btree or brin, of valid
+// non-partial indexes led by the time column.
+func (e *Estimator) timeIndexMethods(ctx context.Context, conn Querier, rel Relation) (map[string]bool, error) {
+	return indexMethods(ctx, conn, rel, rel.TimeColumn)
+}
+
+// indexMethods lists the access methods of valid non-partial indexes led by
+// column.
+func indexMethods(ctx context.Context, conn Querier, rel Relation, column string) (map[string]bool, error) {
+	var methods []string
+	if err := conn.QueryRow(ctx, selectIndexMethods, rel.queryData().Table, column).Scan(&methods); err != nil {
+		return nil, fmt.Errorf("failed to check for %s indexes: %w", column, err)
+	}
+
+	indexed := map[string]bool{}
+	for _, method := range methods {
+		indexed[method] = true
+	}
+
+	return indexed, nil
+}
+
+// estimateByTimeIndex reads the last row at or before t, and the first row
+// after it, straight from the index on the time column. This skips pg_stats
+// entirely and is exact for well-indexed tables.
+func (e *Estimator) estimateByTimeIndex(ctx context.Context, conn Querier, rel Relation, t time.Time) (Result, error) {
+	logger := e.logger()
+	result := Result{TargetTime: t, Strategy: StrategyTimeIndex}
+	data := rel.queryData()
+
+	{
+		sql, err := renderSQL("selectAfterTime", selectAfterTime, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, t).Scan(&result.Exceeded.ID, &result.Exceeded.CreatedAt, &result.Exceeded.XMin); err != nil {
+			return result, fmt.Errorf("failed to find first row past target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_past_threshold",
+		"exceeded_id", result.Exceeded.ID,
+		"exceeded_created_at", result.Exceeded.CreatedAt,
+		"exceeded_xmin", result.Exceeded.XMin,
+		"exceeded_by", result.ExceededBy())
+
+	{
+		sql, err := renderSQL("selectAtOrBeforeTime", selectAtOrBeforeTime, data)
+		if err != nil {
+			return result, err
+		}
+
+		if err = conn.QueryRow(ctx, sql, t).
+			Scan(&result.Before.ID, &result.Before.CreatedAt, &result.Before.XMin); err != nil {
+			return result, fmt.Errorf("failed to find last row before target time: %w", err)
+		}
+	}
+
+	level.Debug(logger).Log("event", "first_before_threshold",
+		"before_id", result.Before.ID,
+		"before_created_at", result.Before.CreatedAt,
+		"before_xmin", result.Before.XMin,
+		"before_by", result.BeforeBy())
+
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// beginner is satisfied by pools, connections and transactions, any of which
+// can start the transaction that SET LOCAL needs.
+type beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// timeoutQuerier runs each statement in its own read only transaction, having
+// SET LOCAL the statement and lock timeouts, so a pathological plan can't hold
+// a connection busy indefinitely.
+type timeoutQuerier struct {
+	conn    beginner
+	setting string
+}
+
+// withTimeouts wraps conn to apply the estimator's timeouts to every statement,
+// returning conn unchanged if there are none to apply.
+func (e *Estimator) withTimeouts(conn Querier) (Querier, error) {
+	var settings []string
+	if e.StatementTimeout > 0 {
+		settings = append(settings, fmt.Sprintf("set local statement_timeout = %d;", e.StatementTimeout.Milliseconds()))
+	}
+	if e.LockTimeout > 0 {
+		settings = append(settings, fmt.Sprintf("set local lock_timeout = %d;", e.LockTimeout.Milliseconds()))
+	}
+	if len(settings) == 0 {
+		return conn, nil
+	}
+
+	b, ok := conn.(beginner)
+	if !ok {
+		return nil, fmt.Errorf("timeouts need a connection that can begin transactions")
+	}
+
+	return timeoutQuerier{conn: b, setting: strings.Join(settings, " ")}, nil
+}
+
+func (q timeoutQuerier) begin(ctx context.Context) (tx pgx.Tx, err error) {
+	// Transactions of a snapshot are read only already, but those begun on a
+	// pool may not be if the session wasn't made so
+	if b, ok := q.conn.(txBeginner); ok {
+		tx, err = b.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	} else {
+		tx, err = q.conn.Begin(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, q.setting); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to set timeouts: %w", err)
+	}
+
+	return tx, nil
+}
+
+func (q timeoutQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	tx, err := q.begin(ctx)
+	if err != nil {
+		return errRow{err}
+	}
+
+	return txRow{tx: tx, ctx: ctx, row: tx.QueryRow(ctx, sql, args...)}
+}
+
+func (q timeoutQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	tx, err := q.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return txRows{Rows: rows, tx: tx, ctx: ctx}, nil
+}
+
+// txRow ends the transaction of a single row query once it has been scanned.
+// Every statement is a read, so there's nothing to commit.
+type txRow struct {
+	tx  pgx.Tx
+	ctx context.Context
+	row pgx.Row
+}
+
+func (r txRow) Scan(dest ...interface{}) error {
+	defer r.tx.Rollback(r.ctx)
+	return r.row.Scan(dest...)
+}
+
+// txRows ends the transaction of a query once its rows are closed.
+type txRows struct {
+	pgx.Rows
+	tx  pgx.Tx
+	ctx context.Context
+}
+
+func (r txRows) Close() {
+	r.Rows.Close()
+	r.tx.Rollback(r.ctx)
+}
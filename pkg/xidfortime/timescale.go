@@ -0,0 +1,32 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+)
+
+// hypertableChunks reads the time range of each chunk of a TimescaleDB
+// hypertable split by the time column, which is none if rel isn't one. The
+// hypertable itself has no statistics, so estimates run against the chunk
+// covering the target as for any time partitioned table.
+func (e *Estimator) hypertableChunks(ctx context.Context, conn Querier, rel Relation) ([]PartitionRange, error) {
+	rows, err := conn.Query(ctx, selectHypertableChunks, rel.schemaArg(), rel.Table, rel.TimeColumn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hypertable chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []PartitionRange
+	for rows.Next() {
+		var chunk PartitionRange
+		if err := rows.Scan(&chunk.Partition, &chunk.From, &chunk.To); err != nil {
+			return nil, fmt.Errorf("failed to read hypertable chunks: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hypertable chunks: %w", err)
+	}
+
+	return chunks, nil
+}
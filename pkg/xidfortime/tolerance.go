@@ -0,0 +1,95 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// ToleranceError is returned when no strategy could bracket the target time
+// within the configured tolerance. Gap is the narrowest we managed.
+type ToleranceError struct {
+	Tolerance time.Duration
+	Gap       time.Duration
+}
+
+func (e *ToleranceError) Error() string {
+	return fmt.Sprintf("could not narrow estimate to within tolerance %s, best gap was %s", e.Tolerance, e.Gap)
+}
+
+// narrow retries an estimate whose gap exceeds the tolerance, first with more
+// thorough settings for the same strategy, then with the other viable
+// strategies, returning the first result within tolerance. If none are, it
+// returns the narrowest result alongside a ToleranceError.
+func (e *Estimator) narrow(ctx context.Context, conn Querier, rel Relation, t time.Time, result Result) (Result, error) {
+	logger := e.logger()
+	best := result
+
+	attempts, err := e.narrowings(ctx, conn, rel, result.Strategy)
+	if err != nil {
+		return best, err
+	}
+
+	for _, attempt := range attempts {
+		level.Debug(logger).Log("event", "narrowing", "gap", best.Gap(), "tolerance", e.Tolerance,
+			"strategy", attempt.Strategy, "refine", attempt.Refine, "sample_percent", attempt.samplePercent())
+
+		narrowed, err := attempt.estimate(ctx, conn, rel, t)
+		if err != nil {
+			if ctx.Err() != nil {
+				return best, err
+			}
+
+			level.Warn(logger).Log("event", "narrowing_failed", "strategy", attempt.Strategy, "error", err)
+			continue
+		}
+
+		if narrowed.Gap() < best.Gap() {
+			best = narrowed
+		}
+		if best.Gap() <= e.Tolerance {
+			return best, nil
+		}
+	}
+
+	return best, &ToleranceError{Tolerance: e.Tolerance, Gap: best.Gap()}
+}
+
+// narrowings lists copies of the estimator configured to try harder, in the
+// order they should be tried. Each forces its strategy, so it can't select the
+// one that has already failed us.
+func (e *Estimator) narrowings(ctx context.Context, conn Querier, rel Relation, strategy string) ([]*Estimator, error) {
+	var attempts []*Estimator
+	with := func(strategy string, refine bool, samplePercent float64) {
+		attempt := *e
+		attempt.Strategy, attempt.Refine, attempt.SamplePercent, attempt.Tolerance = strategy, refine, samplePercent, 0
+		attempts = append(attempts, &attempt)
+	}
+
+	switch strategy {
+	case StrategyHistogram, StrategyCommitTimestamp:
+		if !e.Refine {
+			with(strategy, true, e.SamplePercent)
+		}
+	case StrategyTableSample:
+		for percent := e.samplePercent() * 2; percent < 100; percent *= 2 {
+			with(strategy, true, percent)
+		}
+		with(strategy, true, 100)
+	}
+
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, other := range e.tableStrategies() {
+		if other.Name() != strategy && other.Viable(inspection) {
+			with(other.Name(), true, e.SamplePercent)
+		}
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,37 @@
+package xidfortime
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+// instrumentationName identifies spans created by this package
+const instrumentationName = "github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+
+// startSpan starts a span for a stage of the estimate from the global trace
+// provider, which drops spans unless the application has registered one.
+func startSpan(ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, first recording err if there was one.
+func endSpan(ctx context.Context, span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(ctx, err, trace.WithErrorStatus(codes.Unknown))
+	}
+
+	span.End()
+}
+
+// traced runs fn within a span named for a stage of the estimate.
+func traced(ctx context.Context, name string, fn func(context.Context) error, attrs ...label.KeyValue) error {
+	ctx, span := startSpan(ctx, name, attrs...)
+	err := fn(ctx)
+	endSpan(ctx, span, err)
+
+	return err
+}
@@ -0,0 +1,252 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// TrackingTable is the table samples of the time, xid and LSN are recorded to,
+// for exact lookups that don't rely on application tables.
+const TrackingTable = "xid_time_log"
+
+// DefaultTrackingSchema is the schema the tracking table is created in, unless
+// another is configured.
+const DefaultTrackingSchema = "public"
+
+// Execer is a Querier that can also run statements that write, as installing
+// and recording to the tracking table needs.
+type Execer interface {
+	Querier
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Sample is a point on the mapping between time and xids, recording the xid
+// and LSN of a transaction along with when it happened.
+type Sample struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	XID        string    `json:"xid"`
+	LSN        string    `json:"lsn"`
+}
+
+// trackingData is passed to templates for the tracking table, with
+// identifiers already quoted. Fields after the identifiers are SQL
+// expressions for the functions of the server.
+type trackingData struct {
+	Schema  string
+	Table   string
+	Index   string
+	XIDType string
+
+	CurrentXID string
+	CurrentLSN string
+}
+
+func newTrackingData(schema string, server Server) trackingData {
+	data := trackingData{
+		Schema:     pgx.Identifier{schema}.Sanitize(),
+		Table:      pgx.Identifier{schema, TrackingTable}.Sanitize(),
+		Index:      pgx.Identifier{TrackingTable + "_recorded_at_idx"}.Sanitize(),
+		XIDType:    "bigint",
+		CurrentXID: "txid_current()",
+		CurrentLSN: "pg_current_wal_lsn()",
+	}
+	if server.XID8() {
+		data.XIDType, data.CurrentXID = "xid8", "pg_current_xact_id()"
+	}
+	if server.Version < 100000 {
+		data.CurrentLSN = "pg_current_xlog_location()"
+	}
+
+	return data
+}
+
+// InstallTracking creates the tracking table in schema if it doesn't already
+// exist, granting readers permission to look up samples and recorders
+// permission to record and compact them. Run it in a transaction, so a failed grant
+// leaves nothing half installed.
+func InstallTracking(ctx context.Context, conn Execer, schema string, readers, recorders []string) error {
+	server, err := DetectServer(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	data := newTrackingData(schema, server)
+	for idx, src := range createTrackingTable {
+		sql, err := renderSQL(fmt.Sprintf("createTrackingTable%d", idx), src, data)
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create tracking table: %w", err)
+		}
+	}
+
+	grants := make([]string, 0, 2*(len(readers)+len(recorders)))
+	for _, role := range append(readers, recorders...) {
+		grants = append(grants, fmt.Sprintf("grant usage on schema %s to %s;", data.Schema, pgx.Identifier{role}.Sanitize()))
+	}
+	for _, role := range readers {
+		grants = append(grants, fmt.Sprintf("grant select on %s to %s;", data.Table, pgx.Identifier{role}.Sanitize()))
+	}
+	for _, role := range recorders {
+		grants = append(grants, fmt.Sprintf("grant select, insert, delete on %s to %s;", data.Table, pgx.Identifier{role}.Sanitize()))
+	}
+
+	for _, grant := range grants {
+		if _, err := conn.Exec(ctx, grant); err != nil {
+			return fmt.Errorf("failed to grant access to tracking table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RecordSample inserts a sample of the current time, xid and LSN into the
+// tracking table in schema. Tracking the xid assigns one, so each sample uses
+// up an xid of its own.
+func RecordSample(ctx context.Context, conn Execer, schema string) (Sample, error) {
+	server, err := DetectServer(ctx, conn)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	sql, err := renderSQL("insertTrackingSample", insertTrackingSample, newTrackingData(schema, server))
+	if err != nil {
+		return Sample{}, err
+	}
+
+	var sample Sample
+	if err := conn.QueryRow(ctx, sql).Scan(&sample.RecordedAt, &sample.XID, &sample.LSN); err != nil {
+		return sample, fmt.Errorf("failed to record sample: %w", err)
+	}
+
+	return sample, nil
+}
+
+// CurrentSample reads a sample of the current time, xid and LSN, like
+// RecordSample but for storing outside the database. It still assigns an xid.
+func CurrentSample(ctx context.Context, conn Querier) (Sample, error) {
+	server, err := DetectServer(ctx, conn)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	sql, err := renderSQL("selectCurrentSample", selectCurrentSample, newTrackingData(DefaultTrackingSchema, server))
+	if err != nil {
+		return Sample{}, err
+	}
+
+	var sample Sample
+	if err := conn.QueryRow(ctx, sql).Scan(&sample.RecordedAt, &sample.XID, &sample.LSN); err != nil {
+		return sample, fmt.Errorf("failed to read sample: %w", err)
+	}
+
+	return sample, nil
+}
+
+// ErrTrackingUnavailable is returned when the tracking-table strategy is
+// forced but there is no tracking table to read samples from.
+var ErrTrackingUnavailable = errors.New("tracking table not found, create it with init")
+
+// estimateByTracking interpolates an xid between the samples of the tracking
+// table either side of t, assuming xids were assigned at a steady rate between
+// them. It reports false, to estimate from the table instead, unless the
+// tracking table exists and has samples on both sides of t, as for times
+// before tracking started. Forcing the strategy makes those cases errors.
+func (e *Estimator) estimateByTracking(ctx context.Context, conn Querier, t time.Time) (Result, bool, error) {
+	result := Result{TargetTime: t, Strategy: StrategyTracking}
+	forced := e.Strategy == StrategyTracking
+	if e.Exact || (!forced && e.Strategy != "" && e.Strategy != StrategyAuto) {
+		return result, false, nil
+	}
+
+	data := newTrackingData(e.trackingSchema(), Server{})
+	var exists bool
+	if err := conn.QueryRow(ctx, selectTrackingTable, data.Table).Scan(&exists); err != nil {
+		return result, false, fmt.Errorf("failed to check for tracking table: %w", err)
+	}
+	if !exists {
+		if forced {
+			return result, false, ErrTrackingUnavailable
+		}
+
+		return result, false, nil
+	}
+
+	sql, err := renderSQL("selectTrackingSamples", selectTrackingSamples, data)
+	if err != nil {
+		return result, false, err
+	}
+
+	rows, err := conn.Query(ctx, sql, t)
+	if err != nil {
+		return result, false, fmt.Errorf("failed to read tracking samples: %w", err)
+	}
+	defer rows.Close()
+
+	var before, after *Sample
+	for rows.Next() {
+		var sample Sample
+		if err := rows.Scan(&sample.RecordedAt, &sample.XID, &sample.LSN); err != nil {
+			return result, false, fmt.Errorf("failed to read tracking samples: %w", err)
+		}
+		if sample.RecordedAt.After(t) {
+			after = &sample
+		} else {
+			before = &sample
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, false, fmt.Errorf("failed to read tracking samples: %w", err)
+	}
+
+	if before == nil || after == nil {
+		err := fmt.Errorf("no tracking samples either side of %s: %w", t.Format(time.RFC3339Nano), ErrOutOfRange)
+		if forced {
+			return result, false, err
+		}
+
+		level.Info(e.logger()).Log("event", "tracking_out_of_range", "has_before", before != nil, "has_after", after != nil,
+			"msg", "estimating from the table instead")
+		return result, false, nil
+	}
+
+	lower, err := strconv.ParseUint(before.XID, 10, 64)
+	if err != nil {
+		return result, false, fmt.Errorf("invalid sample xid %q: %w", before.XID, err)
+	}
+	upper, err := strconv.ParseUint(after.XID, 10, 64)
+	if err != nil {
+		return result, false, fmt.Errorf("invalid sample xid %q: %w", after.XID, err)
+	}
+
+	// Samples recorded out of order, as after restoring a cluster without its
+	// tracking table, give no range to interpolate within
+	xid := lower
+	if upper > lower {
+		elapsed := float64(t.Sub(before.RecordedAt)) / float64(after.RecordedAt.Sub(before.RecordedAt))
+		xid += uint64(elapsed * float64(upper-lower))
+	}
+
+	result.Before = sampleRow(*before, lower)
+	result.Exceeded = sampleRow(*after, upper)
+	result.InterpolatedXID = strconv.FormatUint(xid&0xFFFFFFFF, 10)
+
+	level.Info(e.logger()).Log("event", "interpolated_tracking_samples", "lower_xid", lower, "upper_xid", upper,
+		"interpolated_xid", xid, "gap", result.Gap())
+	return result, true, nil
+}
+
+// sampleRow is a sample with full xid as a Row either side of a target,
+// identified by its LSN.
+func sampleRow(s Sample, xid uint64) Row {
+	return Row{ID: s.LSN, CreatedAt: s.RecordedAt, XMin: strconv.FormatUint(xid&0xFFFFFFFF, 10)}
+}
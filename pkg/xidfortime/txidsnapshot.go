@@ -0,0 +1,113 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// ErrSnapshotNeedsCommitTimestamps is returned when asked for a txid_snapshot
+// from a server that isn't running with track_commit_timestamp=on.
+var ErrSnapshotNeedsCommitTimestamps = errors.New("txid snapshots require track_commit_timestamp=on")
+
+// txidSnapshot approximates the snapshot a transaction starting at the target
+// time would have taken, in the epoch-qualified xmin:xmax:xip_list form of
+// txid_current_snapshot. The commit timestamps of the xids within
+// commitTimestampWindow of the estimate decide what had committed by then:
+// xmax follows the newest xid to have committed, and the xids before it that
+// committed later, or never did, are in progress. Aborted xids are listed with
+// them, being invisible either way, while transactions running since before
+// the window are taken to have finished.
+func (e *Estimator) txidSnapshot(ctx context.Context, conn Querier, result Result) (string, error) {
+	var tracked bool
+	if err := conn.QueryRow(ctx, selectTrackCommitTimestamp).Scan(&tracked); err != nil {
+		return "", fmt.Errorf("failed to check track_commit_timestamp: %w", err)
+	}
+	if !tracked {
+		return "", ErrSnapshotNeedsCommitTimestamps
+	}
+
+	centre, err := parseXID(result.XID())
+	if err != nil {
+		return "", err
+	}
+
+	next, err := e.NextFullXID(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	// Never look past the last xid assigned, whose successors have no commit
+	// timestamps to read yet
+	start, count := centre-commitTimestampWindow, uint32(2*commitTimestampWindow)
+	if before := uint64(uint32(next) - start); before >= next {
+		start = 3 // the first normal xid, on clusters younger than the window
+	}
+	if assigned := uint32(next) - 1 - start; assigned < count {
+		count = assigned
+	}
+
+	rows, err := conn.Query(ctx, selectWindowCommitTimestamps, int64(start), int64(count))
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit timestamps: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		offsets     []uint32
+		committedAt []*time.Time
+	)
+	for rows.Next() {
+		var (
+			offset int64
+			at     *time.Time
+		)
+		if err := rows.Scan(&offset, &at); err != nil {
+			return "", fmt.Errorf("failed to read commit timestamps: %w", err)
+		}
+
+		offsets, committedAt = append(offsets, uint32(offset)), append(committedAt, at)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read commit timestamps: %w", err)
+	}
+
+	newest := -1
+	for idx, at := range committedAt {
+		if at != nil && !at.After(result.TargetTime) {
+			newest = idx
+		}
+	}
+	if newest < 0 {
+		return "", fmt.Errorf("no xid within %d of %d committed before the target time", commitTimestampWindow, centre)
+	}
+
+	// Offsets are from start in uint32 arithmetic, so full xids are taken from
+	// the next xid as fullXID does, surviving any wraparound in the window
+	full := func(offset uint32) uint64 {
+		return next - uint64(uint32(next)-(start+offset))
+	}
+
+	xmax := full(offsets[newest]) + 1
+	var xip []string
+	for idx := 0; idx < newest; idx++ {
+		if at := committedAt[idx]; at == nil || at.After(result.TargetTime) {
+			xip = append(xip, strconv.FormatUint(full(offsets[idx]), 10))
+		}
+	}
+
+	xmin := strconv.FormatUint(xmax, 10)
+	if len(xip) > 0 {
+		xmin = xip[0]
+	}
+
+	snapshot := fmt.Sprintf("%s:%d:%s", xmin, xmax, strings.Join(xip, ","))
+	level.Info(e.logger()).Log("event", "built_txid_snapshot", "txid_snapshot", snapshot, "in_progress", len(xip))
+
+	return snapshot, nil
+}
@@ -0,0 +1,96 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// randomIDDefaults are the functions whose ids have no relation to the order
+// rows were inserted in.
+var randomIDDefaults = []string{"gen_random_uuid(", "uuid_generate_v4(", "random("}
+
+// sequentialID reports whether ids of the given type and column default are
+// assigned in insertion order. Integers and textual ids such as ksuids are
+// assumed to be, unless their default generates them at random, and uuids are
+// assumed not to be unless they embed a timestamp.
+func sequentialID(idType, idDefault string) bool {
+	if timestampedID(idDefault) {
+		return true
+	}
+	if idType == "uuid" {
+		return false
+	}
+
+	for _, fn := range randomIDDefaults {
+		if strings.Contains(idDefault, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inspectID reads the type and default of the id column.
+func (e *Estimator) inspectID(ctx context.Context, conn Querier, rel Relation) (idType, idDefault string, err error) {
+	if err := conn.QueryRow(ctx, selectIDColumn, rel.queryData().Table, rel.IDColumn).Scan(&idType, &idDefault); err != nil {
+		return "", "", fmt.Errorf("failed to inspect id column: %w", err)
+	}
+
+	return idType, idDefault, nil
+}
+
+// rowOrder returns the query data to walk rel in insertion order, which is by
+// id unless ids aren't sequential, when it's by time instead. The key gives
+// the value of a row in that order.
+func (e *Estimator) rowOrder(ctx context.Context, conn Querier, rel Relation) (queryData, func(Row) interface{}, error) {
+	inspection, err := e.Inspect(ctx, conn, rel)
+	if err != nil {
+		return queryData{}, nil, err
+	}
+
+	if inspection.SequentialID {
+		return rel.queryData(), func(row Row) interface{} { return row.ID }, nil
+	}
+
+	return rel.queryData().orderedByTime(), func(row Row) interface{} { return row.CreatedAt }, nil
+}
+
+// estimateBySample brackets t with the sampled rows themselves, for tables
+// whose ids say nothing about insertion order and so can't be probed between
+// bounds. The estimate is only as precise as the sample is dense.
+func (e *Estimator) estimateBySample(t time.Time, strategy string, sample []Row) (Result, error) {
+	result := Result{TargetTime: t, Strategy: strategy}
+
+	sort.Slice(sample, func(i, j int) bool {
+		return sample[i].CreatedAt.Before(sample[j].CreatedAt)
+	})
+
+	idx := sort.Search(len(sample), func(i int) bool {
+		return sample[i].CreatedAt.After(t)
+	})
+	switch {
+	case len(sample) == 0:
+		return result, fmt.Errorf("no sampled rows to bracket target time %s", t)
+	case idx == 0:
+		return result, fmt.Errorf("target time %s predates every sampled row: %w", t, ErrOutOfRange)
+	case idx == len(sample):
+		return result, fmt.Errorf("target time %s is after every sampled row: %w", t, ErrOutOfRange)
+	}
+
+	result.Before, result.Exceeded = sample[idx-1], sample[idx]
+	result.Thresholds = Thresholds{
+		MinID: result.Before.ID, MinCreatedAt: result.Before.CreatedAt,
+		MaxID: result.Exceeded.ID, MaxCreatedAt: result.Exceeded.CreatedAt,
+	}
+
+	level.Debug(e.logger()).Log("event", "bracketed_by_sample", "sampled", len(sample),
+		"before_id", result.Before.ID, "before_created_at", result.Before.CreatedAt,
+		"exceeded_id", result.Exceeded.ID, "exceeded_created_at", result.Exceeded.CreatedAt)
+
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+// Policies for tables with many updates, whose xmins reflect the transaction
+// that last updated each row rather than the one that inserted it.
+const (
+	UpdatePolicyWarn   = "warn"
+	UpdatePolicyRefuse = "refuse"
+	UpdatePolicySample = "sample"
+)
+
+// UpdatePolicies lists the valid update policies.
+var UpdatePolicies = []string{UpdatePolicyWarn, UpdatePolicyRefuse, UpdatePolicySample}
+
+const (
+	// DefaultUpdateRatio is the ratio of updates to inserts above which a table
+	// is considered heavily updated.
+	DefaultUpdateRatio = 0.1
+	// updateSampleRows is how many rows up to the Before row are sampled under
+	// the sample policy.
+	updateSampleRows = 100
+)
+
+// UpdateRatioError is returned under the refuse policy when the table is too
+// heavily updated to trust its xmins.
+type UpdateRatioError struct {
+	Inserts, Updates int64
+	Threshold        float64
+}
+
+func (e *UpdateRatioError) Error() string {
+	return fmt.Sprintf("table has %d updates to %d inserts, above the ratio of %.2f where xmin reflects updates",
+		e.Updates, e.Inserts, e.Threshold)
+}
+
+// checkUpdates compares inserts and updates from pg_stat_user_tables, and
+// reports whether the table is heavily updated, in which case xmins may belong
+// to later updates rather than the original inserts.
+func (e *Estimator) checkUpdates(ctx context.Context, conn Querier, rel Relation) (bool, error) {
+	inserts, updates, err := updateStats(ctx, conn, rel)
+	if err != nil {
+		return false, err
+	}
+
+	threshold := e.updateRatio()
+	if inserts == 0 || float64(updates)/float64(inserts) <= threshold {
+		return false, nil
+	}
+
+	if e.UpdatePolicy == UpdatePolicyRefuse {
+		return true, &UpdateRatioError{Inserts: inserts, Updates: updates, Threshold: threshold}
+	}
+
+	level.Warn(e.logger()).Log("event", "heavily_updated", "inserts", inserts, "updates", updates,
+		"msg", "xmin reflects the last update of each row, so the estimate may be too recent")
+
+	return true, nil
+}
+
+// updateStats reads the inserts and updates counted by pg_stat_user_tables,
+// which are both zero for tables it doesn't track.
+func updateStats(ctx context.Context, conn Querier, rel Relation) (inserts, updates int64, err error) {
+	err = conn.QueryRow(ctx, selectUpdateStats, rel.queryData().Table).Scan(&inserts, &updates)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+
+	return inserts, updates, nil
+}
+
+func (e *Estimator) updateRatio() float64 {
+	if e.UpdateRatio <= 0 {
+		return DefaultUpdateRatio
+	}
+
+	return e.UpdateRatio
+}
+
+// sampleMinimumXMin replaces the Before row with whichever of the rows leading
+// up to it has the oldest xmin. Updated rows have xmins newer than their
+// insert, so the oldest is the most robust estimate of inserts at that point.
+// Frozen xmins are ignored.
+func (e *Estimator) sampleMinimumXMin(ctx context.Context, conn Querier, rel Relation, result Result) (Result, error) {
+	data, key, err := e.rowOrder(ctx, conn, rel)
+	if err != nil {
+		return result, err
+	}
+
+	sql, err := renderSQL("selectRowsUpTo", selectRowsUpTo, data)
+	if err != nil {
+		return result, err
+	}
+
+	var (
+		ids        []string
+		createdAts []time.Time
+		xmins      []string
+	)
+	if err := conn.QueryRow(ctx, sql, key(result.Before), updateSampleRows).Scan(&ids, &createdAts, &xmins); err != nil {
+		return result, fmt.Errorf("failed to sample rows before threshold: %w", err)
+	}
+
+	reference, err := parseXID(result.Before.XMin)
+	if err != nil {
+		return result, err
+	}
+
+	// Compare xids relative to the Before row, which is correct across a
+	// wraparound so long as they are within 2^31 of each other.
+	oldest, oldestAge := result.Before, int32(0)
+	for idx := range ids {
+		if isSpecialXID(xmins[idx]) {
+			continue
+		}
+
+		xmin, err := parseXID(xmins[idx])
+		if err != nil {
+			return result, err
+		}
+
+		if age := int32(reference - xmin); age > oldestAge {
+			oldest, oldestAge = Row{ID: ids[idx], CreatedAt: createdAts[idx], XMin: xmins[idx]}, age
+		}
+	}
+
+	level.Debug(e.logger()).Log("event", "sampled_minimum_xmin", "sampled", len(ids),
+		"before_id", oldest.ID, "before_xmin", oldest.XMin, "xids_older", oldestAge)
+
+	result.Before = oldest
+	return result, nil
+}
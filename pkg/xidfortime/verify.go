@@ -0,0 +1,63 @@
+package xidfortime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// maxVerifyWalk is how many xids we walk back from the estimate looking for
+// one that committed.
+const maxVerifyWalk = 10000
+
+// Transaction statuses reported by txid_status and pg_xact_status. Status is
+// unknown once the xid is too old for the server to remember.
+const (
+	XIDStatusCommitted  = "committed"
+	XIDStatusAborted    = "aborted"
+	XIDStatusInProgress = "in progress"
+	XIDStatusUnknown    = "unknown"
+)
+
+// verifyCommitted checks the status of the estimated xid, which on heavily
+// updated tables may belong to a transaction that aborted. If it didn't commit
+// we walk back to the nearest xid that did. Servers older than Postgres 10 have
+// no way to query xid status, and are left unverified.
+func (e *Estimator) verifyCommitted(ctx context.Context, conn Querier, result Result) (Result, error) {
+	server, err := e.server(ctx, conn)
+	if err != nil {
+		return result, err
+	}
+	if !server.XIDStatus() {
+		level.Warn(e.logger()).Log("event", "skipped_verify", "msg", "server has no xid status function",
+			"server_version", server.Version)
+		return result, nil
+	}
+
+	sql, err := renderSQL("selectCommittedXID", selectCommittedXID, server.queryData())
+	if err != nil {
+		return result, err
+	}
+
+	xid := result.XID()
+	var (
+		offset    int64
+		committed string
+		status    string
+	)
+	if err := conn.QueryRow(ctx, sql, xid, maxVerifyWalk).Scan(&offset, &committed, &status); err != nil {
+		return result, fmt.Errorf("failed to verify xid %s committed: %w", xid, err)
+	}
+
+	result.XIDStatus = status
+	if offset > 0 {
+		level.Warn(e.logger()).Log("event", "walked_back_to_committed", "estimated_xid", xid,
+			"committed_xid", committed, "walked", offset)
+		result.CommittedXID, result.CommittedAt = committed, nil
+	}
+
+	level.Info(e.logger()).Log("event", "verified_xid", "xid", result.XID(), "status", status)
+
+	return result, nil
+}
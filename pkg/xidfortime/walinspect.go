@@ -0,0 +1,100 @@
+package xidfortime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"github.com/lawrencejones/xid-for-time/pkg/wal"
+)
+
+// ErrWALInspectUnavailable is returned when asked for an LSN on a server
+// without pg_walinspect, which needs Postgres 15 or later.
+var ErrWALInspectUnavailable = errors.New("pg_walinspect is not installed, and needs Postgres 15 or later")
+
+// walScanSegments is how many WAL segments are read at a time when searching
+// back for a commit record.
+const walScanSegments = 16
+
+// CommitLSN finds the LSN at which the commit record of xid starts, using
+// pg_walinspect to search back from the current end of WAL to the oldest
+// segment still in pg_wal. Targets are usually recent, so the search reads
+// the newest WAL first, and fails if the commit has already been recycled.
+func (e *Estimator) CommitLSN(ctx context.Context, conn Querier, xid string) (string, error) {
+	if _, err := parseXID(xid); err != nil {
+		return "", err
+	}
+
+	server, err := e.server(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	if !server.WALInspectRecords() {
+		return "", ErrWALInspectUnavailable
+	}
+
+	var (
+		current, oldestSegment string
+		segmentSize            int64
+	)
+	if err := conn.QueryRow(ctx, selectWALRange).Scan(&current, &oldestSegment, &segmentSize); err != nil {
+		return "", fmt.Errorf("failed to read WAL range: %w", err)
+	}
+
+	currentLSN, err := wal.ParseLSN(current)
+	if err != nil {
+		return "", err
+	}
+	end := uint64(currentLSN)
+	oldest, err := segmentLSN(oldestSegment, segmentSize)
+	if err != nil {
+		return "", err
+	}
+
+	step, scanned := uint64(segmentSize)*walScanSegments, uint64(0)
+	for end > oldest {
+		start := oldest
+		if end-oldest > step {
+			start = end - step
+		}
+
+		var lsn string
+		err := conn.QueryRow(ctx, selectCommitRecord, wal.LSN(start).String(), wal.LSN(end).String(), xid).Scan(&lsn)
+		scanned += end - start
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			end = start
+			continue
+		case err != nil:
+			return "", fmt.Errorf("failed to read WAL records: %w", err)
+		}
+
+		level.Debug(e.logger()).Log("event", "found_commit_record", "xid", xid, "lsn", lsn,
+			"scanned_bytes", scanned)
+		return lsn, nil
+	}
+
+	return "", fmt.Errorf("no commit record for xid %s in WAL from %s to %s", xid, wal.LSN(oldest), current)
+}
+
+// segmentLSN is the LSN at the start of a WAL segment file, named by its
+// timeline, then the high 32 bits of its LSN and its segment within those.
+func segmentLSN(name string, segmentSize int64) (uint64, error) {
+	if len(name) != 24 || segmentSize <= 0 {
+		return 0, fmt.Errorf("invalid WAL segment %q", name)
+	}
+
+	log, err := strconv.ParseUint(name[8:16], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WAL segment %q: %w", name, err)
+	}
+	segment, err := strconv.ParseUint(name[16:], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WAL segment %q: %w", name, err)
+	}
+
+	return log<<32 + segment*uint64(segmentSize), nil
+}
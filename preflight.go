@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	preflight           = app.Command("preflight", "Check a table, and the server, are set up for estimates, reporting each as pass, warn or fail")
+	preflightTable      = preflight.Arg("table", "Table to check, unless given by --target").String()
+	preflightIDColumn   = preflight.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	preflightTimeColumn = preflight.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	preflightFormat     = preflight.Flag("format", "Format of the report written to stdout").Default("table").Enum("table", formatJSON)
+)
+
+func runPreflight(ctx context.Context) {
+	if *preflightTable == "" {
+		kingpin.Fatalf("required argument 'table' not provided, nor by --target")
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *preflightIDColumn
+	estimator.TimeColumn = *preflightTimeColumn
+
+	checks, err := estimator.Preflight(ctx, conn, *preflightTable)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *preflightFormat == formatJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(checks); err != nil {
+			kingpin.Fatalf("failed to write report: %v", err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+		for _, check := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, check.Detail)
+		}
+		w.Flush()
+	}
+
+	if xidfortime.Failed(checks) {
+		kingpin.Fatalf("preflight checks failed")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	record         = app.Command("record", "Insert samples of the time, xid and LSN into the tracking table, on an interval or once for cron")
+	recordSchema   = record.Flag("schema", "Schema of the tracking table, as created by init").Default(xidfortime.DefaultTrackingSchema).String()
+	recordInterval = record.Flag("interval", "How often to record a sample").Default("1m").Duration()
+	recordJitter   = record.Flag("jitter", "Most to randomly delay each sample by, so samples from many databases don't line up").Default("5s").Duration()
+	recordOnce     = record.Flag("once", "Record a single sample and exit, as when scheduled by cron").Bool()
+	recordOutput   = record.Flag("output", "Also append samples to this file as JSON lines, as track does").String()
+	recordTable    = record.Flag("table", "Insert samples into the tracking table, disable with --no-table to only write --output").Default("true").Bool()
+	recordCompact  = record.Flag("compact-every", "How often to compact the tracking table as by compact, or never when zero").Duration()
+
+	recordCompaction = addCompactionFlags(record)
+)
+
+func runRecord(ctx context.Context) {
+	if *recordInterval <= 0 && !*recordOnce {
+		kingpin.Fatalf("--interval must be positive")
+	}
+	if *recordJitter < 0 {
+		kingpin.Fatalf("--jitter must not be negative")
+	}
+	if !*recordTable && *recordOutput == "" {
+		kingpin.Fatalf("--no-table needs --output to record samples to")
+	}
+	if !*recordTable && *recordCompact > 0 {
+		kingpin.Fatalf("--compact-every compacts the tracking table, so can't be used with --no-table")
+	}
+	tiers, err := recordCompaction.parse()
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+
+	// Samples are read from the database either way, so only the file needs
+	// no objects created in it
+	var store sampleStore
+	if *recordOutput != "" {
+		file, err := openSampleFile(*recordOutput)
+		if err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+		defer file.Close()
+
+		store = file
+	}
+
+	pool, err := connectWritable(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer pool.Close()
+
+	var (
+		failures  int
+		compacted time.Time
+	)
+	for {
+		var sample xidfortime.Sample
+		err := retryPolicy().Do(ctx, logger, "record", func() (err error) {
+			if !*recordTable {
+				sample, err = xidfortime.CurrentSample(ctx, pool)
+				return err
+			}
+
+			sample, err = xidfortime.RecordSample(ctx, pool, *recordSchema)
+			return err
+		})
+		if err == nil && store != nil {
+			err = store.record(ctx, []xidfortime.Sample{sample})
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			failures = 0
+			level.Info(logger).Log("event", "recorded_sample", "recorded_at", sample.RecordedAt, "xid", sample.XID, "lsn", sample.LSN)
+		// Missing tables and permissions won't fix themselves, so only keep
+		// going after failures that outlasted the retries
+		case *recordOnce || !xidfortime.IsTransient(err):
+			fatal(err)
+		default:
+			failures++
+			level.Error(logger).Log("event", "record_failed", "consecutive_failures", failures, "error", err)
+		}
+
+		if *recordOnce {
+			return
+		}
+
+		// Compaction is housekeeping, so failures are only logged and tried
+		// again after another --compact-every
+		if *recordCompact > 0 && time.Since(compacted) >= *recordCompact {
+			compacted = time.Now()
+			compaction, err := xidfortime.CompactTracking(ctx, pool, *recordSchema, tiers, *recordCompaction.retain)
+			if err != nil {
+				level.Error(logger).Log("event", "compact_failed", "error", err)
+			} else {
+				level.Info(logger).Log("event", "compacted_tracking_table", "thinned", compaction.Thinned, "expired", compaction.Expired)
+			}
+		}
+
+		delay := *recordInterval
+		if *recordJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(*recordJitter) + 1))
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
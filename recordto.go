@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// resultRecorder inserts every estimate into the results table of --record-to,
+// keeping an auditable history of the recovery points computed. Results are
+// recorded against the source they were estimated on.
+type resultRecorder struct {
+	pool   *pgxpool.Pool
+	schema string
+	source string
+}
+
+// newResultRecorder connects to connStr, creating the results table in schema
+// should it not already exist.
+func newResultRecorder(ctx context.Context, connStr, schema, source string) (*resultRecorder, error) {
+	pool, err := connectWritableDSN(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := xidfortime.InstallResults(ctx, pool, schema); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &resultRecorder{pool: pool, schema: schema, source: source}, nil
+}
+
+func (r *resultRecorder) Close() {
+	r.pool.Close()
+}
+
+// withSource is the recorder for results estimated on another source, such as
+// a shard or Citus node, sharing the same connection.
+func (r *resultRecorder) withSource(source string) *resultRecorder {
+	other := *r
+	other.source = source
+	return &other
+}
+
+func (r *resultRecorder) record(ctx context.Context, table string, result xidfortime.Result, elapsed time.Duration) error {
+	id, err := xidfortime.RecordResult(ctx, r.pool, r.schema, xidfortime.RecordedResult{
+		Source:  r.source,
+		Table:   table,
+		Result:  result,
+		Elapsed: elapsed,
+	})
+	if err != nil {
+		return err
+	}
+
+	level.Info(logger).Log("event", "recorded_result", "id", id, "source", r.source, "target_time", result.TargetTime, "xid", result.XID())
+	return nil
+}
+
+// poolSource names the database a pool connects to, by host, port and database
+// so that no password is recorded.
+func poolSource(pool *pgxpool.Pool) string {
+	cfg := pool.Config().ConnConfig
+	return fmt.Sprintf("%s:%d/%s", cfg.Host, cfg.Port, cfg.Database)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// activeReport collects what the run did for --report, when asked for one.
+var activeReport *runReport
+
+// runReport captures everything an estimate did, to be attached to incident
+// tickets: the inputs, every statement run, every log including the debug
+// events carrying intermediate rows, and the results. It's written once the
+// run exits, however it exits.
+type runReport struct {
+	path string
+	once sync.Once
+
+	mu        sync.Mutex
+	Version   string                   `json:"version"`
+	StartedAt time.Time                `json:"started_at"`
+	EndedAt   time.Time                `json:"ended_at"`
+	Elapsed   string                   `json:"elapsed"`
+	Status    int                      `json:"exit_status"`
+	Error     string                   `json:"error,omitempty"`
+	Inputs    reportInputs             `json:"inputs"`
+	Results   []reportResult           `json:"results"`
+	Warnings  []map[string]interface{} `json:"warnings"`
+	Events    []map[string]interface{} `json:"events"`
+	Queries   []reportQuery            `json:"queries"`
+}
+
+// reportInputs are the settings an estimate was asked for, leaving out the
+// connection flags that may carry passwords.
+type reportInputs struct {
+	Table       string   `json:"table"`
+	TargetTimes []string `json:"target_times,omitempty"`
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	IDColumn    string   `json:"id_column"`
+	TimeColumn  string   `json:"time_column"`
+	Schema      string   `json:"schema,omitempty"`
+	Where       string   `json:"where,omitempty"`
+	Strategy    string   `json:"strategy"`
+	Slack       string   `json:"slack,omitempty"`
+	Shards      []string `json:"shards,omitempty"`
+}
+
+type reportResult struct {
+	Source  string `json:"source,omitempty"`
+	Elapsed string `json:"elapsed"`
+	jsonResult
+}
+
+type reportQuery struct {
+	SQL      string      `json:"sql"`
+	Args     interface{} `json:"args,omitempty"`
+	Duration string      `json:"duration"`
+	Rows     interface{} `json:"rows,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func newRunReport(path string) *runReport {
+	return &runReport{
+		path:      path,
+		Version:   version,
+		StartedAt: time.Now(),
+		Results:   []reportResult{},
+		Warnings:  []map[string]interface{}{},
+		Events:    []map[string]interface{}{},
+		Queries:   []reportQuery{},
+	}
+}
+
+// tee returns a logger writing both to next and the report, which receives
+// logs of every level whatever --log-level filters from next.
+func (r *runReport) tee(next kitlog.Logger) kitlog.Logger {
+	return kitlog.LoggerFunc(func(keyvals ...interface{}) error {
+		r.logEvent(keyvals)
+		return next.Log(keyvals...)
+	})
+}
+
+func (r *runReport) logEvent(keyvals []interface{}) {
+	event := map[string]interface{}{}
+	for idx := 0; idx+1 < len(keyvals); idx += 2 {
+		event[fmt.Sprint(keyvals[idx])] = reportValue(keyvals[idx+1])
+	}
+	if _, ok := event["ts"]; !ok {
+		event["ts"] = time.Now().UTC()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Events = append(r.Events, event)
+	if lvl := fmt.Sprint(event[fmt.Sprint(level.Key())]); lvl == "warn" || lvl == "error" {
+		r.Warnings = append(r.Warnings, event)
+	}
+}
+
+// reportValue makes a log value presentable as JSON, as errors and durations
+// would otherwise marshal to nothing and nanoseconds.
+func reportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Time:
+		return v
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return value
+}
+
+// reportQueryLogger records every statement pgx runs to the report, passing
+// its logs on to next when there is one.
+type reportQueryLogger struct {
+	report *runReport
+	next   pgx.Logger
+}
+
+func (l reportQueryLogger) Log(ctx context.Context, lvl pgx.LogLevel, msg string, data map[string]interface{}) {
+	if l.next != nil {
+		l.next.Log(ctx, lvl, msg, data)
+	}
+	if msg != "Query" && msg != "Exec" {
+		return
+	}
+
+	sql, _ := data["sql"].(string)
+	query := reportQuery{
+		SQL:      strings.TrimSpace(sql),
+		Args:     reportValue(data["args"]),
+		Duration: fmt.Sprint(data["time"]),
+		Rows:     data["rowCount"],
+	}
+	if err, ok := data["err"].(error); ok {
+		query.Error = err.Error()
+	}
+
+	l.report.mu.Lock()
+	defer l.report.mu.Unlock()
+	l.report.Queries = append(l.report.Queries, query)
+}
+
+func (r *runReport) addResult(source string, result xidfortime.Result, elapsed time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Results = append(r.Results, reportResult{Source: source, Elapsed: elapsed.String(), jsonResult: newJSONResult(result)})
+}
+
+// finish writes the report with the status the run is exiting with. Only the
+// first call writes, so it's safe both on return and from kingpin's exit.
+func (r *runReport) finish(status int) {
+	if r == nil {
+		return
+	}
+
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.EndedAt = time.Now()
+		r.Elapsed = r.EndedAt.Sub(r.StartedAt).String()
+		r.Status = status
+		if failure != nil {
+			r.Error = failure.Error()
+		}
+		data, err := json.MarshalIndent(r, "", "  ")
+		r.mu.Unlock()
+
+		if err == nil {
+			err = ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			level.Error(logger).Log("event", "report_failed", "path", r.path, "error", err)
+		}
+	})
+}
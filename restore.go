@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// Each backup tool has a subcommand of restore, sharing how the target xid is
+// estimated.
+var (
+	restore           = app.Command("restore", "Print the command restoring the right backup to the last xid that committed before time")
+	restoreIDColumn   = restore.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	restoreTimeColumn = restore.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	restoreStrategy   = restore.Flag("strategy", "Force a strategy rather than picking the cheapest viable one").Default(xidfortime.StrategyAuto).Enum(append([]string{xidfortime.StrategyAuto}, xidfortime.StrategyNames...)...)
+	restoreSlack      = restore.Flag("slack", "Move the target time earlier by this much before estimating, for a conservative recovery point").Duration()
+)
+
+// restoreTarget estimates the xid to restore to for the target time given by
+// input, returning the result along with the server it was estimated on.
+func restoreTarget(ctx context.Context, table, input string) (xidfortime.Result, xidfortime.Server, error) {
+	if *restoreSlack < 0 {
+		return xidfortime.Result{}, xidfortime.Server{}, fmt.Errorf("--slack must not be negative")
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		return xidfortime.Result{}, xidfortime.Server{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	targetTime, err := parseTargetTime(ctx, conn, input)
+	if err != nil {
+		return xidfortime.Result{}, xidfortime.Server{}, err
+	}
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *restoreIDColumn
+	estimator.TimeColumn = *restoreTimeColumn
+	estimator.Concurrency = *maxConns
+	estimator.Strategy = *restoreStrategy
+	estimator.Slack = *restoreSlack
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	result, err := estimator.EstimateXID(ctx, conn, table, targetTime)
+	if err != nil {
+		return result, xidfortime.Server{}, err
+	}
+
+	server, err := xidfortime.DetectServer(ctx, conn)
+	return result, server, err
+}
+
+// backup is a backup in the catalog of a backup tool, which can restore to any
+// target after it stopped.
+type backup struct {
+	Label string
+	Stop  time.Time
+}
+
+// latestBackupBefore picks the most recently stopped backup that stopped
+// before t, as the one with the least WAL to replay.
+func latestBackupBefore(backups []backup, t time.Time) (backup, error) {
+	var latest backup
+	for _, b := range backups {
+		if b.Stop.Before(t) && (latest.Label == "" || b.Stop.After(latest.Stop)) {
+			latest = b
+		}
+	}
+
+	if latest.Label == "" {
+		return latest, fmt.Errorf("none of %d backups stopped before %s", len(backups), t.Format(time.RFC3339Nano))
+	}
+
+	level.Info(logger).Log("event", "selected_backup", "label", latest.Label, "stop", latest.Stop,
+		"before_target", t.Sub(latest.Stop))
+	return latest, nil
+}
+
+// readCatalog reads the backup catalog from path, or from stdin if path is -.
+// Without a path, it runs the backup tool to list its catalog instead, leaving
+// its stderr on ours.
+func readCatalog(ctx context.Context, path string, command ...string) ([]byte, error) {
+	switch path {
+	case "":
+		level.Debug(logger).Log("event", "listing_backups", "command", shellCommand(command...))
+
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups with %s: %w", command[0], err)
+		}
+
+		return out, nil
+	case "-":
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// shellSafe matches words that need no quoting in a POSIX shell
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellCommand joins the words of a command, quoting any that the shell would
+// otherwise split or expand, so the command can be pasted as printed.
+func shellCommand(words ...string) string {
+	quoted := make([]string, len(words))
+	for idx, word := range words {
+		if shellSafe.MatchString(word) {
+			quoted[idx] = word
+		} else {
+			quoted[idx] = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
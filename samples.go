@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// sampleStore is where samples are recorded for later lookups.
+type sampleStore interface {
+	// record persists the samples, returning only once they're durable
+	record(ctx context.Context, samples []xidfortime.Sample) error
+	// last is the most recent sample recorded, if any
+	last(ctx context.Context) (xidfortime.Sample, bool, error)
+	Close() error
+}
+
+// sampleFile appends samples to a file as JSON lines.
+type sampleFile struct {
+	*os.File
+}
+
+func openSampleFile(path string) (*sampleFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sample file: %w", err)
+	}
+
+	return &sampleFile{file}, nil
+}
+
+func (f *sampleFile) record(ctx context.Context, samples []xidfortime.Sample) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, s := range samples {
+		if err := encoder.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write samples: %w", err)
+	}
+
+	return f.Sync()
+}
+
+// sampleTailSize is how much of the end of the file is read to find the last
+// sample, comfortably more than one line.
+const sampleTailSize = 4096
+
+func (f *sampleFile) last(ctx context.Context) (xidfortime.Sample, bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return xidfortime.Sample{}, false, err
+	}
+
+	offset := info.Size() - sampleTailSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return xidfortime.Sample{}, false, fmt.Errorf("failed to read samples: %w", err)
+	}
+
+	// A line cut short by a crash has no newline, and is ignored
+	lines := bytes.Split(tail, []byte("\n"))
+	for idx := len(lines) - 2; idx >= 0; idx-- {
+		var s xidfortime.Sample
+		if err := json.Unmarshal(lines[idx], &s); err == nil {
+			return s, true, nil
+		}
+	}
+
+	return xidfortime.Sample{}, false, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/api"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+)
+
+var (
+	serve           = app.Command("serve", "Serve estimates over HTTP and gRPC, keeping warm connections to the database")
+	serveListen     = serve.Flag("listen", "Address to serve HTTP on").Default(":8080").String()
+	serveGRPCListen = serve.Flag("grpc-listen", "Address to serve gRPC on, or empty to disable it").Default(":9090").String()
+	serveVerify     = serve.Flag("verify", "Check each xid committed, walking back to one that did if not").Default("true").Bool()
+)
+
+func runServe(ctx context.Context) {
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/xid", xidHandler{conn})
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if err := conn.QueryRow(r.Context(), "select true;").Scan(&ok); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	srv := &http.Server{Addr: *serveListen, Handler: mux}
+	grpcSrv := grpc.NewServer()
+	api.RegisterXidForTimeServer(grpcSrv, grpcServer{conn})
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		grpcSrv.GracefulStop()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if *serveGRPCListen != "" {
+		listener, err := net.Listen("tcp", *serveGRPCListen)
+		if err != nil {
+			kingpin.Fatalf("failed to listen for gRPC: %v", err)
+		}
+
+		level.Info(logger).Log("event", "serving_grpc", "listen", *serveGRPCListen)
+		go func() {
+			if err := grpcSrv.Serve(listener); err != nil {
+				level.Error(logger).Log("event", "grpc_serve_failed", "error", err)
+			}
+		}()
+	}
+
+	level.Info(logger).Log("event", "serving", "listen", *serveListen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		kingpin.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// xidHandler serves GET /v1/xid?table=events&time=..., writing the estimate as
+// JSON. Columns and strategy can be chosen with the id_column, time_column and
+// strategy parameters.
+type xidHandler struct {
+	conn *pgxpool.Pool
+}
+
+func (h xidHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+		return
+	}
+
+	params := r.URL.Query()
+	if params.Get("table") == "" || params.Get("time") == "" {
+		writeError(w, http.StatusBadRequest, errors.New("table and time parameters are required"))
+		return
+	}
+
+	targetTime, err := parseTargetTime(r.Context(), h.conn, params.Get("time"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = params.Get("id_column")
+	estimator.TimeColumn = params.Get("time_column")
+	estimator.Strategy = params.Get("strategy")
+	estimator.Concurrency = *maxConns
+	estimator.Verify = *serveVerify
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	start := time.Now()
+	result, err := estimator.EstimateXID(r.Context(), h.conn, params.Get("table"), targetTime)
+	observeEstimate(kindXID, result.Strategy, start, result.Gap(), err)
+	go notifyWebhook(poolSource(h.conn), params.Get("table"), targetTime, result, err)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeResult(w, formatJSON, xidWidth32, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// shard is a database of a horizontally sharded setup, each holding the same
+// table, given by --shard as either host[:port] or a connection string.
+type shard struct {
+	name    string
+	host    string
+	port    int
+	connStr string
+}
+
+// parseShard reads a --shard value, naming connection strings by the host,
+// port and database they connect to so passwords never reach the output.
+func parseShard(value string) (shard, error) {
+	if strings.Contains(value, "=") || strings.Contains(value, "://") {
+		cfg, err := pgx.ParseConfig(value)
+		if err != nil {
+			return shard{}, fmt.Errorf("invalid --shard: %w", err)
+		}
+
+		return shard{name: fmt.Sprintf("%s:%d/%s", cfg.Host, cfg.Port, cfg.Database), connStr: value}, nil
+	}
+
+	port := int(*port)
+	if port == 0 {
+		port = 5432
+	}
+
+	host, portStr, err := net.SplitHostPort(value)
+	if err != nil {
+		return shard{name: value, host: value, port: port}, nil
+	}
+	if port, err = strconv.Atoi(portStr); err != nil {
+		return shard{}, fmt.Errorf("invalid --shard %q: bad port", value)
+	}
+
+	return shard{name: value, host: host, port: port}, nil
+}
+
+func (s shard) connect(ctx context.Context) (*pgxpool.Pool, error) {
+	if s.connStr != "" {
+		return connectDSN(ctx, s.connStr)
+	}
+
+	return connectNode(ctx, s.host, s.port)
+}
+
+// runEstimateShards estimates the same target times on every --shard at once,
+// writing a result per shard for each. Shards that can't be reached or fail to
+// estimate are reported without holding up the rest of the sweep.
+func runEstimateShards(ctx context.Context, estimator *xidfortime.Estimator, outputTemplate *template.Template) {
+	switch {
+	case *dryRun, *analyze, *setStatistics > 0:
+		kingpin.Fatalf("--dry-run, --analyze and --set-statistics are not supported with --shard")
+	case *from != "" || *to != "":
+		kingpin.Fatalf("--from and --to are not supported with --shard")
+	case *alsoCheck != "":
+		kingpin.Fatalf("--also-check is not supported with --shard")
+	case outputTemplate != nil || *emit != "":
+		kingpin.Fatalf("--format-template and --emit are not supported with --shard")
+	}
+
+	var shards []shard
+	seen := map[string]bool{}
+	for _, value := range *shardDSNs {
+		s, err := parseShard(value)
+		if err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+		if seen[s.name] {
+			kingpin.Fatalf("--shard %s given more than once", s.name)
+		}
+		seen[s.name] = true
+		shards = append(shards, s)
+	}
+	if activeReport != nil {
+		for _, s := range shards {
+			activeReport.Inputs.Shards = append(activeReport.Inputs.Shards, s.name)
+		}
+	}
+
+	inputs := *targetTimes
+	if len(inputs) == 0 {
+		var err error
+		if inputs, err = readLines(os.Stdin); err != nil {
+			kingpin.Fatalf("failed to read target times from stdin: %v", err)
+		}
+	}
+	if len(inputs) == 0 {
+		kingpin.Fatalf("no target times given")
+	}
+	if activeReport != nil {
+		activeReport.Inputs.TargetTimes = inputs
+	}
+
+	// Every shard has to share each target, so relative times are taken from our
+	// clock rather than each server's
+	*relativeTo = clockClient
+	targets := make([]time.Time, len(inputs))
+	for idx, input := range inputs {
+		var err error
+		if targets[idx], err = parseTargetTime(ctx, nil, input); err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+	}
+
+	var recorder *resultRecorder
+	if *recordTo != "" {
+		var err error
+		if recorder, err = newResultRecorder(ctx, *recordTo, *recordToSchema, ""); err != nil {
+			fatal(fmt.Errorf("failed to connect to --record-to: %w", err))
+		}
+		defer recorder.Close()
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make([]map[string]fleetResult, len(targets))
+	)
+	for idx := range results {
+		results[idx] = map[string]fleetResult{}
+	}
+	for _, s := range shards {
+		wg.Add(1)
+		go func(s shard) {
+			defer wg.Done()
+			shardResults := estimateShard(ctx, estimator, recorder, s, targets)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for idx, r := range shardResults {
+				results[idx][s.name] = r
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	failed := map[string]bool{}
+	for idx, byShard := range results {
+		err := writeShards(os.Stdout, *format, *xidWidth, targets[idx], byShard)
+		if err != nil {
+			err = fmt.Errorf("failed to write result: %w", err)
+		}
+		for name, r := range byShard {
+			if r.err != nil {
+				notifyWebhook(name, *table, targets[idx], r.result, r.err)
+			} else {
+				notifyWebhook(name, *table, targets[idx], r.result, err)
+			}
+		}
+		if err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+		for name, r := range byShard {
+			if r.err != nil {
+				failure = r.err
+				failed[name] = true
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		kingpin.Fatalf("failed to estimate on %d of %d shards", len(failed), len(shards))
+	}
+}
+
+// estimateShard estimates each target on a shard, with the settings of estimator
+// but a cache of its own, as every shard has its own statistics.
+func estimateShard(ctx context.Context, estimator *xidfortime.Estimator, recorder *resultRecorder, s shard, targets []time.Time) []fleetResult {
+	results := make([]fleetResult, len(targets))
+
+	pool, err := s.connect(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to connect to database: %w", err)
+		level.Error(logger).Log("event", "estimate_failed", "shard", s.name, "error", err)
+		for idx, target := range targets {
+			results[idx] = fleetResult{result: xidfortime.Result{TargetTime: target}, err: err}
+		}
+
+		return results
+	}
+	defer pool.Close()
+
+	other := *estimator
+	other.Logger = kitlog.With(logger, "shard", s.name)
+	other.Cache = xidfortime.NewCache()
+
+	for idx, target := range targets {
+		started := time.Now()
+		result, err := other.EstimateXID(ctx, pool, *table, target)
+		if err == nil {
+			activeReport.addResult(s.name, result, time.Since(started))
+		}
+		if err == nil && recorder != nil {
+			err = recorder.withSource(s.name).record(ctx, *table, result, time.Since(started))
+		}
+		if err != nil {
+			level.Error(logger).Log("event", "estimate_failed", "shard", s.name, "target_time", target, "error", err)
+			result = xidfortime.Result{TargetTime: target}
+		}
+		results[idx] = fleetResult{result: result, err: err}
+	}
+
+	return results
+}
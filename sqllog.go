@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+)
+
+var verbose = app.Flag("verbose", "Log every SQL statement with its bound parameters and duration, at a dedicated sql level").Short('v').Bool()
+
+// sqlLogger receives pgx's logs, keeping only those for executed statements.
+// These are logged at a dedicated sql level, which --log-level doesn't filter
+// as asking for --verbose is asking for them.
+type sqlLogger struct {
+	logger kitlog.Logger
+}
+
+func (l sqlLogger) Log(ctx context.Context, _ pgx.LogLevel, msg string, data map[string]interface{}) {
+	if msg != "Query" && msg != "Exec" {
+		return
+	}
+
+	sql, _ := data["sql"].(string)
+	keyvals := []interface{}{level.Key(), "sql", "event", strings.ToLower(msg),
+		"sql", strings.Join(strings.Fields(sql), " "), "args", data["args"], "duration", data["time"]}
+	if rows, ok := data["rowCount"]; ok {
+		keyvals = append(keyvals, "rows", rows)
+	}
+
+	l.logger.Log(keyvals...)
+}
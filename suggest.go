@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	suggestTables       = app.Command("suggest-tables", "Rank tables by how well suited they are to estimation")
+	suggestTablesLimit  = suggestTables.Flag("limit", "Number of candidates to list").Default("10").Int()
+	suggestTablesFormat = suggestTables.Flag("format", "Format of the candidates written to stdout").Default("table").Enum("table", formatJSON)
+)
+
+func runSuggestTables(ctx context.Context) {
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	candidates, err := xidfortime.SuggestTables(ctx, conn)
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(candidates) > *suggestTablesLimit {
+		candidates = candidates[:*suggestTablesLimit]
+	}
+
+	if *suggestTablesFormat == formatJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(candidates); err != nil {
+			kingpin.Fatalf("failed to write candidates: %v", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tID COLUMN\tTIME COLUMN\tINSERTS\tUPDATE RATIO\tSCORE")
+	for _, c := range candidates {
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\t%d\t%.3f\t%.2f\n",
+			c.Schema, c.Table, c.IDColumn, c.TimeColumn, c.Inserts, c.UpdateRatio(), c.Score)
+	}
+	w.Flush()
+}
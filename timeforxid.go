@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+const formatTime = "time"
+
+var (
+	timeForXID                 = app.Command("time-for-xid", "Estimate the time an xid committed")
+	timeForXIDTable            = timeForXID.Arg("table", "Table to use for estimates, unless given by --target").String()
+	timeForXIDXID              = timeForXID.Arg("xid", "Transaction ID to find the commit time of").String()
+	timeForXIDIDColumn         = timeForXID.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	timeForXIDTimeColumn       = timeForXID.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	timeForXIDStrategy         = timeForXID.Flag("strategy", "Force a strategy rather than preferring commit timestamps").Default(xidfortime.StrategyAuto).Enum(xidfortime.StrategyAuto, xidfortime.StrategyHistogram, xidfortime.StrategyTableSample, xidfortime.StrategyCommitTimestamp)
+	timeForXIDStatementTimeout = timeForXID.Flag("statement-timeout", "SET LOCAL statement_timeout around each query").Duration()
+	timeForXIDLockTimeout      = timeForXID.Flag("lock-timeout", "SET LOCAL lock_timeout around each query").Duration()
+	timeForXIDFormat           = timeForXID.Flag("format", "Format of the result written to stdout").Default(formatLogfmt).Enum(formatLogfmt, formatJSON, formatTime)
+)
+
+func runTimeForXID(ctx context.Context) {
+	if *timeForXIDTable == "" || *timeForXIDXID == "" {
+		kingpin.Fatalf("required arguments 'table' and 'xid' not provided, nor the table by --target")
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *timeForXIDIDColumn
+	estimator.TimeColumn = *timeForXIDTimeColumn
+	estimator.Concurrency = *maxConns
+	estimator.Strategy = *timeForXIDStrategy
+	estimator.StatementTimeout = *timeForXIDStatementTimeout
+	estimator.LockTimeout = *timeForXIDLockTimeout
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+
+	result, err := estimator.EstimateTime(ctx, conn, *timeForXIDTable, *timeForXIDXID)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch *timeForXIDFormat {
+	case formatTime:
+		_, err = fmt.Println(result.CommittedAt.Format(time.RFC3339Nano))
+	case formatJSON:
+		err = json.NewEncoder(os.Stdout).Encode(struct {
+			xidfortime.TimeResult
+			Gap string `json:"gap"`
+		}{result, result.Gap().String()})
+	}
+	if err != nil {
+		kingpin.Fatalf("failed to write result: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+// Clocks that relative times can be resolved against
+const (
+	clockServer = "server"
+	clockClient = "client"
+)
+
+var (
+	relativeTo = app.Flag("relative-to", "Clock that relative times such as -2h are resolved against").Default(clockServer).Enum(clockServer, clockClient)
+	timezone   = app.Flag("timezone", "Timezone of target times given without an offset, and of days in relative times").Default("UTC").String()
+)
+
+// timeLayouts are the absolute formats accepted for target times, tried in
+// order. Those without an offset are read in --timezone.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999 MST",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// epochPattern matches unix timestamps in seconds, optionally prefixed with @
+// as date(1) accepts and with fractional seconds
+var epochPattern = regexp.MustCompile(`^@?([0-9]+)(?:\.([0-9]{1,9}))?$`)
+
+// parseTargetTime accepts relative times, unix timestamps and the formats in
+// timeLayouts, returning the time in UTC. Target times are bound as parameters
+// so the instant compares correctly against timestamptz columns, while the UTC
+// wall clock is what timestamp columns see.
+func parseTargetTime(ctx context.Context, conn xidfortime.Querier, input string) (time.Time, error) {
+	loc, err := targetLocation()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	targetTime, ok, err := parseRelativeTime(input, func() (time.Time, error) {
+		now, err := currentTime(ctx, conn)
+		return now.In(loc), err
+	})
+	if ok {
+		return targetTime.UTC(), err
+	}
+
+	if targetTime, ok := parseEpoch(input); ok {
+		return targetTime.UTC(), nil
+	}
+
+	input = strings.TrimSpace(input)
+	for _, layout := range timeLayouts {
+		if targetTime, err := time.ParseInLocation(layout, input, loc); err == nil {
+			if err := checkZoneAbbreviation(targetTime, loc); err != nil {
+				return time.Time{}, err
+			}
+
+			return targetTime.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp for target time: %q", input)
+}
+
+// checkZoneAbbreviation rejects times given with a zone abbreviation other
+// than those of loc, UTC and GMT. Go doesn't know what other abbreviations
+// mean, and reads them with a zero offset, so 14:00 EST would silently be
+// taken as 14:00 UTC.
+func checkZoneAbbreviation(t time.Time, loc *time.Location) error {
+	name, offset := t.Zone()
+	if name == "" || offset != 0 || name == "GMT" || t.Location() == loc || t.Location() == time.UTC {
+		return nil
+	}
+
+	return fmt.Errorf("unknown timezone abbreviation %s for --timezone %s, give a numeric offset such as -05:00 instead", name, loc)
+}
+
+func targetLocation() (*time.Location, error) {
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --timezone: %w", err)
+	}
+
+	return loc, nil
+}
+
+func parseEpoch(input string) (time.Time, bool) {
+	match := epochPattern.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return time.Time{}, false
+	}
+
+	seconds, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var nanos int64
+	if match[2] != "" {
+		nanos, _ = strconv.ParseInt(match[2]+strings.Repeat("0", 9-len(match[2])), 10, 64)
+	}
+
+	return time.Unix(seconds, nanos), true
+}
+
+var (
+	// offsetPattern matches an optional anchor followed by a signed offset, such
+	// as -2h, now-30m or yesterday+90m
+	offsetPattern = regexp.MustCompile(`^(now|today|yesterday)?\s*([+-]\s*[0-9][0-9a-zµ.]*)$`)
+	// dayPattern matches a day with an optional time of day, such as today or
+	// yesterday 14:00
+	dayPattern = regexp.MustCompile(`^(now|today|yesterday)(?:\s+([0-9]{1,2}):([0-9]{2})(?::([0-9]{2}))?)?$`)
+	// daysPattern matches a count of days within an offset
+	daysPattern = regexp.MustCompile(`([0-9.]+)d`)
+)
+
+// parseRelativeTime resolves expressions such as -2h, now-30m, today and
+// yesterday 14:00 against the current time, reporting false for anything else.
+// Offsets accept the units of time.ParseDuration, and d for days.
+func parseRelativeTime(input string, now func() (time.Time, error)) (time.Time, bool, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+
+	var anchor, offset string
+	if match := offsetPattern.FindStringSubmatch(input); match != nil {
+		anchor, offset = match[1], strings.Join(strings.Fields(match[2]), "")
+	} else if match := dayPattern.FindStringSubmatch(input); match != nil {
+		anchor = match[1]
+		if match[2] != "" {
+			offset = fmt.Sprintf("+%sh%sm%ss", match[2], match[3], orDefault(match[4], "0"))
+		}
+	} else {
+		return time.Time{}, false, nil
+	}
+
+	if anchor == "" {
+		anchor = "now"
+	}
+	if anchor != "now" && offset == "" {
+		offset = "+0s"
+	}
+
+	current, err := now()
+	if err != nil {
+		return time.Time{}, true, err
+	}
+
+	resolved := current
+	switch anchor {
+	case "today":
+		resolved = startOfDay(current)
+	case "yesterday":
+		resolved = startOfDay(current).AddDate(0, 0, -1)
+	}
+
+	if offset != "" {
+		duration, err := parseOffset(offset)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid relative time %q: %w", input, err)
+		}
+
+		resolved = resolved.Add(duration)
+	}
+
+	return resolved, true, nil
+}
+
+// parseOffset parses a signed duration, extending time.ParseDuration with d for
+// days.
+func parseOffset(offset string) (time.Duration, error) {
+	var err error
+	offset = daysPattern.ReplaceAllStringFunc(offset, func(day string) string {
+		count, parseErr := strconv.ParseFloat(strings.TrimSuffix(day, "d"), 64)
+		if parseErr != nil {
+			err = parseErr
+		}
+
+		return fmt.Sprintf("%gh", count*24)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return time.ParseDuration(offset)
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// currentTime reads the clock chosen by --relative-to. The server clock avoids
+// skew between the client and the timestamps it wrote into the table.
+func currentTime(ctx context.Context, conn xidfortime.Querier) (time.Time, error) {
+	if *relativeTo == clockClient {
+		return time.Now(), nil
+	}
+
+	var now time.Time
+	if err := conn.QueryRow(ctx, "select now();").Scan(&now); err != nil {
+		return now, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	return now, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseOffset(t *testing.T) {
+	for _, tc := range []struct {
+		offset string
+		want   time.Duration
+		valid  bool
+	}{
+		{offset: "-2h", want: -2 * time.Hour, valid: true},
+		{offset: "+30m", want: 30 * time.Minute, valid: true},
+		{offset: "-1d", want: -24 * time.Hour, valid: true},
+		{offset: "+1.5d", want: 36 * time.Hour, valid: true},
+		{offset: "-2d12h", want: -60 * time.Hour, valid: true},
+		{offset: "-1h30m15s", want: -(time.Hour + 30*time.Minute + 15*time.Second), valid: true},
+		{offset: "-500ms", want: -500 * time.Millisecond, valid: true},
+		{offset: "-1.2.3d"},
+		{offset: "-2x"},
+		{offset: "-"},
+	} {
+		got, err := parseOffset(tc.offset)
+		switch {
+		case tc.valid && err != nil:
+			t.Errorf("parseOffset(%q) returned error: %v", tc.offset, err)
+		case tc.valid && got != tc.want:
+			t.Errorf("parseOffset(%q) = %s, want %s", tc.offset, got, tc.want)
+		case !tc.valid && err == nil:
+			t.Errorf("parseOffset(%q) = %s, want error", tc.offset, got)
+		}
+	}
+}
+
+func TestParseRelativeTime(t *testing.T) {
+	current := time.Date(2024, 6, 15, 10, 20, 30, 0, time.UTC)
+	now := func() (time.Time, error) { return current, nil }
+
+	for _, tc := range []struct {
+		input    string
+		want     time.Time
+		relative bool
+		valid    bool
+	}{
+		{input: "-2h", want: current.Add(-2 * time.Hour), relative: true, valid: true},
+		{input: "now", want: current, relative: true, valid: true},
+		{input: "now-30m", want: current.Add(-30 * time.Minute), relative: true, valid: true},
+		{input: " NOW - 30m ", want: current.Add(-30 * time.Minute), relative: true, valid: true},
+		{input: "now+1d", want: current.AddDate(0, 0, 1), relative: true, valid: true},
+		{input: "today", want: time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), relative: true, valid: true},
+		{input: "yesterday", want: time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC), relative: true, valid: true},
+		{input: "yesterday 14:00", want: time.Date(2024, 6, 14, 14, 0, 0, 0, time.UTC), relative: true, valid: true},
+		{input: "today 09:05:07", want: time.Date(2024, 6, 15, 9, 5, 7, 0, time.UTC), relative: true, valid: true},
+		{input: "yesterday+90m", want: time.Date(2024, 6, 14, 1, 30, 0, 0, time.UTC), relative: true, valid: true},
+		{input: "now-2x", relative: true},
+		{input: "2024-06-15 10:00"},
+		{input: "1700000000"},
+		{input: "tomorrow"},
+	} {
+		got, relative, err := parseRelativeTime(tc.input, now)
+		switch {
+		case relative != tc.relative:
+			t.Errorf("parseRelativeTime(%q) reported relative %v, want %v", tc.input, relative, tc.relative)
+		case tc.valid && err != nil:
+			t.Errorf("parseRelativeTime(%q) returned error: %v", tc.input, err)
+		case tc.valid && !got.Equal(tc.want):
+			t.Errorf("parseRelativeTime(%q) = %s, want %s", tc.input, got, tc.want)
+		case tc.relative && !tc.valid && err == nil:
+			t.Errorf("parseRelativeTime(%q) = %s, want error", tc.input, got)
+		}
+	}
+}
+
+func TestParseRelativeTimeClockError(t *testing.T) {
+	clockErr := errors.New("no clock")
+	now := func() (time.Time, error) { return time.Time{}, clockErr }
+
+	if _, relative, err := parseRelativeTime("-2h", now); !relative || !errors.Is(err, clockErr) {
+		t.Errorf("parseRelativeTime returned relative %v and error %v, want the clock's error", relative, err)
+	}
+	if _, relative, err := parseRelativeTime("2024-06-15", now); relative || err != nil {
+		t.Errorf("parseRelativeTime read the clock for an absolute time, returning relative %v and error %v", relative, err)
+	}
+}
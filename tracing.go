@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// tracerName identifies spans created by the command line tool
+const tracerName = "github.com/lawrencejones/xid-for-time"
+
+// setupTracing exports spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set,
+// following the OpenTelemetry environment conventions for the collector's
+// headers, TLS and the service's resource attributes. The returned function
+// flushes any buffered spans.
+func setupTracing() (func(), error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return func() {}, nil
+	}
+
+	opts := []otlp.ExporterOption{otlp.WithAddress(stripScheme(endpoint))}
+	if insecure := os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"); insecure == "true" || strings.HasPrefix(endpoint, "http://") {
+		opts = append(opts, otlp.WithInsecure())
+	}
+	if headers := parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")); len(headers) > 0 {
+		opts = append(opts, otlp.WithHeaders(headers))
+	}
+
+	exporter, err := otlp.NewExporter(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "xid-for-time"
+	}
+
+	res := resource.New(semconv.ServiceNameKey.String(serviceName))
+	if envRes, err := (&resource.FromEnv{}).Detect(context.Background()); err == nil {
+		res = resource.Merge(envRes, res)
+	}
+
+	processor, err := sdktrace.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithResource(res),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.RegisterSpanProcessor(processor)
+	global.SetTraceProvider(provider)
+
+	level.Info(logger).Log("event", "tracing", "endpoint", endpoint)
+	return func() {
+		provider.UnregisterSpanProcessor(processor)
+		exporter.Stop()
+	}, nil
+}
+
+func stripScheme(endpoint string) string {
+	for _, scheme := range []string{"http://", "https://"} {
+		endpoint = strings.TrimPrefix(endpoint, scheme)
+	}
+
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// parseHeaders reads the key=value,key=value format of OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(kv) == 2 {
+			headers[kv[0]] = kv[1]
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+	"github.com/lawrencejones/xid-for-time/pkg/wal"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	track               = app.Command("track", "Stream WAL as a replication client, recording the time, xid and LSN of commits as they happen")
+	trackOutput         = track.Flag("output", "File to append samples to as JSON lines, resuming after the last sample in it").Required().String()
+	trackSlot           = track.Flag("slot", "Physical replication slot to stream from, so the server keeps WAL until we have recorded it").String()
+	trackResolution     = track.Flag("resolution", "Record at most one commit per this duration, or every commit when zero").Duration()
+	trackStatusInterval = track.Flag("status-interval", "How often samples are flushed and our position reported to the server").Default("10s").Duration()
+)
+
+// postgresEpoch is where the replication protocol counts microseconds from.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func runTrack(ctx context.Context) {
+	store, err := openSampleFile(*trackOutput)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	defer store.Close()
+
+	// Tracking runs until interrupted, reconnecting after failovers and other
+	// transient failures rather than leaving a gap in the samples
+	policy := xidfortime.RetryPolicy{Retries: math.MaxInt32, Backoff: *retryBackoff}
+	err = policy.Do(ctx, logger, "track", func() error {
+		return trackWAL(ctx, store)
+	})
+	if err != nil && ctx.Err() == nil {
+		fatal(err)
+	}
+}
+
+// trackWAL streams WAL from where the last sample was recorded, or the current
+// end of WAL if there are none, recording samples from each commit.
+func trackWAL(ctx context.Context, store sampleStore) error {
+	next, err := nextFullXID(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connectReplication(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect for replication: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	system, err := conn.Exec(ctx, "IDENTIFY_SYSTEM;").ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to identify system: %w", err)
+	}
+	if len(system) != 1 || len(system[0].Rows) != 1 {
+		return fmt.Errorf("unexpected response to IDENTIFY_SYSTEM")
+	}
+	timeline, current := string(system[0].Rows[0][1]), string(system[0].Rows[0][2])
+
+	pageSize := 8192
+	if show, err := conn.Exec(ctx, "SHOW wal_block_size;").ReadAll(); err == nil && len(show) == 1 && len(show[0].Rows) == 1 {
+		if pageSize, err = strconv.Atoi(string(show[0].Rows[0][0])); err != nil {
+			return fmt.Errorf("invalid wal_block_size: %w", err)
+		}
+	}
+
+	start, err := wal.ParseLSN(current)
+	if err != nil {
+		return err
+	}
+	var resumeAfter wal.LSN
+	if last, ok, err := store.last(ctx); err != nil {
+		return err
+	} else if ok {
+		if resumeAfter, err = wal.ParseLSN(last.LSN); err != nil {
+			return err
+		}
+		start = resumeAfter
+	}
+	start -= start % wal.LSN(pageSize)
+
+	var (
+		pending  []xidfortime.Sample
+		recorded time.Time
+	)
+	stream, err := wal.NewStream(start, pageSize, func(commit wal.Commit) error {
+		if commit.LSN <= resumeAfter {
+			return nil
+		}
+		if *trackResolution > 0 && commit.CommittedAt.Sub(recorded) < *trackResolution {
+			return nil
+		}
+
+		// Each commit moves the reference forward, so the epoch stays right
+		// however long we track for
+		next = next + uint64(int64(int32(commit.XID-uint32(next))))
+		pending = append(pending, xidfortime.Sample{RecordedAt: commit.CommittedAt, XID: strconv.FormatUint(next, 10), LSN: commit.LSN.String()})
+		recorded = commit.CommittedAt
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	command := fmt.Sprintf("START_REPLICATION PHYSICAL %s TIMELINE %s;", start, timeline)
+	if *trackSlot != "" {
+		command = fmt.Sprintf("START_REPLICATION SLOT %s PHYSICAL %s TIMELINE %s;",
+			pgx.Identifier{*trackSlot}.Sanitize(), start, timeline)
+	}
+	if err := startReplication(ctx, conn, command); err != nil {
+		return err
+	}
+
+	level.Info(logger).Log("event", "tracking", "start_lsn", start, "timeline", timeline, "slot", *trackSlot)
+
+	flushed := start
+	for status := time.Now().Add(*trackStatusInterval); ; {
+		if !time.Now().Before(status) {
+			if len(pending) > 0 {
+				if err := store.record(ctx, pending); err != nil {
+					return err
+				}
+
+				level.Debug(logger).Log("event", "recorded_samples", "samples", len(pending), "lsn", pending[len(pending)-1].LSN)
+				pending = pending[:0]
+			}
+
+			// Only what's recorded is reported as flushed, so a slot keeps the WAL
+			// of any commits we'd lose if we crashed now
+			flushed = stream.Position()
+			if err := sendStandbyStatus(ctx, conn, stream.Position(), flushed); err != nil {
+				return err
+			}
+
+			status = time.Now().Add(*trackStatusInterval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, status)
+		msg, err := conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if pgconn.Timeout(err) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive WAL: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if err := receiveCopyData(ctx, conn, stream, flushed, msg.Data); err != nil {
+				return err
+			}
+		case *pgproto3.CopyDone:
+			return fmt.Errorf("replication ended at %s, as on a timeline switch: %w", stream.Position(), io.EOF)
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		}
+	}
+}
+
+// nextFullXID reads the next xid to be assigned, to take the epoch of the
+// 32-bit xids in commit records from.
+func nextFullXID(ctx context.Context) (uint64, error) {
+	pool, err := connect(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	return xidfortime.NewEstimator(logger).NextFullXID(ctx, pool)
+}
+
+// startReplication sends the command, waiting for the server to switch into
+// streaming WAL to us.
+func startReplication(ctx context.Context, conn *pgconn.PgConn, command string) error {
+	if err := conn.SendBytes(ctx, (&pgproto3.Query{String: command}).Encode(nil)); err != nil {
+		return fmt.Errorf("failed to start replication: %w", err)
+	}
+
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start replication: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.NoticeResponse:
+		default:
+			return fmt.Errorf("unexpected %T starting replication", msg)
+		}
+	}
+}
+
+// receiveCopyData handles a message of the replication stream, which is either
+// WAL or a keepalive that may ask for our position.
+func receiveCopyData(ctx context.Context, conn *pgconn.PgConn, stream *wal.Stream, flushed wal.LSN, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case 'w': // XLogData
+		if len(data) < 25 {
+			return fmt.Errorf("short XLogData message")
+		}
+
+		return stream.Write(wal.LSN(binary.BigEndian.Uint64(data[1:])), data[25:])
+	case 'k': // Primary keepalive
+		if len(data) >= 18 && data[17] == 1 {
+			return sendStandbyStatus(ctx, conn, stream.Position(), flushed)
+		}
+	}
+
+	return nil
+}
+
+// sendStandbyStatus reports how much WAL we've received and recorded. We never
+// apply WAL, so report it applied once recorded.
+func sendStandbyStatus(ctx context.Context, conn *pgconn.PgConn, received, flushed wal.LSN) error {
+	status := make([]byte, 34)
+	status[0] = 'r'
+	binary.BigEndian.PutUint64(status[1:], uint64(received))
+	binary.BigEndian.PutUint64(status[9:], uint64(flushed))
+	binary.BigEndian.PutUint64(status[17:], uint64(flushed))
+	binary.BigEndian.PutUint64(status[25:], uint64(time.Since(postgresEpoch)/time.Microsecond))
+
+	if err := conn.SendBytes(ctx, (&pgproto3.CopyData{Data: status}).Encode(nil)); err != nil {
+		return fmt.Errorf("failed to send standby status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialSSH routes the connection through an SSH tunnel to the given jump host.
+// The Postgres host and port are resolved from the jump host, so they should
+// be given as that host sees them.
+func dialSSH(cfg *pgx.ConnConfig, sshHost, sshUser, sshKey, sshKnownHosts string) error {
+	if _, _, err := net.SplitHostPort(sshHost); err != nil {
+		sshHost = net.JoinHostPort(sshHost, "22")
+	}
+
+	if u, err := osuser.Current(); err == nil {
+		if sshUser == "" {
+			sshUser = u.Username
+		}
+		if sshKnownHosts == "" {
+			sshKnownHosts = filepath.Join(u.HomeDir, ".ssh", "known_hosts")
+		}
+	}
+
+	hostKeyCallback, err := knownhosts.New(sshKnownHosts)
+	if err != nil {
+		return fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	config := &ssh.ClientConfig{User: sshUser, HostKeyCallback: hostKeyCallback}
+	tunnel := &sshTunnel{dial: func(ctx context.Context) (*ssh.Client, error) {
+		auth, closeAuth, err := sshAuthMethods(sshKey)
+		if err != nil {
+			return nil, err
+		}
+		defer closeAuth()
+
+		clientConfig := *config
+		clientConfig.Auth = auth
+
+		client, err := dialSSHClient(ctx, sshHost, &clientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh host %s: %w", sshHost, err)
+		}
+
+		level.Info(logger).Log("event", "ssh_tunnel", "ssh_host", sshHost, "ssh_user", sshUser)
+		return client, nil
+	}}
+	cfg.DialFunc = tunnel.DialContext
+
+	return nil
+}
+
+// dialSSHClient connects and authenticates to the SSH host, giving up when ctx
+// is done, which ssh.Dial can't.
+func dialSSHClient(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake takes no context, so is interrupted by closing the
+	// connection under it
+	handshook := make(chan struct{})
+	defer close(handshook)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshook:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshTunnel dials connections through an SSH client, connecting it on demand
+// and closing it along with the last connection through it, as when the pool
+// closes. A client whose transport fails is replaced for the next dial.
+type sshTunnel struct {
+	dial func(context.Context) (*ssh.Client, error)
+
+	mu     sync.Mutex
+	client *tunnelClient
+}
+
+// tunnelClient counts the connections through an SSH client.
+type tunnelClient struct {
+	*ssh.Client
+	conns  int
+	closed bool
+}
+
+func (t *sshTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		result <- dialed{conn, err}
+	}()
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			// Channels the server refuses leave the client usable, but
+			// anything else means its transport has failed
+			var refused *ssh.OpenChannelError
+			t.release(client, !errors.As(r.err, &refused))
+			return nil, r.err
+		}
+
+		return &tunnelConn{Conn: r.conn, release: func() { t.release(client, false) }}, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-result; r.err == nil {
+				r.conn.Close()
+			}
+			t.release(client, false)
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// acquire takes a hold on the current client, connecting one if there's none.
+// The lock isn't held while connecting, so one hung dial can't hold up others
+// that have been cancelled.
+func (t *sshTunnel) acquire(ctx context.Context) (*tunnelClient, error) {
+	t.mu.Lock()
+	if client := t.client; client != nil {
+		client.conns++
+		t.mu.Unlock()
+		return client, nil
+	}
+	t.mu.Unlock()
+
+	c, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Another dial may have connected a client in the meantime
+	if t.client != nil {
+		closeTunnelClient(c)
+	} else {
+		t.client = &tunnelClient{Client: c}
+	}
+	t.client.conns++
+
+	return t.client, nil
+}
+
+// release drops a hold on client, closing it once there are none left, or
+// straight away if its transport has failed.
+func (t *sshTunnel) release(client *tunnelClient, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client.conns--
+	if client.conns > 0 && !failed {
+		return
+	}
+
+	if t.client == client {
+		t.client = nil
+	}
+	if !client.closed {
+		client.closed = true
+		closeTunnelClient(client.Client)
+	}
+}
+
+func closeTunnelClient(client *ssh.Client) {
+	if err := client.Close(); err != nil {
+		level.Debug(logger).Log("event", "ssh_tunnel_close_failed", "error", err)
+	}
+}
+
+// tunnelConn releases its hold on the tunnel when closed.
+type tunnelConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+
+	return err
+}
+
+// sshAuthMethods authenticates with the given private key, or with a running
+// ssh-agent when no key is given. The agent is only needed until the client has
+// authenticated, after which the returned function closes our connection to it.
+func sshAuthMethods(sshKey string) ([]ssh.AuthMethod, func(), error) {
+	if sshKey != "" {
+		pem, err := ioutil.ReadFile(sshKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read ssh key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse ssh key: %w", err)
+		}
+
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, func() {}, nil
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("no --ssh-key given and SSH_AUTH_SOCK is unset")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, func() { conn.Close() }, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	verifyAccuracy           = app.Command("verify", "Measure how far estimates are from the exact answer given by commit timestamps (track_commit_timestamp=on)")
+	verifyAccuracyTable      = verifyAccuracy.Arg("table", "Table to use for estimates, unless given by --target").String()
+	verifyAccuracyTimes      = verifyAccuracy.Arg("time", "Target times to measure estimates for, read one per line from stdin if none are given").Strings()
+	verifyAccuracyIDColumn   = verifyAccuracy.Flag("id-column", "Monotonic column used to order rows").Default(xidfortime.DefaultIDColumn).String()
+	verifyAccuracyTimeColumn = verifyAccuracy.Flag("time-column", "Column recording when each row was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	verifyAccuracyStrategy   = verifyAccuracy.Flag("strategy", "Force the strategy being measured rather than picking the cheapest viable one").Default(xidfortime.StrategyAuto).Enum(append([]string{xidfortime.StrategyAuto}, measurableStrategies()...)...)
+	verifyAccuracyNeighbours = verifyAccuracy.Flag("neighbours", "Also report when this many xids either side of each estimate committed").Default("0").Int()
+	verifyAccuracyFormat     = verifyAccuracy.Flag("format", "Format of the results written to stdout").Default(formatLogfmt).Enum(formatLogfmt, formatJSON)
+)
+
+// measurableStrategies are those that can be compared with commit timestamps,
+// being every strategy but the one using them.
+func measurableStrategies() []string {
+	var strategies []string
+	for _, strategy := range xidfortime.StrategyNames {
+		if strategy != xidfortime.StrategyCommitTimestamp {
+			strategies = append(strategies, strategy)
+		}
+	}
+
+	return strategies
+}
+
+func runVerifyAccuracy(ctx context.Context) {
+	if *verifyAccuracyTable == "" {
+		kingpin.Fatalf("required argument 'table' not provided, nor by --target")
+	}
+
+	inputs := *verifyAccuracyTimes
+	if len(inputs) == 0 {
+		var err error
+		if inputs, err = readLines(os.Stdin); err != nil {
+			kingpin.Fatalf("failed to read target times from stdin: %v", err)
+		}
+	}
+	if len(inputs) == 0 {
+		kingpin.Fatalf("no target times given")
+	}
+
+	conn, err := connect(ctx)
+	if err != nil {
+		fatal(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer conn.Close()
+
+	estimator := xidfortime.NewEstimator(logger)
+	estimator.IDColumn = *verifyAccuracyIDColumn
+	estimator.TimeColumn = *verifyAccuracyTimeColumn
+	estimator.Concurrency = *maxConns
+	estimator.Strategy = *verifyAccuracyStrategy
+	estimator.Retry = retryPolicy()
+	estimator.Snapshot = *snapshot
+	estimator.Cache = xidfortime.NewCache()
+
+	var (
+		maxXIDsOff   int64
+		maxTimeError time.Duration
+		uncommitted  int
+	)
+	for _, input := range inputs {
+		targetTime, err := parseTargetTime(ctx, conn, input)
+		if err != nil {
+			fatal(err)
+		}
+
+		accuracy, err := estimator.MeasureAccuracy(ctx, conn, *verifyAccuracyTable, targetTime, *verifyAccuracyNeighbours)
+		if err != nil {
+			fatal(err)
+		}
+
+		if off := abs64(accuracy.XIDsOff); off > maxXIDsOff {
+			maxXIDsOff = off
+		}
+		if accuracy.TimeError == nil {
+			uncommitted++
+		} else if timeError := time.Duration(abs64(int64(*accuracy.TimeError))); timeError > maxTimeError {
+			maxTimeError = timeError
+		}
+
+		if err := writeAccuracy(accuracy); err != nil {
+			kingpin.Fatalf("failed to write result: %v", err)
+		}
+	}
+
+	level.Info(logger).Log("event", "accuracy_summary", "measured", len(inputs), "max_xids_off", maxXIDsOff,
+		"max_time_error", maxTimeError, "uncommitted", uncommitted)
+}
+
+func writeAccuracy(accuracy xidfortime.Accuracy) error {
+	if *verifyAccuracyFormat == formatJSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			xidfortime.Accuracy
+			Estimate jsonResult `json:"estimate"`
+			Exact    jsonResult `json:"exact"`
+		}{accuracy, newJSONResult(accuracy.Estimate), newJSONResult(accuracy.Exact)})
+	}
+
+	keyvals := []interface{}{"target_time", accuracy.Estimate.TargetTime, "strategy", accuracy.Estimate.Strategy,
+		"xid", accuracy.Estimate.XID(), "exact_xid", accuracy.Exact.XID(), "xids_off", accuracy.XIDsOff}
+	if accuracy.TimeError != nil {
+		keyvals = append(keyvals, "committed_at", *accuracy.CommittedAt, "time_error", *accuracy.TimeError)
+	}
+	for _, neighbour := range accuracy.Neighbours {
+		committedAt := "none"
+		if neighbour.CommittedAt != nil {
+			committedAt = neighbour.CommittedAt.Format(time.RFC3339Nano)
+		}
+		keyvals = append(keyvals, "xid_"+neighbour.XID, committedAt)
+	}
+
+	return kitlog.NewLogfmtLogger(os.Stdout).Log(keyvals...)
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/lawrencejones/xid-for-time/pkg/wal"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	scanWAL         = app.Command("scan-wal", "Find the exact last xid that committed before time by reading archived WAL, without connecting to the database")
+	scanWALArchive  = scanWAL.Arg("archive", "Directory, s3://bucket/prefix or gs://bucket/prefix that WAL was archived to").Required().String()
+	scanWALTime     = scanWAL.Arg("time", "Target time to find the last commit before, resolving relative times against the client clock").Required().String()
+	scanWALTimeline = scanWAL.Flag("timeline", "Timeline to follow, defaulting to the newest archived").Uint32()
+	scanWALFormat   = scanWAL.Flag("format", "Format of the result written to stdout").Default(formatLogfmt).Enum(formatLogfmt, formatJSON, formatXID)
+)
+
+func runScanWAL(ctx context.Context) {
+	// There's no server clock to resolve relative times against
+	*relativeTo = clockClient
+
+	targetTime, err := parseTargetTime(ctx, nil, *scanWALTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	archive, err := openArchive(ctx, *scanWALArchive)
+	if err != nil {
+		fatal(err)
+	}
+
+	searcher := wal.NewSearcher(logger, archive)
+	searcher.Timeline = *scanWALTimeline
+
+	result, err := searcher.Search(ctx, targetTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch *scanWALFormat {
+	case formatXID:
+		_, err = fmt.Println(result.Before.XID)
+	case formatJSON:
+		err = json.NewEncoder(os.Stdout).Encode(result)
+	}
+	if err != nil {
+		kingpin.Fatalf("failed to write result: %v", err)
+	}
+}
+
+// openArchive opens the archive at location, a local directory unless given
+// as an s3:// or gs:// URL.
+func openArchive(ctx context.Context, location string) (wal.Archive, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "gs") {
+		return dirArchive(location), nil
+	}
+
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme == "gs" {
+		client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_only")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google credentials: %w", err)
+		}
+
+		return gcsArchive{client: client, bucket: u.Host, prefix: prefix}, nil
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*awsRegion)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		if region, err = s3manager.GetBucketRegion(ctx, sess, u.Host, "us-east-1"); err != nil {
+			return nil, fmt.Errorf("failed to find region of bucket %s: %w", u.Host, err)
+		}
+	}
+
+	return s3Archive{client: s3.New(sess, aws.NewConfig().WithRegion(region)), bucket: u.Host, prefix: prefix}, nil
+}
+
+// dirArchive is a local directory of archived WAL, including any directories
+// within it, as pgBackRest archives segments into.
+type dirArchive string
+
+func (d dirArchive) List(ctx context.Context) ([]string, error) {
+	var names []string
+	err := filepath.Walk(string(d), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			names = append(names, path)
+		}
+
+		return err
+	})
+
+	return names, err
+}
+
+func (d dirArchive) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// s3Archive is an S3 prefix of archived WAL, using credentials resolved from
+// the standard AWS environment, shared config and instance metadata.
+type s3Archive struct {
+	client         *s3.S3
+	bucket, prefix string
+}
+
+func (a s3Archive) List(ctx context.Context) ([]string, error) {
+	var names []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(a.bucket), Prefix: aws.String(a.prefix)}
+	err := a.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			names = append(names, aws.StringValue(object.Key))
+		}
+
+		return true
+	})
+
+	return names, err
+}
+
+func (a s3Archive) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := a.client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(a.bucket), Key: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+
+	return object.Body, nil
+}
+
+// gcsArchive is a Cloud Storage prefix of archived WAL, read through the JSON
+// API with application default credentials.
+type gcsArchive struct {
+	client         *http.Client
+	bucket, prefix string
+}
+
+const gcsEndpoint = "https://storage.googleapis.com/storage/v1/b/"
+
+func (a gcsArchive) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for token := ""; ; {
+		query := url.Values{"prefix": {a.prefix}, "fields": {"items(name),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+
+		body, err := a.get(ctx, gcsEndpoint+url.PathEscape(a.bucket)+"/o?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(body).Decode(&page)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid object listing: %w", err)
+		}
+
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if token = page.NextPageToken; token == "" {
+			return names, nil
+		}
+	}
+}
+
+func (a gcsArchive) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return a.get(ctx, gcsEndpoint+url.PathEscape(a.bucket)+"/o/"+url.PathEscape(name)+"?alt=media")
+}
+
+func (a gcsArchive) get(ctx context.Context, endpoint string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response from Cloud Storage: %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
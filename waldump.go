@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/wal"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	fromWALDump           = app.Command("from-waldump", "Find the exact last xid that committed before time from pg_waldump output read from stdin")
+	fromWALDumpTime       = fromWALDump.Arg("time", "Target time to find the last commit before").Required().String()
+	fromWALDumpCheckTable = fromWALDump.Flag("check-table", "Also estimate from this table, reporting how far its recovery point is from the exact one").String()
+	fromWALDumpIDColumn   = fromWALDump.Flag("id-column", "Monotonic column used to order rows of --check-table").Default(xidfortime.DefaultIDColumn).String()
+	fromWALDumpTimeColumn = fromWALDump.Flag("time-column", "Column recording when each row of --check-table was inserted").Default(xidfortime.DefaultTimeColumn).String()
+	fromWALDumpFormat     = fromWALDump.Flag("format", "Format of the result written to stdout").Default(formatLogfmt).Enum(formatLogfmt, formatJSON, formatXID)
+)
+
+func runFromWALDump(ctx context.Context) {
+	var conn xidfortime.Querier
+	if *fromWALDumpCheckTable != "" {
+		pool, err := connect(ctx)
+		if err != nil {
+			fatal(fmt.Errorf("failed to connect to database: %w", err))
+		}
+		defer pool.Close()
+
+		conn = pool
+	} else {
+		// There's no server clock to resolve relative times against
+		*relativeTo = clockClient
+	}
+
+	targetTime, err := parseTargetTime(ctx, conn, *fromWALDumpTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	commits, err := wal.ReadWALDump(os.Stdin)
+	if err != nil {
+		fatal(fmt.Errorf("failed to read pg_waldump output: %w", err))
+	}
+
+	result, err := wal.FindCommit(commits, targetTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	level.Info(logger).Log("event", "found_commit", "commits", len(commits), "xid", result.Before.XID,
+		"lsn", result.Before.LSN, "committed_at", result.Before.CommittedAt)
+	if result.After == nil {
+		level.Warn(logger).Log("event", "dump_ends_before_target",
+			"msg", "no commit after the target was dumped, so later commits before it may be missing")
+	}
+
+	output := struct {
+		wal.Result
+		Estimate       *jsonResult `json:"estimate,omitempty"`
+		EstimateOffset *int        `json:"estimate_offset,omitempty"`
+	}{Result: result}
+
+	if conn != nil {
+		estimator := xidfortime.NewEstimator(logger)
+		estimator.IDColumn = *fromWALDumpIDColumn
+		estimator.TimeColumn = *fromWALDumpTimeColumn
+		estimator.Concurrency = *maxConns
+		estimator.Retry = retryPolicy()
+		estimator.Snapshot = *snapshot
+
+		estimate, err := estimator.EstimateXID(ctx, conn, *fromWALDumpCheckTable, targetTime)
+		if err != nil {
+			fatal(fmt.Errorf("failed to estimate from %s: %w", *fromWALDumpCheckTable, err))
+		}
+
+		jsonEstimate := newJSONResult(estimate)
+		output.Estimate = &jsonEstimate
+		if offset, ok := estimateOffset(commits, result, estimate); ok {
+			output.EstimateOffset = &offset
+		}
+	}
+
+	switch *fromWALDumpFormat {
+	case formatXID:
+		_, err = fmt.Println(result.Before.XID)
+	case formatJSON:
+		err = json.NewEncoder(os.Stdout).Encode(output)
+	}
+	if err != nil {
+		kingpin.Fatalf("failed to write result: %v", err)
+	}
+}
+
+// estimateOffset counts how many commits a restore to the estimate would keep
+// beyond the exact answer, or how many fewer when negative. Recovery keeps
+// each commit in WAL order up to the estimate's recovery target, so this is
+// where that target's commit falls relative to the last commit before the
+// target time.
+func estimateOffset(commits []wal.Commit, exact wal.Result, estimate xidfortime.Result) (int, bool) {
+	xid, inclusive := recoveryTarget(estimate)
+	target, err := strconv.ParseUint(xid, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	// The 32-bit xid repeats across wraparound, so take the commit nearest the
+	// exact answer
+	before, found := -1, -1
+	for idx, commit := range commits {
+		if commit.LSN == exact.Before.LSN {
+			before = idx
+		}
+	}
+	for idx, commit := range commits {
+		if commit.XID == uint32(target) && (found < 0 || abs(idx-before) < abs(found-before)) {
+			found = idx
+		}
+	}
+
+	if found < 0 {
+		level.Warn(logger).Log("event", "estimate_not_in_dump", "xid", xid,
+			"msg", "the estimate's recovery target never commits in the dumped WAL")
+		return 0, false
+	}
+
+	last := found
+	if !inclusive {
+		last--
+	}
+
+	offset := last - before
+	logLevel := level.Info
+	if offset > 0 {
+		logLevel = level.Warn
+	}
+	logLevel(logger).Log("event", "cross_checked_estimate", "estimate_xid", xid, "exact_xid", exact.Before.XID,
+		"estimate_offset", offset, "msg", "commits kept by restoring to the estimate beyond the exact answer, or fewer if negative")
+
+	return offset, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	restoreWALG            = restore.Command("wal-g", "Pick the WAL-G backup to fetch, and print the fetch command and recovery settings")
+	restoreWALGTable       = restoreWALG.Arg("table", "Table to use for estimates, unless given by --target").String()
+	restoreWALGTime        = restoreWALG.Arg("time", "Target time to restore to").String()
+	restoreWALGDestination = restoreWALG.Flag("destination", "Data directory to fetch the backup into").Required().String()
+	restoreWALGBackupList  = restoreWALG.Flag("backup-list", "Output of wal-g backup-list --json --detail to read instead of running wal-g, or - for stdin").String()
+	restoreWALGCommand     = restoreWALG.Flag("wal-g", "wal-g executable").Default("wal-g").String()
+)
+
+// walgBackup is a backup as listed by wal-g backup-list --json, with only the
+// fields we need to pick a backup. Only the detailed listing has the finish
+// time, otherwise the time the backup was last modified is the best we have.
+type walgBackup struct {
+	BackupName string    `json:"backup_name"`
+	Time       time.Time `json:"time"`
+	FinishTime time.Time `json:"finish_time"`
+}
+
+func runRestoreWALG(ctx context.Context) {
+	if *restoreWALGTable == "" || *restoreWALGTime == "" {
+		kingpin.Fatalf("required arguments 'table' and 'time' not provided, nor the table by --target")
+	}
+
+	list, err := readCatalog(ctx, *restoreWALGBackupList, *restoreWALGCommand, "backup-list", "--json", "--detail")
+	if err != nil {
+		fatal(err)
+	}
+
+	backups, err := walgBackups(list)
+	if err != nil {
+		fatal(err)
+	}
+
+	result, server, err := restoreTarget(ctx, *restoreWALGTable, *restoreWALGTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	selected, err := latestBackupBefore(backups, result.TargetTime)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := writeWALGRestore(os.Stdout, server, result, selected); err != nil {
+		kingpin.Fatalf("failed to write command: %v", err)
+	}
+}
+
+// writeWALGRestore prints the backup-fetch command, followed by the recovery
+// settings to replay WAL fetched by WAL-G up to the target.
+func writeWALGRestore(out io.Writer, server xidfortime.Server, result xidfortime.Result, selected backup) error {
+	command := shellCommand(*restoreWALGCommand, "backup-fetch", *restoreWALGDestination, selected.Label)
+	if _, err := fmt.Fprintln(out, command); err != nil {
+		return err
+	}
+
+	if err := writeRecoveryConf(out, server, result); err != nil {
+		return err
+	}
+
+	restoreCommand := shellCommand(*restoreWALGCommand, "wal-fetch") + " %f %p"
+	_, err := fmt.Fprintf(out, "restore_command = '%s'\n", strings.ReplaceAll(restoreCommand, "'", "''"))
+	return err
+}
+
+// walgBackups lists the backups from wal-g backup-list.
+func walgBackups(list []byte) ([]backup, error) {
+	var listed []walgBackup
+	if err := json.Unmarshal(list, &listed); err != nil {
+		return nil, fmt.Errorf("invalid wal-g backup-list output, which must be from --json: %w", err)
+	}
+
+	backups := make([]backup, 0, len(listed))
+	for _, b := range listed {
+		stop := b.FinishTime
+		if stop.IsZero() {
+			stop = b.Time
+		}
+
+		backups = append(backups, backup{Label: b.BackupName, Stop: stop.UTC()})
+	}
+
+	return backups, nil
+}
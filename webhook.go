@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/lawrencejones/xid-for-time/pkg/xidfortime"
+)
+
+var (
+	webhookURL    = app.Flag("webhook-url", "URL to POST each result or failure to as JSON once an estimate finishes, such as to trigger a restore").String()
+	webhookSecret = app.Flag("webhook-secret", "Secret signing each webhook body with HMAC-SHA256, sent as X-Xid-For-Time-Signature").Envar("XID_FOR_TIME_WEBHOOK_SECRET").String()
+)
+
+// Events sent to the webhook
+const (
+	webhookCompleted = "estimate_completed"
+	webhookFailed    = "estimate_failed"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the body, keyed by
+// --webhook-secret, for receivers to check the notification came from us.
+const webhookSignatureHeader = "X-Xid-For-Time-Signature"
+
+// webhookTimeout bounds each attempt to deliver a notification.
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the body POSTed to the webhook. SentAt lets receivers
+// reject notifications replayed long after they were signed.
+type webhookPayload struct {
+	Event      string      `json:"event"`
+	SentAt     time.Time   `json:"sent_at"`
+	Source     string      `json:"source,omitempty"`
+	Table      string      `json:"table"`
+	TargetTime time.Time   `json:"target_time"`
+	Result     *jsonResult `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// notifyWebhook tells --webhook-url an estimate finished, with its result or
+// why it failed. Delivery is best effort: failures are logged, never failing
+// the estimate they're about. Notifications are sent once results are recorded
+// and written, so aren't bound by the deadline of the run or request that
+// produced them, only webhookTimeout on each attempt.
+func notifyWebhook(source, table string, targetTime time.Time, result xidfortime.Result, err error) {
+	if *webhookURL == "" {
+		return
+	}
+
+	payload := webhookPayload{Event: webhookCompleted, SentAt: time.Now().UTC(), Source: source, Table: table, TargetTime: targetTime}
+	if err != nil {
+		payload.Event, payload.Error = webhookFailed, err.Error()
+	} else {
+		body := newJSONResult(result)
+		payload.Result = &body
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		level.Error(logger).Log("event", "webhook_failed", "error", err)
+		return
+	}
+
+	ctx := context.Background()
+	err = retryPolicy().Do(ctx, logger, "webhook", func() error {
+		return postWebhook(ctx, *webhookURL, *webhookSecret, body)
+	})
+	if err != nil {
+		level.Error(logger).Log("event", "webhook_failed", "error", err)
+		return
+	}
+
+	level.Info(logger).Log("event", "notified_webhook", "webhook_event", payload.Event)
+}
+
+func postWebhook(ctx context.Context, url, secret string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(secret, body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from webhook: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// webhookSignature is the hex HMAC-SHA256 of body keyed by secret.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
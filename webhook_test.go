@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	for _, tc := range []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		// RFC 4231 test case 2
+		{secret: "Jefe", body: "what do ya want for nothing?", want: "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{secret: "secret", body: "", want: "f9e66e179b6747ae54108f82f8ade8b3c25d76fd30afde6c395822c530196169"},
+	} {
+		if got := webhookSignature(tc.secret, []byte(tc.body)); got != tc.want {
+			t.Errorf("webhookSignature(%q, %q) = %s, want %s", tc.secret, tc.body, got, tc.want)
+		}
+	}
+
+	if webhookSignature("secret", []byte("a")) == webhookSignature("other", []byte("a")) {
+		t.Errorf("webhookSignature gave the same signature for different secrets")
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	body := []byte(`{"event":"estimate_completed"}`)
+
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	if err := postWebhook(context.Background(), server.URL, "secret", body); err != nil {
+		t.Fatalf("postWebhook returned error: %v", err)
+	}
+	if string(gotBody) != string(body) {
+		t.Errorf("webhook received body %s, want %s", gotBody, body)
+	}
+	if want := "sha256=" + webhookSignature("secret", body); got.Header.Get(webhookSignatureHeader) != want {
+		t.Errorf("webhook received signature %q, want %q", got.Header.Get(webhookSignatureHeader), want)
+	}
+
+	if err := postWebhook(context.Background(), server.URL, "", body); err != nil {
+		t.Fatalf("postWebhook returned error: %v", err)
+	}
+	if signature := got.Header.Get(webhookSignatureHeader); signature != "" {
+		t.Errorf("webhook received signature %q without a secret", signature)
+	}
+
+	if err := postWebhook(context.Background(), server.URL+"/fail", "secret", body); err == nil {
+		t.Errorf("postWebhook ignored a failed response")
+	}
+}